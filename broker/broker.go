@@ -0,0 +1,213 @@
+package broker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/metrics"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	// subjectPrefix is prepended to every subject built with Subject so that
+	// several deployments can share a nats server. Subjects published by
+	// others, such as the drand hashes, are used as they are.
+	subjectPrefix string
+
+	mu          sync.Mutex
+	onReconnect []func(nc *nats.Conn)
+)
+
+// Config are the nats settings under the nats key of the config. Durations
+// are in seconds.
+type Config struct {
+	Endpoint      string `mapstructure:"endpoint"`
+	CredsFile     string `mapstructure:"creds_file"`
+	NKeyFile      string `mapstructure:"nkey_file"`
+	User          string `mapstructure:"user"`
+	Password      string `mapstructure:"password"`
+	Token         string `mapstructure:"token"`
+	TLS           TLS    `mapstructure:"tls"`
+	ReconnectWait int    `mapstructure:"reconnect_wait"`
+	MaxReconnects int    `mapstructure:"max_reconnects"`
+	SubjectPrefix string `mapstructure:"subject_prefix"`
+}
+
+// TLS are the TLS settings of the nats connection, the client cert is only
+// needed if the server verifies clients.
+type TLS struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// LoadConfig reads and checks the nats settings.
+func LoadConfig() (Config, error) {
+	var conf Config
+
+	// UnmarshalKey alone would drop the defaults of the keys absent from the
+	// config file, AllSettings merges both
+	settings := viper.New()
+	if err := settings.MergeConfigMap(viper.AllSettings()); err != nil {
+		return conf, fmt.Errorf("failed to parse nats config - %s", err.Error())
+	}
+	if err := settings.UnmarshalKey("nats", &conf); err != nil {
+		return conf, fmt.Errorf("failed to parse nats config - %s", err.Error())
+	}
+
+	return conf, conf.Validate()
+}
+
+// Validate checks that the settings describe a usable connection.
+func (conf Config) Validate() error {
+	if conf.Endpoint == "" {
+		return errors.New("nats.endpoint is required")
+	}
+
+	auths := 0
+	for _, v := range []string{conf.CredsFile, conf.NKeyFile, conf.User, conf.Token} {
+		if v != "" {
+			auths++
+		}
+	}
+	if auths > 1 {
+		return errors.New("only one of nats.creds_file, nats.nkey_file, nats.user and nats.token can be set")
+	}
+
+	if strings.ContainsAny(conf.SubjectPrefix, " *>") || strings.HasPrefix(conf.SubjectPrefix, ".") || strings.HasSuffix(conf.SubjectPrefix, ".") {
+		return fmt.Errorf("invalid nats.subject_prefix '%s'", conf.SubjectPrefix)
+	}
+
+	return nil
+}
+
+// Subject returns the subject with the configured prefix.
+func Subject(subj string) string {
+	if subjectPrefix == "" {
+		return subj
+	}
+	return subjectPrefix + "." + subj
+}
+
+// OnReconnect registers fn to be called every time the connection is
+// re-established, e.g. to recreate server side state lost with the server.
+// Plain subscriptions are restored by the client and need no hook.
+func OnReconnect(fn func(nc *nats.Conn)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	onReconnect = append(onReconnect, fn)
+}
+
+// Connect connects to the nats server described by conf and sets the subject
+// prefix. name identifies the connection in the server monitoring.
+func Connect(conf Config, name string) (*nats.Conn, error) {
+	log := zap.L()
+	subjectPrefix = conf.SubjectPrefix
+
+	opts := []nats.Option{
+		nats.Name(name),
+		nats.ReconnectWait(time.Duration(conf.ReconnectWait) * time.Second),
+		nats.MaxReconnects(conf.MaxReconnects),
+		nats.ErrorHandler(metrics.NATSErrorHandler),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			metrics.NATSConnectionEvent("disconnect")
+			log.Warn("disconnected from nats server", zap.Error(err), zap.String("endpoint", conf.Endpoint))
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			metrics.NATSConnectionEvent("reconnect")
+			log.Info("reconnected to nats server",
+				zap.String("server", nc.ConnectedUrlRedacted()),
+				zap.Int("subscriptions", nc.NumSubscriptions()),
+				zap.Uint64("reconnects", nc.Reconnects),
+			)
+
+			mu.Lock()
+			hooks := onReconnect
+			mu.Unlock()
+			// hooks may make requests, which would block the other handlers
+			for _, fn := range hooks {
+				go fn(nc)
+			}
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			metrics.NATSConnectionEvent("closed")
+			if err := nc.LastError(); err != nil {
+				log.Error("nats connection closed, subscriptions are lost", zap.Error(err))
+			} else {
+				log.Info("nats connection closed")
+			}
+		}),
+	}
+
+	switch {
+	case conf.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(conf.CredsFile))
+	case conf.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(conf.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load nats nkey - %s", err.Error())
+		}
+		opts = append(opts, opt)
+	case conf.User != "":
+		opts = append(opts, nats.UserInfo(conf.User, conf.Password))
+	case conf.Token != "":
+		opts = append(opts, nats.Token(conf.Token))
+	}
+
+	if conf.TLS.Enabled {
+		tlsConf, err := tlsConfig(conf.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Secure(tlsConf))
+	}
+
+	nc, err := nats.Connect(conf.Endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats server - %s", err.Error())
+	}
+
+	return nc, nil
+}
+
+func tlsConfig(conf TLS) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+
+	if conf.CAFile != "" {
+		contents, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nats ca file - %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(contents) {
+			return nil, fmt.Errorf("no certs found in nats ca file %s", conf.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load nats client cert - %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "defaults",
+			settings: map[string]interface{}{"endpoint": "nats://127.0.0.1:4222"},
+		},
+		{
+			name:     "no endpoint",
+			settings: map[string]interface{}{},
+			err:      "nats.endpoint is required",
+		},
+		{
+			name:     "creds and token",
+			settings: map[string]interface{}{"endpoint": "nats://127.0.0.1:4222", "creds_file": "/etc/nightowl/nats.creds", "token": "s3cret"},
+			err:      "only one of nats.creds_file, nats.nkey_file, nats.user and nats.token can be set",
+		},
+		{
+			name:     "prefix",
+			settings: map[string]interface{}{"endpoint": "nats://127.0.0.1:4222", "subject_prefix": "staging.nightowl"},
+		},
+		{
+			name:     "wildcard prefix",
+			settings: map[string]interface{}{"endpoint": "nats://127.0.0.1:4222", "subject_prefix": "staging.*"},
+			err:      "invalid nats.subject_prefix 'staging.*'",
+		},
+		{
+			name:     "trailing dot",
+			settings: map[string]interface{}{"endpoint": "nats://127.0.0.1:4222", "subject_prefix": "staging."},
+			err:      "invalid nats.subject_prefix 'staging.'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			viper.Set("nats", tt.settings)
+
+			_, err := LoadConfig()
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSubject(t *testing.T) {
+	defer func() { subjectPrefix = "" }()
+
+	assert.Equal(t, "notif.payouts", Subject("notif.payouts"))
+
+	subjectPrefix = "staging"
+	assert.Equal(t, "staging.notif.payouts", Subject("notif.payouts"))
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/controller"
+	http_no "github.com/nightowlcasino/nightowl/http"
+	"github.com/spf13/viper"
+)
+
+// newRouters returns the router of the public routes of a service and, when
+// <service>.admin_port is set, the server of its separate admin listener.
+// Without an admin listener the admin routes are served on the public port.
+func newRouters(nc *nats.Conn, rdb redis.UniversalClient, serviceProvider string) (*controller.Router, *http_no.Server, error) {
+	admin, err := controller.NewAdminAuth()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	port := viper.GetInt(serviceProvider + ".admin_port")
+	if port == 0 {
+		return controller.NewRouter(nc, rdb, serviceProvider, admin), nil, nil
+	}
+
+	var tls *http_no.TLSFiles
+	if viper.IsSet("admin.tls") {
+		tls = &http_no.TLSFiles{}
+		if err := viper.UnmarshalKey("admin.tls", tls); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse admin.tls - %s", err.Error())
+		}
+	}
+
+	adminServer, err := controller.NewAdminServer(controller.NewAdminRouter(rdb, serviceProvider, admin), port, tls)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create admin server - %s", err.Error())
+	}
+
+	return controller.NewRouter(nc, rdb, serviceProvider, nil), adminServer, nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// loadConfig loads and validates the config of a service and exits with every
+// problem found if it is invalid.
+func loadConfig() *config.Config {
+	conf, err := config.Load()
+	if err != nil {
+		log.Error("invalid config", zap.Error(err))
+		os.Exit(1)
+	}
+	config.Adopt(conf)
+	config.SetLoggingDefaults()
+
+	return conf
+}
+
+// configCommand checks config files without starting any service
+func configCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the config of the services.",
+	}
+
+	c.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Check the config file given with --config, and the NIGHTOWL_* environment variables, without starting any service.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cmd.SilenceUsage = true
+
+			if _, err := config.Load(); err != nil {
+				return fmt.Errorf("%s is invalid - %s", viper.ConfigFileUsed(), err.Error())
+			}
+
+			fmt.Printf("%s is valid\n", viper.ConfigFileUsed())
+			return nil
+		},
+	})
+
+	return c
+}
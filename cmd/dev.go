@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/devnet"
+	http_no "github.com/nightowlcasino/nightowl/http"
+	logger "github.com/nightowlcasino/nightowl/logger"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/nightowlcasino/nightowl/tracing"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// devCommand runs the rng and payout services in one process, optionally
+// next to an embedded nats server, an in-memory redis db and a fake ergo node
+// and explorer, so that the whole bet flow runs on a laptop
+func devCommand() *cobra.Command {
+	var embeddedNATS, memoryRedis, fakeErgo bool
+	var fakeErgoPort int
+	var blockTime time.Duration
+
+	c := &cobra.Command{
+		Use:   "dev",
+		Short: "Run the rng and payout services in one process for local development, with embedded nats, redis and a fake ergo node by default.",
+		Run: func(_ *cobra.Command, _ []string) {
+
+			logger.Initialize("no-dev", hostname)
+			log = zap.L()
+			defer log.Sync()
+
+			log.Warn("running in dev mode, not meant for production")
+
+			// scan often so that a bet is paid out a few blocks after it is placed
+			viper.SetDefault("payout.scan_interval", 10)
+			viper.SetDefault("payout.notif_interval", 5)
+			viper.SetDefault("payout.tx_watch.interval", 10)
+
+			var ns *devnet.NATS
+			if embeddedNATS {
+				var err error
+				ns, err = devnet.StartNATS(0)
+				if err != nil {
+					log.Error("failed to start embedded nats server", zap.Error(err))
+					os.Exit(1)
+				}
+				defer ns.Close()
+
+				viper.Set("nats.endpoint", ns.ClientURL())
+				for _, key := range []string{"creds_file", "nkey_file", "user", "password", "token"} {
+					viper.Set("nats."+key, "")
+				}
+				viper.Set("nats.tls.enabled", false)
+				log.Info("started embedded nats server", zap.String("endpoint", ns.ClientURL()))
+			}
+
+			var mr *devnet.Redis
+			if memoryRedis {
+				var err error
+				mr, err = devnet.StartRedis("")
+				if err != nil {
+					log.Error("failed to start in-memory redis db", zap.Error(err))
+					os.Exit(1)
+				}
+				defer mr.Close()
+
+				viper.Set("redis.mode", state.RedisModeStandalone)
+				viper.Set("redis.addrs", []string{mr.Addr()})
+				viper.Set("redis.username", "")
+				viper.Set("redis.password", "")
+				viper.Set("redis.tls.enabled", false)
+				log.Info("started in-memory redis db", zap.String("addr", mr.Addr()))
+			}
+
+			if fakeErgo {
+				for _, prefix := range []string{"ergo_node", "explorer_node"} {
+					viper.Set(prefix+".scheme", "http")
+					viper.Set(prefix+".fqdn", "127.0.0.1")
+					viper.Set(prefix+".port", fakeErgoPort)
+				}
+				// the fake node wallet signs anything
+				viper.Set("signer.type", "node")
+				viper.SetDefault("ergo_node.api_key", "dev")
+				viper.SetDefault("ergo_node.wallet_password", "dev")
+			}
+
+			conf := loadConfig()
+
+			reg, err := contracts.Load()
+			if err != nil {
+				log.Error("invalid contract registry", zap.Error(err))
+				os.Exit(1)
+			}
+			log.Info("loaded contract registry", zap.String("network", reg.Network))
+
+			shutdownTracing, err := tracing.Init("no-dev")
+			if err != nil {
+				log.Error("failed to set up tracing", zap.Error(err))
+				os.Exit(1)
+			}
+
+			// Connect to the nats server
+			nc := connectNATS("no-dev")
+
+			// Connect to the redis db
+			rdb := connectRedis()
+
+			var chain *devnet.Chain
+			var chainServer *http_no.Server
+			if fakeErgo {
+				chain, err = devnet.NewChain(reg, nc, state.NewSessionStore(context.Background(), rdb))
+				if err != nil {
+					log.Error("failed to create fake ergo chain", zap.Error(err))
+					os.Exit(1)
+				}
+
+				// the services would silently talk to whatever listens on the
+				// port, a real ergo node uses the same one
+				addr := "127.0.0.1:" + strconv.Itoa(fakeErgoPort)
+				l, err := net.Listen("tcp", addr)
+				if err != nil {
+					log.Error("fake ergo node port is not available", zap.Error(err))
+					os.Exit(1)
+				}
+				l.Close()
+
+				chainServer = http_no.NewServer(addr, chain.Handler())
+				chainServer.Start()
+				chain.Start(blockTime)
+				log.Info("started fake ergo node and explorer",
+					zap.Int("port", fakeErgoPort),
+					zap.Duration("block_time", blockTime),
+					zap.String("house_address", reg.HouseAddress),
+				)
+			}
+
+			rngApp, err := newRngApp(conf, nc, rdb)
+			if err != nil {
+				log.Error("failed to create rng service", zap.Error(err))
+				os.Exit(1)
+			}
+
+			payoutApp, err := newPayoutApp(conf, reg, nc, rdb, false)
+			if err != nil {
+				log.Error("failed to create payout service", zap.Error(err))
+				os.Exit(1)
+			}
+
+			rngApp.Start()
+			payoutApp.Start()
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+			go func() {
+				s := <-signals
+				log.Info(s.String() + " signal caught, stopping app")
+				rngApp.Stop()
+				payoutApp.Stop()
+			}()
+
+			log.Info("services started...",
+				zap.Int("rng_port", conf.Rng.Port),
+				zap.Int("payout_port", conf.Payout.Port),
+			)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rngApp.Wait()
+			}()
+			payoutApp.Wait()
+			wg.Wait()
+
+			if chain != nil {
+				chain.Stop()
+				chainServer.Stop()
+				chainServer.Wait()
+			}
+			nc.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				log.Error("failed to flush traces", zap.Error(err))
+			}
+		},
+	}
+
+	c.Flags().BoolVar(&embeddedNATS, "embedded-nats", true, "run an embedded nats server instead of connecting to nats.endpoint")
+	c.Flags().BoolVar(&memoryRedis, "memory-redis", true, "run an in-memory redis db instead of connecting to redis.addrs, its data is lost on exit")
+	c.Flags().BoolVar(&fakeErgo, "fake-ergo", true, "run a fake ergo node and explorer instead of connecting to ergo_node and explorer_node")
+	c.Flags().IntVar(&fakeErgoPort, "fake-ergo-port", 9053, "port of the fake ergo node and explorer")
+	c.Flags().DurationVar(&blockTime, "block-time", 10*time.Second, "time between the blocks of the fake ergo chain")
+
+	return c
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/spf13/cobra"
+)
+
+// keystoreCommand manages the encrypted keystore used by the local tx signer
+func keystoreCommand() *cobra.Command {
+	var out, secretFile, passwordFile, network string
+
+	c := &cobra.Command{
+		Use:   "keystore",
+		Short: "Manage the encrypted keystore holding the secret used by the local tx signer.",
+	}
+
+	newCmd := &cobra.Command{
+		Use:   "new",
+		Short: "Generate a new secret and write it to an encrypted keystore file.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return fmt.Errorf("failed to generate secret - %s", err.Error())
+			}
+			return writeKeystore(out, secret, passwordFile, network)
+		},
+	}
+
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Encrypt an existing hex encoded secret into a keystore file.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			data, err := os.ReadFile(secretFile)
+			if err != nil {
+				return fmt.Errorf("failed to read secret file - %s", err.Error())
+			}
+			secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+			if err != nil {
+				return fmt.Errorf("secret file does not contain a hex encoded secret - %s", err.Error())
+			}
+			return writeKeystore(out, secret, passwordFile, network)
+		},
+	}
+	importCmd.Flags().StringVar(&secretFile, "secret-file", "", "file containing the hex encoded secret to import")
+	importCmd.MarkFlagRequired("secret-file")
+
+	for _, sub := range []*cobra.Command{newCmd, importCmd} {
+		sub.Flags().StringVar(&out, "out", "house.keystore", "keystore file to write")
+		sub.Flags().StringVar(&passwordFile, "password-file", "", "file containing the keystore password")
+		sub.Flags().StringVar(&network, "network", "mainnet", "network of the printed address (mainnet or testnet)")
+		sub.MarkFlagRequired("password-file")
+		c.AddCommand(sub)
+	}
+
+	return c
+}
+
+func writeKeystore(out string, secret []byte, passwordFile, network string) error {
+	sk, err := erg.NewSecretKey(secret)
+	if err != nil {
+		return err
+	}
+
+	password, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return fmt.Errorf("failed to read password file - %s", err.Error())
+	}
+
+	prefix := erg.MainnetPrefix
+	if network == "testnet" {
+		prefix = erg.TestnetPrefix
+	}
+
+	err = erg.WriteKeystore(out, sk, strings.TrimSpace(string(password)), prefix)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("keystore written to %s for address %s\n", out, sk.Address(prefix).String())
+
+	return nil
+}
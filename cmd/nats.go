@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/config"
+	"go.uber.org/zap"
+)
+
+// connectNATS connects the service to the nats server described by the nats
+// config and exits if it can not.
+func connectNATS(name string) *nats.Conn {
+	config.SetNATSDefaults()
+
+	conf, err := broker.LoadConfig()
+	if err != nil {
+		log.Error("invalid nats config", zap.Error(err))
+		os.Exit(1)
+	}
+
+	nc, err := broker.Connect(conf, name)
+	if err != nil {
+		log.Error("failed to connect to nats server", zap.Error(err), zap.String("endpoint", conf.Endpoint))
+		os.Exit(1)
+	}
+	log.Info("connected to nats server", zap.String("server", nc.ConnectedUrlRedacted()))
+
+	return nc
+}
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
 	"os"
 
@@ -13,18 +12,14 @@ import (
 )
 
 var (
-	hostname     string
-	natsEndpoint string
-	cfgFile      string
+	hostname string
+	cfgFile  string
 	cmd = &cobra.Command{
 		Use:   config.Application,
 		Short: config.ApplicationFull,
 	}
 
 	log *zap.Logger
-
-	ErrMissingNodeWalletPass = errors.New("config ergo_node.wallet_password is missing")
-	ErrMissingNodeApiKey = errors.New("config ergo_node.api_key is missing")
 )
 
 // Execute is the core component for all the backend services
@@ -41,6 +36,11 @@ func init() {
 
 	cmd.AddCommand(rngSvcCommand())
 	cmd.AddCommand(payoutSvcCommand())
+	cmd.AddCommand(devCommand())
+	cmd.AddCommand(payoutCommand())
+	cmd.AddCommand(reconcileCommand())
+	cmd.AddCommand(keystoreCommand())
+	cmd.AddCommand(configCommand())
 }
 
 func initConfig() {
@@ -68,12 +68,6 @@ func initConfig() {
 		viper.AddConfigPath(dir)
 		viper.SetConfigName("config")
 		viper.SetConfigType("yaml")
-		viper.WatchConfig()
-		viper.OnConfigChange(func(in fsnotify.Event){
-			log = zap.L()
-			log.Info("config change detected for " + in.Name + " reloading configs")
-			config.SetLoggingDefaults()
-		})
 	}
 
 	if err := viper.ReadInConfig(); err == nil {
@@ -82,4 +76,31 @@ func initConfig() {
 		fmt.Printf("failed to read config file - %s\n", err.Error())
 		os.Exit(1)
 	}
+
+	viper.WatchConfig()
+	viper.OnConfigChange(func(in fsnotify.Event) {
+		log = zap.L()
+		log.Info("config change detected for " + in.Name + " reloading configs")
+		reloadConfig()
+	})
+}
+
+// reloadConfig adopts the changed config file if it is valid, the services
+// keep running with their current settings otherwise.
+func reloadConfig() {
+	changes, err := config.Reload()
+	if err != nil {
+		log.Error("rejected invalid config, keeping the running settings", zap.Error(err))
+		return
+	}
+	config.SetLoggingDefaults()
+
+	for _, c := range changes {
+		fields := []zap.Field{zap.String("key", c.Key), zap.Any("old", c.Old), zap.Any("new", c.New)}
+		if c.Restart {
+			log.Warn("config changed, takes effect after a restart", fields...)
+		} else {
+			log.Info("config changed", fields...)
+		}
+	}
 }
\ No newline at end of file
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
@@ -14,11 +15,19 @@ import (
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/nats-io/nats.go"
 	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/contracts"
 	"github.com/nightowlcasino/nightowl/controller"
+	"github.com/nightowlcasino/nightowl/erg"
+	http_no "github.com/nightowlcasino/nightowl/http"
 	logger "github.com/nightowlcasino/nightowl/logger"
+	"github.com/nightowlcasino/nightowl/metrics"
+	"github.com/nightowlcasino/nightowl/services/bankroll"
+	"github.com/nightowlcasino/nightowl/services/mempool"
 	"github.com/nightowlcasino/nightowl/services/notif"
 	"github.com/nightowlcasino/nightowl/services/payout"
+	"github.com/nightowlcasino/nightowl/services/reconcile"
 	"github.com/nightowlcasino/nightowl/state"
+	"github.com/nightowlcasino/nightowl/tracing"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -27,7 +36,10 @@ import (
 // payoutSvcCommand is responsible for traversing the oracle addresses containing
 // all the nightowl games bets and paying out the respective winner
 func payoutSvcCommand() *cobra.Command {
-	return &cobra.Command{
+	var dryRun bool
+	var dryRunFile string
+
+	c := &cobra.Command{
 		Use:   "payout-svc",
 		Short: "Run a server that traverses the oracle addresses containing all the nightowl games bets and pay out the respective winner.",
 		Run: func(_ *cobra.Command, _ []string) {
@@ -36,126 +48,229 @@ func payoutSvcCommand() *cobra.Command {
 			log = zap.L()
 			defer log.Sync()
 
-			config.SetLoggingDefaults()
-
-			if value := viper.Get("nats.endpoint"); value != nil {
-				natsEndpoint = value.(string)
-			} else {
-				natsEndpoint = nats.DefaultURL
-			}
-
-			if value := viper.Get("nats.notif_payouts_subj"); value == nil {
-				viper.Set("nats.notif_payouts_subj", "notif.payouts")
+			// a dry run computes every payout without sending txs and keeps its
+			// redis data apart from the instance it shadows
+			if dryRun {
+				viper.Set("payout.dry_run", true)
+				viper.Set("payout.dry_run_file", dryRunFile)
+				state.SetNamespace(payout.DryRunNamespace)
+				log.Warn("running in dry-run mode, no txs will be sent", zap.String("redis_namespace", payout.DryRunNamespace), zap.String("results_file", dryRunFile))
 			}
 
-			if value := viper.Get("payout.port"); value == nil {
-				viper.Set("rng.port", "8090")
-			}
+			conf := loadConfig()
 
-			if value := viper.Get("ergo_node.api_key"); value == nil {
-				log.Error("required config is absent", zap.Error(ErrMissingNodeApiKey))
+			reg, err := contracts.Load()
+			if err != nil {
+				log.Error("invalid contract registry", zap.Error(err))
 				os.Exit(1)
 			}
+			log.Info("loaded contract registry", zap.String("network", reg.Network))
 
-			if value := viper.Get("ergo_node.wallet_password"); value == nil {
-				log.Error("required config is absent", zap.Error(ErrMissingNodeWalletPass))
+			shutdownTracing, err := tracing.Init("no-payout-svc")
+			if err != nil {
+				log.Error("failed to set up tracing", zap.Error(err))
 				os.Exit(1)
 			}
 
 			// Connect to the nats server
-			nc, err := nats.Connect(natsEndpoint)
-			if err != nil {
-				log.Error("failed to connect to nats server", zap.Error(err), zap.String("endpoint", natsEndpoint))
-				os.Exit(1)
-			}
+			nc := connectNATS("no-payout-svc")
 
 			// Connect to the redis db
-			rdb := redis.NewClient(&redis.Options{
-				Addr:	  "localhost:6379",
-				Password: "",
-				DB:		  0,
-			})
-			_, err = rdb.Ping(context.Background()).Result()
-			if err != nil {
-				log.Error("failed to connect to redis db", zap.Error(err), zap.String("endpoint", "localhost:6379"))
-			}
-
-			t := &http.Transport{
-				Dial: (&net.Dialer{
-					Timeout: 3 * time.Second,
-				}).Dial,
-				MaxIdleConns:        100,
-				MaxConnsPerHost:     100,
-				MaxIdleConnsPerHost: 100,
-				TLSHandshakeTimeout: 3 * time.Second,
-			}
-
-			retryClient := retryablehttp.NewClient()
-			retryClient.HTTPClient.Transport = t
-			retryClient.HTTPClient.Timeout = time.Second * 10
-			retryClient.Logger = nil
-			retryClient.RetryWaitMin = 200 * time.Millisecond
-			retryClient.RetryWaitMax = 250 * time.Millisecond
-			retryClient.RetryMax = 2
-			retryClient.RequestLogHook = func(l retryablehttp.Logger, r *http.Request, i int) {
-				retryCount := i
-				if retryCount > 0 {
-					log.Info("retryClient request failed, retrying...",
-						zap.String("url", r.URL.String()),
-						zap.Int("retryCount", retryCount),
-					)
-				}
-			}
+			rdb := connectRedis()
 
-			var wg sync.WaitGroup
-
-			notifState := state.NewNotifState(context.Background(), rdb)
-
-			payoutSvc, err := payout.NewService(rdb, retryClient, notifState, &wg)
+			app, err := newPayoutApp(conf, reg, nc, rdb, dryRun)
 			if err != nil {
 				log.Error("failed to create payout service", zap.Error(err))
 				os.Exit(1)
 			}
 
-			notifSvc, err := notif.NewService(nc, rdb, retryClient, notifState, &wg)
-			if err != nil {
-				log.Error("failed to create notif service", zap.Error(err))
-				os.Exit(1)
-			}
-
-			// populate NotifState from redis DB
-			err = notifState.DBSync()
-			if err != nil {
-				log.Error("failed to sync redis DB for notif state", zap.Error(err))
-				os.Exit(1)
-			}
-
-			router := controller.NewRouter(nc, rdb, "payout")
-			server := controller.NewServer(router, viper.Get("payout.port").(int))
-
-			server.Start()
-			payoutSvc.Start()
-			notifSvc.Start()
+			app.Start()
 
 			signals := make(chan os.Signal, 1)
 			signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 			go func() {
 				s := <-signals
 				log.Info(s.String() + " signal caught, stopping app")
-				payoutSvc.Stop()
-				notifSvc.Stop()
-				server.Stop()
+				app.Stop()
 			}()
 
 			log.Info("service started...")
 
-			wg.Add(1)
-			go payoutSvc.Wait(&wg)
-			wg.Add(1)
-			go notifSvc.Wait(&wg)
-			go server.Wait()
+			app.Wait()
 
-			wg.Wait()
+			// flush the spans of the last bets
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				log.Error("failed to flush traces", zap.Error(err))
+			}
 		},
 	}
-}
\ No newline at end of file
+
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "compute payouts and unsigned txs without sending them, results go to the dryrun redis namespace")
+	c.Flags().StringVar(&dryRunFile, "dry-run-file", "", "write dry-run results to this JSONL file instead of redis")
+
+	return c
+}
+
+// newRetryClient returns the http client used to talk to the ergo node and
+// explorer
+func newRetryClient() *retryablehttp.Client {
+	t := &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout: 3 * time.Second,
+		}).Dial,
+		MaxIdleConns:        100,
+		MaxConnsPerHost:     100,
+		MaxIdleConnsPerHost: 100,
+		TLSHandshakeTimeout: 3 * time.Second,
+	}
+
+	retryClient := retryablehttp.NewClient()
+	retryClient.HTTPClient.Transport = tracing.Transport(metrics.InstrumentTransport(t))
+	retryClient.HTTPClient.Timeout = time.Second * 10
+	retryClient.Logger = nil
+	retryClient.RetryWaitMin = 200 * time.Millisecond
+	retryClient.RetryWaitMax = 250 * time.Millisecond
+	retryClient.RetryMax = 2
+	retryClient.RequestLogHook = func(l retryablehttp.Logger, r *http.Request, i int) {
+		retryCount := i
+		if retryCount > 0 {
+			log.Info("retryClient request failed, retrying...",
+				zap.String("url", r.URL.String()),
+				zap.Int("retryCount", retryCount),
+			)
+		}
+	}
+
+	return retryClient
+}
+
+// payoutApp is the payout service together with the services running next to
+// it and its servers, so that it can be run on its own or next to the rng
+// service.
+type payoutApp struct {
+	wg          sync.WaitGroup
+	bankroll    *bankroll.Service
+	payout      *payout.Service
+	notif       *notif.Service
+	reconcile   *reconcile.Service
+	mempool     *mempool.Service
+	server      *http_no.Server
+	adminServer *http_no.Server
+	router      *controller.Router
+}
+
+func newPayoutApp(conf *config.Config, reg *contracts.Registry, nc *nats.Conn, rdb redis.UniversalClient, dryRun bool) (*payoutApp, error) {
+	var err error
+
+	a := &payoutApp{}
+	retryClient := newRetryClient()
+
+	notifState := state.NewNotifState(context.Background(), rdb)
+	metrics.RegisterPendingNotifs(notifState.Len)
+
+	a.bankroll, err = bankroll.NewService(rdb, retryClient, reg.HouseAddress, &a.wg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bankroll service - %s", err.Error())
+	}
+
+	a.payout, err = payout.NewService(nc, rdb, retryClient, reg, a.bankroll, notifState, &a.wg)
+	if err != nil {
+		return nil, err
+	}
+
+	// players are not notified about the results of a dry run and its
+	// txs can not be found on chain
+	if !dryRun {
+		a.notif, err = notif.NewService(nc, rdb, retryClient, notifState, &a.wg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notif service - %s", err.Error())
+		}
+
+		a.reconcile, err = reconcile.NewService(rdb, retryClient, &a.wg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create reconcile service - %s", err.Error())
+		}
+
+		a.mempool, err = mempool.NewService(nc, rdb, retryClient, reg, &a.wg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mempool service - %s", err.Error())
+		}
+	}
+
+	// populate NotifState from redis DB
+	err = notifState.DBSync()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync redis DB for notif state - %s", err.Error())
+	}
+
+	a.router, a.adminServer, err = newRouters(nc, rdb, "payout")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create routers - %s", err.Error())
+	}
+	a.server = controller.NewServer(a.router, conf.Payout.Port)
+
+	ergNode, err := erg.NewErgNode(retryClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erg node client - %s", err.Error())
+	}
+	a.router.AddCheck("redis", controller.RedisCheck(rdb))
+	a.router.AddCheck("nats", controller.NATSCheck(nc))
+	a.router.AddCheck("ergo_node", controller.NodeCheck(ergNode, conf.Health.NodeMaxLag))
+	a.router.AddCheck("payout_loop", controller.HeartbeatCheck("payout loop heartbeat", a.payout.Heartbeat,
+		time.Duration(conf.Health.PayoutMaxAge)*time.Second))
+
+	return a, nil
+}
+
+func (a *payoutApp) Start() {
+	a.server.Start()
+	if a.adminServer != nil {
+		a.adminServer.Start()
+	}
+	a.bankroll.Start()
+	a.payout.Start()
+	if a.notif != nil {
+		a.notif.Start()
+		a.reconcile.Start()
+		a.mempool.Start()
+	}
+	a.router.Ready()
+}
+
+func (a *payoutApp) Stop() {
+	a.payout.Stop()
+	a.bankroll.Stop()
+	if a.notif != nil {
+		a.notif.Stop()
+		a.reconcile.Stop()
+		a.mempool.Stop()
+	}
+	a.server.Stop()
+	if a.adminServer != nil {
+		a.adminServer.Stop()
+	}
+}
+
+// Wait blocks until the services are stopped.
+func (a *payoutApp) Wait() {
+	a.wg.Add(1)
+	go a.payout.Wait(&a.wg)
+	a.wg.Add(1)
+	go a.bankroll.Wait(&a.wg)
+	if a.notif != nil {
+		a.wg.Add(1)
+		go a.notif.Wait(&a.wg)
+		a.wg.Add(1)
+		go a.reconcile.Wait(&a.wg)
+		a.wg.Add(1)
+		go a.mempool.Wait(&a.wg)
+	}
+	go a.server.Wait()
+	if a.adminServer != nil {
+		go a.adminServer.Wait()
+	}
+
+	a.wg.Wait()
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/contracts"
+	logger "github.com/nightowlcasino/nightowl/logger"
+	"github.com/nightowlcasino/nightowl/services/bankroll"
+	"github.com/nightowlcasino/nightowl/services/payout"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// payoutCommand groups the one-off maintenance tasks of the payout service
+func payoutCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "payout",
+		Short: "Maintenance tasks of the payout service.",
+	}
+
+	c.AddCommand(payoutReplayCommand())
+	c.AddCommand(payoutReindexCommand())
+
+	return c
+}
+
+// payoutReplayCommand re-scans a range of oracle txs and reports the status
+// of every bet, optionally settling the ones which were missed
+func payoutReplayCommand() *cobra.Command {
+	var fromHeight, toHeight int
+	var game string
+	var settle bool
+
+	c := &cobra.Command{
+		Use:   "replay",
+		Short: "Re-scan oracle txs for a height range and report the status of every bet (settled, missing, mismatched).",
+		RunE: func(_ *cobra.Command, _ []string) error {
+
+			logger.Initialize("no-payout-replay", hostname)
+			log = zap.L()
+			defer log.Sync()
+
+			if _, err := config.Load(); err != nil {
+				return fmt.Errorf("invalid config - %s", err.Error())
+			}
+			config.SetLoggingDefaults()
+
+			if toHeight < fromHeight {
+				return fmt.Errorf("--to-height must not be below --from-height")
+			}
+
+			reg, err := contracts.Load()
+			if err != nil {
+				return fmt.Errorf("invalid contract registry - %s", err.Error())
+			}
+
+			// Connect to the redis db
+			rdb, _, err := newRedisClient()
+			if err != nil {
+				return err
+			}
+
+			var wg sync.WaitGroup
+			retryClient := newRetryClient()
+			notifState := state.NewNotifState(context.Background(), rdb)
+
+			bankrollSvc, err := bankroll.NewService(rdb, retryClient, reg.HouseAddress, &wg)
+			if err != nil {
+				return fmt.Errorf("failed to create bankroll service - %s", err.Error())
+			}
+
+			// settling has to respect the bankroll limits of the running service
+			if settle {
+				if err := bankrollSvc.Refresh(); err != nil {
+					return fmt.Errorf("failed to refresh bankroll - %s", err.Error())
+				}
+			}
+
+			payoutSvc, err := payout.NewService(nil, rdb, retryClient, reg, bankrollSvc, notifState, &wg)
+			if err != nil {
+				return fmt.Errorf("failed to create payout service - %s", err.Error())
+			}
+
+			results, err := payoutSvc.Replay(fromHeight, toHeight, game, settle)
+			if err != nil {
+				return err
+			}
+
+			counts := make(map[string]int)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "HEIGHT\tBOX ID\tSTATUS\tTX ID\tDETAIL")
+			for _, r := range results {
+				counts[r.Status]++
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", r.Height, r.BoxId, r.Status, r.TxId, r.Detail)
+			}
+			w.Flush()
+
+			fmt.Printf("\n%d bets:", len(results))
+			for _, status := range []string{payout.ReplaySettled, payout.ReplayRefunded, payout.ReplayMissing, payout.ReplayMismatched, payout.ReplayPending, payout.ReplaySpent, payout.ReplayInvalid, payout.ReplayError} {
+				if counts[status] > 0 {
+					fmt.Printf(" %d %s", counts[status], status)
+				}
+			}
+			fmt.Println()
+
+			return nil
+		},
+	}
+
+	c.Flags().IntVar(&fromHeight, "from-height", 0, "first block height to re-scan")
+	c.Flags().IntVar(&toHeight, "to-height", 0, "last block height to re-scan")
+	c.Flags().StringVar(&game, "game", contracts.Roulette, "game whose bets are replayed")
+	c.Flags().BoolVar(&settle, "settle", false, "settle bets which are missing a settlement")
+	c.MarkFlagRequired("from-height")
+	c.MarkFlagRequired("to-height")
+
+	return c
+}
+
+// payoutReindexCommand rebuilds the per player index of bets, which only
+// holds the bets seen since the payout service started maintaining it
+func payoutReindexCommand() *cobra.Command {
+	var game string
+
+	c := &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild the index of bets per player from the bets stored in redis.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+
+			logger.Initialize("no-payout-reindex", hostname)
+			log = zap.L()
+			defer log.Sync()
+
+			if _, err := config.Load(); err != nil {
+				return fmt.Errorf("invalid config - %s", err.Error())
+			}
+			config.SetLoggingDefaults()
+
+			// Connect to the redis db
+			rdb, _, err := newRedisClient()
+			if err != nil {
+				return err
+			}
+
+			count, err := state.NewPlayerIndex(context.Background(), rdb).Rebuild(game + ":*")
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("indexed %d bets\n", count)
+
+			return nil
+		},
+	}
+
+	c.Flags().StringVar(&game, "game", contracts.Roulette, "game whose bets are indexed")
+
+	return c
+}
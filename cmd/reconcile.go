@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/nightowlcasino/nightowl/config"
+	logger "github.com/nightowlcasino/nightowl/logger"
+	"github.com/nightowlcasino/nightowl/services/reconcile"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// reconcileCommand checks every settled bet in redis against the chain once
+// and prints the report
+func reconcileCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reconcile",
+		Short: "Verify that the tx of every settled bet exists on chain and pays the recorded winner the recorded amount.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+
+			logger.Initialize("no-reconcile", hostname)
+			log = zap.L()
+			defer log.Sync()
+
+			if _, err := config.Load(); err != nil {
+				return fmt.Errorf("invalid config - %s", err.Error())
+			}
+			config.SetLoggingDefaults()
+
+			// Connect to the redis db
+			rdb, _, err := newRedisClient()
+			if err != nil {
+				return err
+			}
+
+			var wg sync.WaitGroup
+			reconcileSvc, err := reconcile.NewService(rdb, newRetryClient(), &wg)
+			if err != nil {
+				return fmt.Errorf("failed to create reconcile service - %s", err.Error())
+			}
+
+			report, err := reconcileSvc.Run()
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(report)
+
+			if len(report.Discrepancies) > 0 {
+				return fmt.Errorf("found %d discrepancies", len(report.Discrepancies))
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/metrics"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const redisWatchInterval = 5 * time.Second
+
+// newRedisClient connects to the redis db described by the redis config and
+// sets the key prefix. Commands which run once fail on any redis error.
+func newRedisClient() (redis.UniversalClient, state.RedisConfig, error) {
+	config.SetRedisDefaults()
+
+	conf, err := state.LoadRedisConfig()
+	if err != nil {
+		return nil, conf, fmt.Errorf("invalid redis config - %s", err.Error())
+	}
+	state.SetPrefix(conf.KeyPrefix)
+
+	rdb, err := state.NewRedisClient(conf)
+	if err != nil {
+		return nil, conf, fmt.Errorf("failed to create redis client - %s", err.Error())
+	}
+	rdb.AddHook(metrics.RedisHook{})
+
+	_, err = rdb.Ping(context.Background()).Result()
+	if err != nil {
+		return rdb, conf, fmt.Errorf("failed to connect to redis db - %s", err.Error())
+	}
+
+	return rdb, conf, nil
+}
+
+// connectRedis connects the long running services to the redis db. With
+// redis.on_failure set to exit the process exits when redis can not be reached
+// at startup or stays unreachable for longer than redis.max_outage, with
+// degrade it keeps running and the services wait for redis to come back.
+func connectRedis() redis.UniversalClient {
+	rdb, conf, err := newRedisClient()
+	switch {
+	case rdb == nil:
+		log.Error("failed to set up redis db", zap.Error(err))
+		os.Exit(1)
+	case err != nil && conf.OnFailure == state.RedisOnFailureExit:
+		log.Error("failed to connect to redis db", zap.Error(err), zap.Strings("endpoints", conf.Addrs))
+		os.Exit(1)
+	case err != nil:
+		log.Warn("failed to connect to redis db, running degraded until it is reachable", zap.Error(err), zap.Strings("endpoints", conf.Addrs))
+	}
+
+	maxOutage := time.Duration(viper.GetInt("redis.max_outage")) * time.Second
+	go watchRedis(rdb, conf, maxOutage)
+
+	return rdb
+}
+
+// watchRedis pings redis for the life of the process and applies the
+// redis.on_failure policy to outages.
+func watchRedis(rdb redis.UniversalClient, conf state.RedisConfig, maxOutage time.Duration) {
+	var down time.Time
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), redisWatchInterval)
+		err := rdb.Ping(ctx).Err()
+		cancel()
+
+		switch {
+		case err == nil && !down.IsZero():
+			log.Info("redis db is reachable again", zap.Duration("outage", time.Since(down).Truncate(time.Second)))
+			down = time.Time{}
+		case err != nil && down.IsZero():
+			log.Warn("redis db is unreachable", zap.Error(err), zap.Strings("endpoints", conf.Addrs))
+			down = time.Now()
+		case err != nil && conf.OnFailure == state.RedisOnFailureExit && time.Since(down) > maxOutage:
+			log.Error("redis db unreachable for too long, exiting", zap.Error(err), zap.Duration("outage", time.Since(down).Truncate(time.Second)))
+			os.Exit(1)
+		}
+
+		time.Sleep(redisWatchInterval)
+	}
+}
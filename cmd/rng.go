@@ -1,20 +1,22 @@
 package cmd
 
 import (
-	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-redis/redis/v9"
 	"github.com/nats-io/nats.go"
 	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/contracts"
 	"github.com/nightowlcasino/nightowl/controller"
+	http_no "github.com/nightowlcasino/nightowl/http"
 
 	logger "github.com/nightowlcasino/nightowl/logger"
 	"github.com/nightowlcasino/nightowl/services/rng"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -30,74 +32,94 @@ func rngSvcCommand() *cobra.Command {
 			log = zap.L()
 			defer log.Sync()
 
-			config.SetLoggingDefaults()
+			conf := loadConfig()
 
-			// validate configs and set defaults if necessary
-			if value := viper.Get("nats.endpoint"); value != nil {
-				natsEndpoint = value.(string)
-			} else {
-				natsEndpoint = nats.DefaultURL
-			}
-
-			if value := viper.Get("nats.random_number_subj"); value == nil {
-				viper.Set("nats.random_number_subj", "drand.hash")
-			}
-
-			if value := viper.Get("rng.port"); value == nil {
-				viper.Set("rng.port", "8089")
-			}
-
-			if value := viper.Get("ergo_node.api_key"); value == nil {
-				log.Error("required config is absent", zap.Error(ErrMissingNodeApiKey))
-				os.Exit(1)
-			}
-
-			if value := viper.Get("ergo_node.wallet_password"); value == nil {
-				log.Error("required config is absent", zap.Error(ErrMissingNodeWalletPass))
+			reg, err := contracts.Load()
+			if err != nil {
+				log.Error("invalid contract registry", zap.Error(err))
 				os.Exit(1)
 			}
+			log.Info("loaded contract registry", zap.String("network", reg.Network))
 
 			// Connect to the nats server
-			nc, err := nats.Connect(natsEndpoint)
-			if err != nil {
-				log.Error("failed to connect to nats server", zap.Error(err), zap.String("endpoint", natsEndpoint))
-				os.Exit(1)
-			}
+			nc := connectNATS("no-rng-svc")
 
 			// Connect to the redis db
-			rdb := redis.NewClient(&redis.Options{
-				Addr:	  "localhost:6379",
-				Password: "",
-				DB:		  0,
-			})
-			_, err = rdb.Ping(context.Background()).Result()
-			if err != nil {
-				log.Error("failed to connect to redis db", zap.Error(err), zap.String("endpoint", "localhost:6379"))
-				os.Exit(1)
-			}
+			rdb := connectRedis()
 
-			_, err = rng.NewService(nc)
+			app, err := newRngApp(conf, nc, rdb)
 			if err != nil {
 				log.Error("failed to create rng service", zap.Error(err))
 				os.Exit(1)
 			}
 
-			router := controller.NewRouter(nc, rdb, "rng")
-			server := controller.NewServer(router, viper.Get("rng.port").(int))
-			
-			server.Start()
-			
+			app.Start()
+
 			signals := make(chan os.Signal, 1)
 			signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 			go func() {
 				s := <-signals
 				log.Info(s.String() + " signal caught, stopping app")
-				server.Stop()
+				app.Stop()
 			}()
 
 			log.Info("service started...")
 
-			server.Wait()
+			app.Wait()
 		},
 	}
-}
\ No newline at end of file
+}
+
+// rngApp is the rng service together with its servers, so that it can be run
+// on its own or next to the payout service.
+type rngApp struct {
+	server      *http_no.Server
+	adminServer *http_no.Server
+	router      *controller.Router
+}
+
+func newRngApp(conf *config.Config, nc *nats.Conn, rdb redis.UniversalClient) (*rngApp, error) {
+	rngSvc, err := rng.NewService(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	router, adminServer, err := newRouters(nc, rdb, "rng")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create routers - %s", err.Error())
+	}
+
+	router.AddCheck("redis", controller.RedisCheck(rdb))
+	router.AddCheck("nats", controller.NATSCheck(nc))
+	router.AddCheck("drand", controller.HeartbeatCheck("drand beacon", rngSvc.LastBeacon,
+		time.Duration(conf.Health.DrandMaxAge)*time.Second))
+
+	return &rngApp{
+		server:      controller.NewServer(router, conf.Rng.Port),
+		adminServer: adminServer,
+		router:      router,
+	}, nil
+}
+
+func (a *rngApp) Start() {
+	a.server.Start()
+	if a.adminServer != nil {
+		a.adminServer.Start()
+	}
+	a.router.Ready()
+}
+
+func (a *rngApp) Stop() {
+	a.server.Stop()
+	if a.adminServer != nil {
+		a.adminServer.Stop()
+	}
+}
+
+// Wait blocks until the servers are stopped.
+func (a *rngApp) Wait() {
+	if a.adminServer != nil {
+		go a.adminServer.Wait()
+	}
+	a.server.Wait()
+}
@@ -2,11 +2,9 @@ package config
 
 import (
 	"errors"
-	"os"
 
 	"github.com/nightowlcasino/nightowl/logger"
 	"github.com/spf13/viper"
-	"go.uber.org/zap"
 )
 
 const (
@@ -15,57 +13,283 @@ const (
 )
 
 var (
-	log *zap.Logger
-
 	ErrMissingNodeWalletPass = errors.New("config ergo_node.wallet_password is missing")
 	ErrMissingNodeApiKey = errors.New("config ergo_node.api_key is missing")
+	ErrMissingKeystoreFile = errors.New("config signer.keystore_file is missing")
+	ErrMissingKeystorePass = errors.New("config signer.keystore_password is missing")
 )
 
 func SetLoggingDefaults() {
 	if value := viper.Get("logging.level"); value != nil {
 		// logger will default to info level if user provided level is incorrect
-		logger.SetLevel(value.(string))
+		logger.SetLevel(viper.GetString("logging.level"))
 	} else {
 		logger.SetLevel("info")
 	}
 }
 
-func SetNodeDefaults() {
-	log = zap.L()
+func SetServiceDefaults() {
+	if value := viper.Get("logging.level"); value == nil {
+		viper.SetDefault("logging.level", "info")
+	}
+
+	// mainnet or testnet, selects the contracts
+	if value := viper.Get("network"); value == nil {
+		viper.SetDefault("network", "mainnet")
+	}
+
+	if value := viper.Get("rng.port"); value == nil {
+		viper.SetDefault("rng.port", 8089)
+	}
+
+	if value := viper.Get("payout.port"); value == nil {
+		viper.SetDefault("payout.port", 8090)
+	}
+
+	if value := viper.Get("nats.notif_payouts_subj"); value == nil {
+		viper.SetDefault("nats.notif_payouts_subj", "notif.payouts")
+	}
+
+	if value := viper.Get("nats.random_number_subj"); value == nil {
+		viper.SetDefault("nats.random_number_subj", "drand.hash")
+	}
+}
+
+func SetAuthDefaults() {
+	// seconds a player has to sign a login challenge
+	if value := viper.Get("auth.challenge_ttl"); value == nil {
+		viper.SetDefault("auth.challenge_ttl", 300)
+	}
+
+	// seconds a player session lasts
+	if value := viper.Get("auth.session_ttl"); value == nil {
+		viper.SetDefault("auth.session_ttl", 3600)
+	}
+}
+
+func SetHealthDefaults() {
+	// seconds a readiness check of all dependencies may take
+	if value := viper.Get("health.timeout"); value == nil {
+		viper.SetDefault("health.timeout", 5)
+	}
+
+	// blocks the node may be behind its headers or peers and still be synced
+	if value := viper.Get("health.node_max_lag"); value == nil {
+		viper.SetDefault("health.node_max_lag", 2)
+	}
+
+	// seconds since the last drand beacon before the rng service is not ready
+	if value := viper.Get("health.drand_max_age"); value == nil {
+		viper.SetDefault("health.drand_max_age", 300)
+	}
+
+	// seconds since the payout loop made progress before it is not ready
+	if value := viper.Get("health.payout_max_age"); value == nil {
+		viper.SetDefault("health.payout_max_age", 600)
+	}
+}
+
+func SetTracingDefaults() {
+	// none, stdout, file or jaeger
+	if value := viper.Get("tracing.exporter"); value == nil {
+		viper.SetDefault("tracing.exporter", "none")
+	}
+
+	// spans are appended to this file as JSON lines by the file exporter
+	if value := viper.Get("tracing.file"); value == nil {
+		viper.SetDefault("tracing.file", "traces.jsonl")
+	}
+
+	if value := viper.Get("tracing.jaeger_endpoint"); value == nil {
+		viper.SetDefault("tracing.jaeger_endpoint", "http://localhost:14268/api/traces")
+	}
+
+	// share of the traces which are recorded, from 0 to 1
+	if value := viper.Get("tracing.sample_ratio"); value == nil {
+		viper.SetDefault("tracing.sample_ratio", 1.0)
+	}
+}
+
+func SetRateLimitDefaults() {
+	// requests per second a client may make to the notifications route
+	if value := viper.Get("rate_limits.notifs"); value == nil {
+		viper.SetDefault("rate_limits.notifs", 0.1)
+	}
 
+	// requests per second a client may make to the login routes
+	if value := viper.Get("rate_limits.auth"); value == nil {
+		viper.SetDefault("rate_limits.auth", 1.0)
+	}
+}
+
+func SetNATSDefaults() {
+	if value := viper.Get("nats.endpoint"); value == nil {
+		viper.SetDefault("nats.endpoint", "nats://127.0.0.1:4222")
+	}
+
+	// seconds between reconnect attempts
+	if value := viper.Get("nats.reconnect_wait"); value == nil {
+		viper.SetDefault("nats.reconnect_wait", 2)
+	}
+
+	// -1 reconnects forever, subscriptions are lost once the client gives up
+	if value := viper.Get("nats.max_reconnects"); value == nil {
+		viper.SetDefault("nats.max_reconnects", -1)
+	}
+}
+
+func SetRedisDefaults() {
+	// standalone, sentinel or cluster
+	if value := viper.Get("redis.mode"); value == nil {
+		viper.SetDefault("redis.mode", "standalone")
+	}
+
+	// the server, the sentinels or the cluster nodes to connect to
+	if value := viper.Get("redis.addrs"); value == nil {
+		viper.SetDefault("redis.addrs", []string{"localhost:6379"})
+	}
+
+	if value := viper.Get("redis.db"); value == nil {
+		viper.SetDefault("redis.db", 0)
+	}
+
+	// seconds
+	if value := viper.Get("redis.dial_timeout"); value == nil {
+		viper.SetDefault("redis.dial_timeout", 5)
+	}
+
+	if value := viper.Get("redis.read_timeout"); value == nil {
+		viper.SetDefault("redis.read_timeout", 3)
+	}
+
+	if value := viper.Get("redis.write_timeout"); value == nil {
+		viper.SetDefault("redis.write_timeout", 3)
+	}
+
+	// exit or degrade when redis can not be reached
+	if value := viper.Get("redis.on_failure"); value == nil {
+		viper.SetDefault("redis.on_failure", "exit")
+	}
+
+	// seconds redis may be unreachable before a service exits
+	if value := viper.Get("redis.max_outage"); value == nil {
+		viper.SetDefault("redis.max_outage", 60)
+	}
+}
+
+func SetNodeDefaults() {
 	if value := viper.Get("ergo_node.fqdn"); value == nil {
-		viper.Set("ergo_node.fqdn", "213.239.193.208")
+		viper.SetDefault("ergo_node.fqdn", "213.239.193.208")
 	}
 
 	if value := viper.Get("ergo_node.scheme"); value == nil {
-		viper.Set("ergo_node.scheme", "http")
+		viper.SetDefault("ergo_node.scheme", "http")
 	}
 
 	if value := viper.Get("ergo_node.port"); value == nil {
-		viper.Set("ergo_node.port", 9053)
+		viper.SetDefault("ergo_node.port", 9053)
+	}
+}
+
+func SetSignerDefaults() {
+	if value := viper.Get("signer.type"); value == nil {
+		viper.SetDefault("signer.type", "node")
+	}
+
+	if value := viper.Get("signer.network"); value == nil {
+		viper.SetDefault("signer.network", "mainnet")
+	}
+}
+
+func SetPayoutDefaults() {
+	// seconds between scans of the oracle txs for new bets
+	if value := viper.Get("payout.scan_interval"); value == nil {
+		viper.SetDefault("payout.scan_interval", 120)
+	}
+
+	// seconds between checks of the payouts players still have to be notified about
+	if value := viper.Get("payout.notif_interval"); value == nil {
+		viper.SetDefault("payout.notif_interval", 30)
+	}
+
+	// bets without a random number are refunded after ~1 day of blocks
+	if value := viper.Get("payout.refund_expiry_blocks"); value == nil {
+		viper.SetDefault("payout.refund_expiry_blocks", 720)
+	}
+
+	// bets failing this many times are moved to the dead letter set
+	if value := viper.Get("payout.max_bet_attempts"); value == nil {
+		viper.SetDefault("payout.max_bet_attempts", 10)
+	}
+
+	if value := viper.Get("payout.miner_fee"); value == nil {
+		viper.SetDefault("payout.miner_fee", 1000000) // 0.0010 ERG
+	}
+
+	if value := viper.Get("payout.tx_watch.interval"); value == nil {
+		viper.SetDefault("payout.tx_watch.interval", 60)
+	}
+
+	// seconds a tx may sit in the mempool before it is replaced with a higher fee
+	if value := viper.Get("payout.tx_watch.replace_after"); value == nil {
+		viper.SetDefault("payout.tx_watch.replace_after", 1800)
+	}
+
+	if value := viper.Get("payout.tx_watch.fee_multiplier"); value == nil {
+		viper.SetDefault("payout.tx_watch.fee_multiplier", 2.0)
+	}
+
+	if value := viper.Get("payout.tx_watch.max_fee"); value == nil {
+		viper.SetDefault("payout.tx_watch.max_fee", 10000000) // 0.0100 ERG
+	}
+
+	if value := viper.Get("payout.tx_watch.max_rebroadcasts"); value == nil {
+		viper.SetDefault("payout.tx_watch.max_rebroadcasts", 10)
+	}
+
+	// seconds to wait for the explorer before a tx whose bet box is spent is rejected
+	if value := viper.Get("payout.tx_watch.spent_grace"); value == nil {
+		viper.SetDefault("payout.tx_watch.spent_grace", 600)
+	}
+
+	if value := viper.Get("nats.alerts_subj"); value == nil {
+		viper.SetDefault("nats.alerts_subj", "alerts.payout")
+	}
+
+	if value := viper.Get("nats.jetstream.stream"); value == nil {
+		viper.SetDefault("nats.jetstream.stream", "NOTIFS")
+	}
+
+	if value := viper.Get("nats.jetstream.subject_prefix"); value == nil {
+		viper.SetDefault("nats.jetstream.subject_prefix", "notifs")
+	}
+
+	// hours notifications are kept in the stream, same as the redis fallback
+	if value := viper.Get("nats.jetstream.max_age"); value == nil {
+		viper.SetDefault("nats.jetstream.max_age", 336)
 	}
 
-	if value := viper.Get("ergo_node.api_key"); value == nil {
-		log.Error("required config is absent", zap.Error(ErrMissingNodeApiKey))
-		os.Exit(1)
+	// seconds a player has to ack a notification before it is redelivered
+	if value := viper.Get("nats.jetstream.ack_wait"); value == nil {
+		viper.SetDefault("nats.jetstream.ack_wait", 30)
 	}
 
-	if value := viper.Get("ergo_node.wallet_password"); value == nil {
-		log.Error("required config is absent", zap.Error(ErrMissingNodeWalletPass))
-		os.Exit(1)
+	// -1 redelivers until the notification is acked or expires
+	if value := viper.Get("nats.jetstream.max_deliver"); value == nil {
+		viper.SetDefault("nats.jetstream.max_deliver", -1)
 	}
 }
 
 func SetExplorerDefaults() {
 	if value := viper.Get("explorer_node.fqdn"); value == nil {
-		viper.Set("explorer_node.fqdn", "api.ergoplatform.com")
+		viper.SetDefault("explorer_node.fqdn", "api.ergoplatform.com")
 	}
 
 	if value := viper.Get("explorer_node.scheme"); value == nil {
-		viper.Set("explorer_node.scheme", "https")
+		viper.SetDefault("explorer_node.scheme", "https")
 	}
 
 	if value := viper.Get("explorer_node.port"); value == nil {
-		viper.Set("explorer_node.port", 443)
+		viper.SetDefault("explorer_node.port", 443)
 	}
 }
\ No newline at end of file
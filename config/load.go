@@ -0,0 +1,420 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the config,
+// e.g. NIGHTOWL_ERGO_NODE_API_KEY overrides ergo_node.api_key.
+const EnvPrefix = "NIGHTOWL"
+
+// secretKeys can also be read from the file named by <key>_file, e.g.
+// ergo_node.api_key_file or NIGHTOWL_ERGO_NODE_API_KEY_FILE, so that they do
+// not have to be written in the config or the environment.
+var secretKeys = []string{
+	"ergo_node.user",
+	"ergo_node.password",
+	"ergo_node.api_key",
+	"ergo_node.wallet_password",
+	"signer.keystore_password",
+	"redis.password",
+	"redis.sentinel_password",
+	"nats.password",
+	"nats.token",
+}
+
+// fromFile holds the secret keys set from their files by a previous Load.
+var fromFile = map[string]bool{}
+
+// Config is the configuration shared by every service. The contracts and
+// admin sections are parsed by the packages using them, the bankroll limits
+// and game tokens are checked by the services applying them.
+type Config struct {
+	Logging      Logging      `mapstructure:"logging"`
+	Network      string       `mapstructure:"network"`
+	Auth         Auth         `mapstructure:"auth"`
+	RateLimits   RateLimits   `mapstructure:"rate_limits"`
+	ErgoNode     ErgoNode     `mapstructure:"ergo_node"`
+	ExplorerNode ExplorerNode `mapstructure:"explorer_node"`
+	Signer       Signer       `mapstructure:"signer"`
+	Rng          Rng          `mapstructure:"rng"`
+	Payout       Payout       `mapstructure:"payout"`
+	Bankroll     Bankroll     `mapstructure:"bankroll"`
+	Reconcile    Interval     `mapstructure:"reconcile"`
+	Mempool      Interval     `mapstructure:"mempool"`
+	Health       Health       `mapstructure:"health"`
+	Tracing      Tracing      `mapstructure:"tracing"`
+	NATS         NATS         `mapstructure:"nats"`
+	Redis        Redis        `mapstructure:"redis"`
+}
+
+type Logging struct {
+	Level string `mapstructure:"level"`
+}
+
+// Auth ttls are in seconds.
+type Auth struct {
+	ChallengeTTL int `mapstructure:"challenge_ttl"`
+	SessionTTL   int `mapstructure:"session_ttl"`
+}
+
+// RateLimits are requests per second per client.
+type RateLimits struct {
+	Notifs float64 `mapstructure:"notifs"`
+	Auth   float64 `mapstructure:"auth"`
+}
+
+type ErgoNode struct {
+	FQDN           string `mapstructure:"fqdn"`
+	Scheme         string `mapstructure:"scheme"`
+	Port           int    `mapstructure:"port"`
+	User           string `mapstructure:"user"`
+	Password       string `mapstructure:"password"`
+	ApiKey         string `mapstructure:"api_key"`
+	WalletPassword string `mapstructure:"wallet_password"`
+}
+
+type ExplorerNode struct {
+	FQDN   string `mapstructure:"fqdn"`
+	Scheme string `mapstructure:"scheme"`
+	Port   int    `mapstructure:"port"`
+}
+
+type Signer struct {
+	Type             string `mapstructure:"type"`
+	Network          string `mapstructure:"network"`
+	KeystoreFile     string `mapstructure:"keystore_file"`
+	KeystorePassword string `mapstructure:"keystore_password"`
+}
+
+type Rng struct {
+	Port      int `mapstructure:"port"`
+	AdminPort int `mapstructure:"admin_port"`
+}
+
+type Payout struct {
+	Port               int             `mapstructure:"port"`
+	AdminPort          int             `mapstructure:"admin_port"`
+	DryRun             bool            `mapstructure:"dry_run"`
+	DryRunFile         string          `mapstructure:"dry_run_file"`
+	ScanInterval       int             `mapstructure:"scan_interval"`
+	NotifInterval      int             `mapstructure:"notif_interval"`
+	RefundExpiryBlocks int             `mapstructure:"refund_expiry_blocks"`
+	MaxBetAttempts     int             `mapstructure:"max_bet_attempts"`
+	MinerFee           int             `mapstructure:"miner_fee"`
+	TxWatch            TxWatch         `mapstructure:"tx_watch"`
+	Games              map[string]Game `mapstructure:"games"`
+	WS                 WS              `mapstructure:"ws"`
+}
+
+// Game holds the switch of a game and the tokens it accepts. Without tokens
+// the game accepts the OWL token of the contract registry.
+type Game struct {
+	Enabled *bool       `mapstructure:"enabled"`
+	Tokens  []GameToken `mapstructure:"tokens"`
+}
+
+// GameToken is a token accepted by a game, a MaxStake of 0 is unbounded.
+type GameToken struct {
+	Id       string `mapstructure:"id"`
+	Name     string `mapstructure:"name"`
+	MinStake int    `mapstructure:"min_stake"`
+	MaxStake int    `mapstructure:"max_stake"`
+}
+
+// WS holds the origins allowed to open a notification websocket.
+type WS struct {
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+}
+
+// GameEnabled reports whether bets of the game are served, games are enabled
+// unless disabled in payout.games.<game>.enabled.
+func (c *Config) GameEnabled(game string) bool {
+	g, ok := c.Payout.Games[game]
+	return !ok || g.Enabled == nil || *g.Enabled
+}
+
+// TxWatch durations are in seconds, fees in nanoErgs.
+type TxWatch struct {
+	Interval        int     `mapstructure:"interval"`
+	ReplaceAfter    int     `mapstructure:"replace_after"`
+	FeeMultiplier   float64 `mapstructure:"fee_multiplier"`
+	MaxFee          int     `mapstructure:"max_fee"`
+	MaxRebroadcasts int     `mapstructure:"max_rebroadcasts"`
+	SpentGrace      int     `mapstructure:"spent_grace"`
+}
+
+type Bankroll struct {
+	RefreshInterval int              `mapstructure:"refresh_interval"`
+	Limits          []BankrollLimits `mapstructure:"limits"`
+}
+
+// BankrollLimits are the risk limits of a single token, a limit of 0 is
+// disabled.
+type BankrollLimits struct {
+	TokenId          string `mapstructure:"token_id"`
+	MaxSinglePayout  int    `mapstructure:"max_single_payout"`
+	MaxRoundExposure int    `mapstructure:"max_round_exposure"`
+	ReserveFloor     int    `mapstructure:"reserve_floor"`
+}
+
+// Interval is the seconds between the runs of a background service.
+type Interval struct {
+	Interval int `mapstructure:"interval"`
+}
+
+// Health durations are in seconds.
+type Health struct {
+	Timeout      int `mapstructure:"timeout"`
+	NodeMaxLag   int `mapstructure:"node_max_lag"`
+	DrandMaxAge  int `mapstructure:"drand_max_age"`
+	PayoutMaxAge int `mapstructure:"payout_max_age"`
+}
+
+type Tracing struct {
+	Exporter       string  `mapstructure:"exporter"`
+	File           string  `mapstructure:"file"`
+	JaegerEndpoint string  `mapstructure:"jaeger_endpoint"`
+	SampleRatio    float64 `mapstructure:"sample_ratio"`
+}
+
+type NATS struct {
+	broker.Config    `mapstructure:",squash"`
+	NotifPayoutsSubj string    `mapstructure:"notif_payouts_subj"`
+	RandomNumberSubj string    `mapstructure:"random_number_subj"`
+	AlertsSubj       string    `mapstructure:"alerts_subj"`
+	JetStream        JetStream `mapstructure:"jetstream"`
+}
+
+// JetStream max_age is in hours, ack_wait in seconds.
+type JetStream struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Stream        string `mapstructure:"stream"`
+	SubjectPrefix string `mapstructure:"subject_prefix"`
+	MaxAge        int    `mapstructure:"max_age"`
+	AckWait       int    `mapstructure:"ack_wait"`
+	MaxDeliver    int    `mapstructure:"max_deliver"`
+}
+
+type Redis struct {
+	state.RedisConfig `mapstructure:",squash"`
+	MaxOutage         int `mapstructure:"max_outage"`
+}
+
+// Load sets the defaults, applies the NIGHTOWL_* environment variables and
+// the secret files to the config read by viper, then parses and validates it.
+func Load() (*Config, error) {
+	BindEnv()
+	SetDefaults()
+
+	if err := loadSecretFiles(); err != nil {
+		return nil, err
+	}
+
+	conf := &Config{}
+	if err := viper.Unmarshal(conf); err != nil {
+		return nil, fmt.Errorf("failed to parse config - %s", err.Error())
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// BindEnv lets every key of Config, and the secret files, be overridden by a
+// NIGHTOWL_* environment variable.
+func BindEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	for _, key := range configKeys("", reflect.TypeOf(Config{})) {
+		viper.BindEnv(key)
+	}
+	for _, key := range secretKeys {
+		viper.BindEnv(key + "_file")
+	}
+}
+
+// configKeys returns the viper keys of the fields of t.
+func configKeys(prefix string, t reflect.Type) []string {
+	var keys []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+
+		key := prefix
+		if opts != "squash" {
+			key = strings.TrimPrefix(prefix+"."+name, ".")
+		}
+
+		if f.Type.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(key, f.Type)...)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func loadSecretFiles() error {
+	for _, key := range secretKeys {
+		file := viper.GetString(key + "_file")
+		if file == "" {
+			continue
+		}
+		if viper.GetString(key) != "" && !fromFile[key] {
+			return fmt.Errorf("only one of %s and %s_file can be set", key, key)
+		}
+
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s_file - %s", key, err.Error())
+		}
+		viper.Set(key, strings.TrimRight(string(contents), "\r\n"))
+		fromFile[key] = true
+	}
+
+	return nil
+}
+
+// SetDefaults sets the default of every key of Config absent from the config.
+func SetDefaults() {
+	SetServiceDefaults()
+	SetAuthDefaults()
+	SetRateLimitDefaults()
+	SetNodeDefaults()
+	SetExplorerDefaults()
+	SetSignerDefaults()
+	SetPayoutDefaults()
+	SetHealthDefaults()
+	SetTracingDefaults()
+	SetNATSDefaults()
+	SetRedisDefaults()
+}
+
+// Validate checks every setting and returns all the problems found.
+func (c *Config) Validate() error {
+	var errs *multierror.Error
+	fail := func(format string, a ...interface{}) {
+		errs = multierror.Append(errs, fmt.Errorf(format, a...))
+	}
+
+	oneOf(fail, "logging.level", c.Logging.Level, "debug", "info", "warn", "error")
+	oneOf(fail, "network", c.Network, "mainnet", "testnet")
+	positive(fail, "auth.challenge_ttl", c.Auth.ChallengeTTL)
+	positive(fail, "auth.session_ttl", c.Auth.SessionTTL)
+	if c.RateLimits.Notifs <= 0 || c.RateLimits.Auth <= 0 {
+		fail("rate_limits.notifs and rate_limits.auth must be greater than 0")
+	}
+
+	oneOf(fail, "ergo_node.scheme", c.ErgoNode.Scheme, "http", "https")
+	port(fail, "ergo_node.port", c.ErgoNode.Port, false)
+	if c.ErgoNode.FQDN == "" {
+		fail("ergo_node.fqdn is required")
+	}
+	if c.ErgoNode.ApiKey == "" {
+		errs = multierror.Append(errs, ErrMissingNodeApiKey)
+	}
+
+	oneOf(fail, "explorer_node.scheme", c.ExplorerNode.Scheme, "http", "https")
+	port(fail, "explorer_node.port", c.ExplorerNode.Port, false)
+	if c.ExplorerNode.FQDN == "" {
+		fail("explorer_node.fqdn is required")
+	}
+
+	oneOf(fail, "signer.type", c.Signer.Type, "node", "local")
+	oneOf(fail, "signer.network", c.Signer.Network, "mainnet", "testnet")
+	switch {
+	case c.Signer.Type == "local" && c.Signer.KeystoreFile == "":
+		errs = multierror.Append(errs, ErrMissingKeystoreFile)
+	case c.Signer.Type == "local" && c.Signer.KeystorePassword == "":
+		errs = multierror.Append(errs, ErrMissingKeystorePass)
+	case c.Signer.Type != "local" && !c.Payout.DryRun && c.ErgoNode.WalletPassword == "":
+		// the node wallet is only needed when it signs our txs
+		errs = multierror.Append(errs, ErrMissingNodeWalletPass)
+	}
+
+	port(fail, "rng.port", c.Rng.Port, false)
+	port(fail, "rng.admin_port", c.Rng.AdminPort, true)
+	port(fail, "payout.port", c.Payout.Port, false)
+	port(fail, "payout.admin_port", c.Payout.AdminPort, true)
+	if c.Payout.RefundExpiryBlocks < 0 {
+		fail("payout.refund_expiry_blocks must not be negative")
+	}
+	positive(fail, "payout.scan_interval", c.Payout.ScanInterval)
+	positive(fail, "payout.notif_interval", c.Payout.NotifInterval)
+	positive(fail, "payout.max_bet_attempts", c.Payout.MaxBetAttempts)
+	positive(fail, "payout.miner_fee", c.Payout.MinerFee)
+	positive(fail, "payout.tx_watch.interval", c.Payout.TxWatch.Interval)
+	positive(fail, "payout.tx_watch.replace_after", c.Payout.TxWatch.ReplaceAfter)
+	if c.Payout.TxWatch.FeeMultiplier <= 1 {
+		fail("payout.tx_watch.fee_multiplier must be greater than 1")
+	}
+	if c.Payout.TxWatch.MaxFee < c.Payout.MinerFee {
+		fail("payout.tx_watch.max_fee must not be lower than payout.miner_fee")
+	}
+
+	positive(fail, "health.timeout", c.Health.Timeout)
+	positive(fail, "health.drand_max_age", c.Health.DrandMaxAge)
+	positive(fail, "health.payout_max_age", c.Health.PayoutMaxAge)
+	// the payout loop is unhealthy whenever it did not run within the max age
+	if c.Payout.ScanInterval >= c.Health.PayoutMaxAge {
+		fail("payout.scan_interval must be lower than health.payout_max_age")
+	}
+
+	oneOf(fail, "tracing.exporter", c.Tracing.Exporter, "none", "stdout", "file", "jaeger")
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio must be between 0 and 1")
+	}
+
+	if err := c.NATS.Validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if c.NATS.NotifPayoutsSubj == "" || c.NATS.RandomNumberSubj == "" || c.NATS.AlertsSubj == "" {
+		fail("nats.notif_payouts_subj, nats.random_number_subj and nats.alerts_subj must not be empty")
+	}
+
+	if err := c.Redis.Validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	positive(fail, "redis.max_outage", c.Redis.MaxOutage)
+
+	return errs.ErrorOrNil()
+}
+
+func oneOf(fail func(string, ...interface{}), key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	fail("%s must be one of %s, got '%s'", key, strings.Join(allowed, ", "), value)
+}
+
+func positive(fail func(string, ...interface{}), key string, value int) {
+	if value <= 0 {
+		fail("%s must be greater than 0, got %d", key, value)
+	}
+}
+
+// port checks a listen or remote port, optional ports may be 0.
+func port(fail func(string, ...interface{}), key string, value int, optional bool) {
+	if optional && value == 0 {
+		return
+	}
+	if value < 1 || value > 65535 {
+		fail("%s must be a port between 1 and 65535, got %d", key, value)
+	}
+}
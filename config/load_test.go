@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readConfig(t *testing.T, file string) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.SetConfigFile(file)
+	require.NoError(t, viper.ReadInConfig())
+}
+
+func TestLoad(t *testing.T) {
+	readConfig(t, "testdata/conf.good.yaml")
+
+	conf, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 8090, conf.Payout.Port)
+	assert.Equal(t, 8089, conf.Rng.Port)
+	assert.Equal(t, "abcdef1234", conf.ErgoNode.ApiKey)
+	assert.Equal(t, []string{"localhost:6379"}, conf.Redis.Addrs)
+	assert.Equal(t, "notif.payouts", conf.NATS.NotifPayoutsSubj)
+	assert.Equal(t, 2.0, conf.Payout.TxWatch.FeeMultiplier)
+	assert.Equal(t, []GameToken{{
+		Id:       "afd0d6cb61e86d15f2a0adc1e7e23df532ba3ff35f8ba88bed16729cae933032",
+		Name:     "OWL",
+		MinStake: 1,
+		MaxStake: 100000,
+	}}, conf.Payout.Games["roulette"].Tokens)
+	require.Len(t, conf.Bankroll.Limits, 2)
+	assert.Equal(t, 10000000, conf.Bankroll.Limits[0].MaxRoundExposure)
+	assert.Equal(t, "ERG", conf.Bankroll.Limits[1].TokenId)
+}
+
+func TestLoadEnv(t *testing.T) {
+	readConfig(t, "testdata/conf.good.yaml")
+
+	secret := filepath.Join(t.TempDir(), "redis_password")
+	require.NoError(t, os.WriteFile(secret, []byte("fromFile\n"), 0600))
+
+	t.Setenv("NIGHTOWL_PAYOUT_PORT", "9090")
+	t.Setenv("NIGHTOWL_REDIS_ADDRS", "redis-1:6379,redis-2:6379")
+	t.Setenv("NIGHTOWL_ERGO_NODE_API_KEY", "fromEnv")
+	t.Setenv("NIGHTOWL_REDIS_PASSWORD_FILE", secret)
+
+	conf, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 9090, conf.Payout.Port)
+	assert.Equal(t, []string{"redis-1:6379", "redis-2:6379"}, conf.Redis.Addrs)
+	assert.Equal(t, "fromEnv", conf.ErgoNode.ApiKey)
+	assert.Equal(t, "fromFile", conf.Redis.Password)
+}
+
+func TestValidate(t *testing.T) {
+	readConfig(t, "testdata/conf.good.yaml")
+	viper.Set("payout.port", 70000)
+	viper.Set("tracing.exporter", "zipkin")
+	viper.Set("signer.type", "local")
+	viper.Set("signer.keystore_file", "")
+	viper.Set("payout.scan_interval", 600)
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "payout.port")
+	assert.Contains(t, err.Error(), "tracing.exporter must be one of none, stdout, file, jaeger, got 'zipkin'")
+	assert.Contains(t, err.Error(), ErrMissingKeystoreFile.Error())
+	assert.Contains(t, err.Error(), "payout.scan_interval must be lower than health.payout_max_age")
+}
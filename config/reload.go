@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+// reloadable are the keys, or key prefixes ending with a dot, whose changes
+// are applied to the running services. Other changes need a restart.
+var reloadable = []string{
+	"logging.level",
+	"rate_limits.",
+	"payout.scan_interval",
+	"payout.notif_interval",
+	"payout.games.",
+	"payout.miner_fee",
+	"payout.tx_watch.",
+	"bankroll.limits",
+}
+
+var (
+	current atomic.Value // *Config
+
+	reloadMu  sync.Mutex
+	reloaders []namedReloader
+	// flattened settings of the current config, to log what a reload changes
+	adopted map[string]interface{}
+)
+
+// Reloader parses and checks the settings a service reloads from the new
+// config. It must not change anything itself but return the func adopting
+// them, which is only called once every reloader accepted the new config.
+type Reloader func(conf *Config) (apply func(), err error)
+
+type namedReloader struct {
+	name   string
+	reload Reloader
+}
+
+// Change is a setting changed by a reload. Secrets are masked.
+type Change struct {
+	Key     string
+	Old     interface{}
+	New     interface{}
+	Restart bool
+}
+
+// OnReload registers a reloader called by every Reload.
+func OnReload(name string, reload Reloader) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	reloaders = append(reloaders, namedReloader{name: name, reload: reload})
+}
+
+// Adopt makes conf the config returned by Current.
+func Adopt(conf *Config) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	adopted = flatten("", viper.AllSettings())
+	current.Store(conf)
+}
+
+// Current returns the config adopted last. The services read the settings
+// which can be reloaded from it at the time they use them, so a change
+// applies to all of them at once. Before any config is adopted it holds the
+// defaults and whatever viper read, without validation.
+func Current() *Config {
+	if conf, ok := current.Load().(*Config); ok {
+		return conf
+	}
+
+	SetDefaults()
+	conf := &Config{}
+	_ = viper.Unmarshal(conf)
+	return conf
+}
+
+// Reload loads the config viper read again and adopts it if it is valid and
+// every reloader accepts it. An invalid config is rejected as a whole and the
+// services keep running with the current one. viper is left holding the
+// rejected settings, so they must be read through Current.
+func Reload() ([]Change, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	conf, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	applies := make([]func(), 0, len(reloaders))
+	for _, r := range reloaders {
+		apply, err := r.reload(conf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s settings - %s", r.name, err.Error())
+		}
+		applies = append(applies, apply)
+	}
+
+	for _, apply := range applies {
+		apply()
+	}
+	current.Store(conf)
+
+	settings := flatten("", viper.AllSettings())
+	changes := diff(adopted, settings)
+	adopted = settings
+
+	return changes, nil
+}
+
+func flatten(prefix string, settings map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(settings))
+
+	for k, v := range settings {
+		key := prefix + k
+		if m, ok := v.(map[string]interface{}); ok {
+			for fk, fv := range flatten(key+".", m) {
+				flat[fk] = fv
+			}
+			continue
+		}
+		flat[key] = v
+	}
+
+	return flat
+}
+
+func diff(old, new map[string]interface{}) []Change {
+	var changes []Change
+
+	keys := make(map[string]bool, len(new))
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+
+	for k := range keys {
+		o, n := old[k], new[k]
+		if reflect.DeepEqual(o, n) {
+			continue
+		}
+		if isSecret(k) {
+			o, n = mask(o), mask(n)
+		}
+		changes = append(changes, Change{Key: k, Old: o, New: n, Restart: !isReloadable(k)})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+func isReloadable(key string) bool {
+	for _, r := range reloadable {
+		if key == r || strings.HasSuffix(r, ".") && strings.HasPrefix(key, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretSuffixes end the keys whose values are masked in the changes of a
+// reload. Only suffixes are matched so that e.g. the game tokens are shown.
+var secretSuffixes = []string{"password", "api_key", "api_keys", "_file", ".user", ".token"}
+
+func isSecret(key string) bool {
+	for _, s := range secretSuffixes {
+		if strings.HasSuffix(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func mask(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return "***"
+}
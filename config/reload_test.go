@@ -0,0 +1,124 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func adoptConfig(t *testing.T, file string) *Config {
+	readConfig(t, file)
+	t.Cleanup(func() {
+		reloaders = nil
+		adopted = nil
+		current = atomic.Value{}
+	})
+
+	conf, err := Load()
+	require.NoError(t, err)
+	Adopt(conf)
+
+	return conf
+}
+
+func TestReload(t *testing.T) {
+	conf := adoptConfig(t, "testdata/conf.good.yaml")
+
+	applied := false
+	OnReload("test", func(conf *Config) (func(), error) {
+		return func() { applied = true }, nil
+	})
+
+	viper.Set("payout.scan_interval", 60)
+	viper.Set("ergo_node.api_key", "newKey")
+	viper.Set("nats.endpoint", "nats://nats:4222")
+
+	changes, err := Reload()
+	require.NoError(t, err)
+	assert.True(t, applied)
+	assert.NotSame(t, conf, Current())
+	assert.Equal(t, 60, Current().Payout.ScanInterval)
+	assert.Equal(t, []Change{
+		{Key: "ergo_node.api_key", Old: "***", New: "***", Restart: true},
+		{Key: "nats.endpoint", Old: "nats://127.0.0.1:4222", New: "nats://nats:4222", Restart: true},
+		{Key: "payout.scan_interval", Old: 120, New: 60},
+	}, changes)
+}
+
+func TestReloadRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		value  interface{}
+		reload error
+	}{
+		{"invalid config", "payout.scan_interval", 0, nil},
+		{"rejected by a reloader", "payout.scan_interval", 60, errors.New("bad limits")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := adoptConfig(t, "testdata/conf.good.yaml")
+
+			applied := false
+			OnReload("accepting", func(conf *Config) (func(), error) {
+				return func() { applied = true }, nil
+			})
+			OnReload("test", func(conf *Config) (func(), error) {
+				return func() {}, tt.reload
+			})
+
+			viper.Set(tt.key, tt.value)
+
+			_, err := Reload()
+			require.Error(t, err)
+			assert.False(t, applied)
+			assert.Same(t, conf, Current())
+		})
+	}
+}
+
+func TestReloadRejectedKeepsSettings(t *testing.T) {
+	adoptConfig(t, "testdata/conf.good.yaml")
+	tokens := Current().Payout.Games["roulette"].Tokens
+
+	viper.Set("payout.games.roulette.tokens", []map[string]interface{}{
+		{"id": strings.Repeat("0", 64), "name": "TEST", "min_stake": 1},
+	})
+	viper.Set("payout.scan_interval", 0)
+
+	_, err := Reload()
+	require.Error(t, err)
+
+	// viper holds the rejected config, the services keep reading the adopted one
+	assert.Equal(t, 0, viper.GetInt("payout.scan_interval"))
+	assert.Equal(t, 120, Current().Payout.ScanInterval)
+	assert.Equal(t, tokens, Current().Payout.Games["roulette"].Tokens)
+}
+
+func TestIsSecret(t *testing.T) {
+	tests := []struct {
+		key    string
+		secret bool
+	}{
+		{"ergo_node.user", true},
+		{"ergo_node.api_key", true},
+		{"ergo_node.api_key_file", true},
+		{"ergo_node.wallet_password", true},
+		{"redis.sentinel_password", true},
+		{"nats.token", true},
+		{"admin.api_keys", true},
+		{"payout.games.roulette.tokens", false},
+		{"redis.username", false},
+		{"nats.notif_payouts_subj", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.secret, isSecret(tt.key), tt.key)
+	}
+}
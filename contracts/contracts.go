@@ -0,0 +1,204 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/spf13/viper"
+)
+
+const (
+	Mainnet = "mainnet"
+	Testnet = "testnet"
+
+	Roulette = "roulette"
+)
+
+var (
+	current *Registry
+
+	// defaults are the contracts nightowl is deployed with. Testnet has none,
+	// every entry has to be provided by config.
+	defaults = map[string]Registry{
+		Mainnet: {
+			HouseAddress:  "ofgUTY7c693MfaVxfuZ1YhG7RQuQCLqa7mqFHkkZcpo9r5oPmmXaemS3raHAzfP4MXXc7DiueGDFsrZ5Hp3ZK",
+			OracleAddress: "4FC5xSYb7zfRdUhm6oRmE11P2GJqSMY8UARPbHkmXEq6hTinXq4XNWdJs73BEV44MdmJ49Qo",
+			Games: map[string]Game{
+				Roulette: {ErgoTree: "101b0400040004000402054a0e20473041c7e13b5f5947640f79f00d3c5df22fad4841191260350bb8c526f9851f040004000514052605380504050404020400040205040404050f05120406050604080509050c040a0e200ef2e4e25f93775412ac620a1da495943c55ea98e72f3e95d1a18d7ace2f676cd809d601b2a5730000d602b2db63087201730100d603b2db6501fe730200d604e4c672010404d605e4c6a70404d6069e7cb2e4c67203041a9a72047303007304d607e4c6a70504d6087e720705d6099972087206d1ed96830301938c7202017305938c7202028cb2db6308a77306000293b2b2e4c67203050c1a720400e4c67201050400c5a79597830601ed937205730795ec9072067308ed9272067309907206730a939e7206730b7208ed949e7206730c7208ec937207730d937207730eed937205730f939e720673107208eded937205731192720973129072097313ed9372057314939e720673157208eded937205731692720973179072097318ed9372057319937208720693c27201e4c6a7060e93cbc27201731a"},
+			},
+			Tokens: map[string]string{
+				"OWL": "afd0d6cb61e86d15f2a0adc1e7e23df532ba3ff35f8ba88bed16729cae933032",
+			},
+		},
+		Testnet: {},
+	}
+)
+
+// Game holds the contract guarding the bet boxes of a game.
+type Game struct {
+	ErgoTree string `mapstructure:"ergo_tree" json:"ergoTree"`
+	// Refundable is set for contracts with a refund path, which let a bet box
+	// be spent without the oracle box by a tx whose first output returns the
+	// tokens of the box to the player in R6. The mainnet roulette contract
+	// only pays out results, so its bets can not be refunded.
+	Refundable bool `mapstructure:"refundable" json:"refundable"`
+}
+
+// Registry is the set of contracts, addresses and tokens nightowl works with
+// on a single network.
+type Registry struct {
+	Network       string            `mapstructure:"-"              json:"network"`
+	HouseAddress  string            `mapstructure:"house_address"  json:"houseAddress"`
+	OracleAddress string            `mapstructure:"oracle_address" json:"oracleAddress"`
+	Games         map[string]Game   `mapstructure:"games"          json:"games"`
+	Tokens        map[string]string `mapstructure:"tokens"         json:"tokens"`
+}
+
+// Load builds the registry of the network set by the network config, layering
+// the entries of contracts.file, or if absent contracts.<network>, over the
+// built-in defaults. The result is validated and becomes the active registry.
+func Load() (*Registry, error) {
+	var override Registry
+
+	network := viper.GetString("network")
+	if network == "" {
+		network = Mainnet
+	}
+
+	base, ok := defaults[network]
+	if !ok {
+		return nil, fmt.Errorf("unknown network '%s'", network)
+	}
+
+	src := viper.Sub("contracts")
+	if file := viper.GetString("contracts.file"); file != "" {
+		src = viper.New()
+		src.SetConfigFile(file)
+		src.SetConfigType(strings.TrimPrefix(filepath.Ext(file), "."))
+		if err := src.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read contracts file - %s", err.Error())
+		}
+	}
+
+	if src != nil && src.IsSet(network) {
+		if err := src.UnmarshalKey(network, &override); err != nil {
+			return nil, fmt.Errorf("failed to parse %s contracts - %s", network, err.Error())
+		}
+	}
+
+	reg := merge(base, override)
+	reg.Network = network
+
+	if err := reg.Validate(); err != nil {
+		return nil, err
+	}
+
+	current = reg
+
+	return reg, nil
+}
+
+// Current returns the registry set by the last successful Load, nil before.
+func Current() *Registry {
+	return current
+}
+
+func merge(base, override Registry) *Registry {
+	reg := &Registry{
+		HouseAddress:  base.HouseAddress,
+		OracleAddress: base.OracleAddress,
+		Games:         make(map[string]Game),
+		Tokens:        make(map[string]string),
+	}
+
+	if override.HouseAddress != "" {
+		reg.HouseAddress = override.HouseAddress
+	}
+	if override.OracleAddress != "" {
+		reg.OracleAddress = override.OracleAddress
+	}
+
+	for _, games := range []map[string]Game{base.Games, override.Games} {
+		for name, g := range games {
+			reg.Games[name] = g
+		}
+	}
+
+	// token names are case insensitive in config files
+	for _, tokens := range []map[string]string{base.Tokens, override.Tokens} {
+		for name, id := range tokens {
+			reg.Tokens[strings.ToUpper(name)] = id
+		}
+	}
+
+	return reg
+}
+
+// Validate checks that every address belongs to the network of the registry
+// and that every game contract and token id is well formed.
+func (r *Registry) Validate() error {
+	prefix := erg.MainnetPrefix
+	if r.Network == Testnet {
+		prefix = erg.TestnetPrefix
+	}
+
+	for name, addr := range map[string]string{"house_address": r.HouseAddress, "oracle_address": r.OracleAddress} {
+		if addr == "" {
+			return fmt.Errorf("%s contracts %s is missing", r.Network, name)
+		}
+		a, err := erg.DecodeAddress(addr)
+		if err != nil {
+			return fmt.Errorf("%s contracts %s '%s' is invalid - %s", r.Network, name, addr, err.Error())
+		}
+		if a.Network != prefix {
+			return fmt.Errorf("%s contracts %s '%s' is not a %s address", r.Network, name, addr, r.Network)
+		}
+	}
+
+	if _, ok := r.Games[Roulette]; !ok {
+		return fmt.Errorf("%s contracts are missing the %s game", r.Network, Roulette)
+	}
+
+	for name, g := range r.Games {
+		if _, err := hex.DecodeString(g.ErgoTree); err != nil || g.ErgoTree == "" {
+			return fmt.Errorf("%s contracts game %s has an invalid ergo_tree", r.Network, name)
+		}
+	}
+
+	for name, id := range r.Tokens {
+		if _, err := hex.DecodeString(id); err != nil || len(id) != 64 {
+			return fmt.Errorf("%s contracts token %s has invalid id '%s'", r.Network, name, id)
+		}
+	}
+
+	return nil
+}
+
+// GameErgoTree returns the contract of a game, empty if the game is unknown.
+func (r *Registry) GameErgoTree(game string) string {
+	return r.Games[game].ErgoTree
+}
+
+// GameRefundable reports whether the contract of a game lets bets be refunded.
+func (r *Registry) GameRefundable(game string) bool {
+	return r.Games[game].Refundable
+}
+
+// TokenName returns the name of a token by id, the id itself if the token is
+// unknown.
+func (r *Registry) TokenName(id string) string {
+	for name, tokenId := range r.Tokens {
+		if tokenId == id {
+			return name
+		}
+	}
+	return id
+}
+
+// TokenId returns the id of a token by name, empty if the token is unknown.
+func (r *Registry) TokenId(name string) string {
+	return r.Tokens[strings.ToUpper(name)]
+}
@@ -0,0 +1,46 @@
+package contracts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMainnetDefaults(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	reg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, Mainnet, reg.Network)
+	assert.Equal(t, "afd0d6cb61e86d15f2a0adc1e7e23df532ba3ff35f8ba88bed16729cae933032", reg.TokenId("owl"))
+	assert.NotEmpty(t, reg.GameErgoTree(Roulette))
+	assert.False(t, reg.GameRefundable(Roulette), "the mainnet contract has no refund path")
+	assert.Equal(t, reg, Current())
+}
+
+func TestLoadTestnet(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("network", Testnet)
+	_, err := Load()
+	assert.Error(t, err, "testnet has no defaults")
+
+	// mainnet addresses are rejected on testnet
+	file := filepath.Join(t.TempDir(), "contracts.yaml")
+	os.WriteFile(file, []byte(`
+testnet:
+  house_address: "ofgUTY7c693MfaVxfuZ1YhG7RQuQCLqa7mqFHkkZcpo9r5oPmmXaemS3raHAzfP4MXXc7DiueGDFsrZ5Hp3ZK"
+  oracle_address: "4FC5xSYb7zfRdUhm6oRmE11P2GJqSMY8UARPbHkmXEq6hTinXq4XNWdJs73BEV44MdmJ49Qo"
+  games:
+    roulette:
+      ergo_tree: "100104c801d191a37300"
+`), 0600)
+	viper.Set("contracts.file", file)
+	_, err = Load()
+	assert.ErrorContains(t, err, "is not a testnet address")
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	// admin roles, each one is allowed everything the previous ones are
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+
+	apiKeyHeader = "X-API-Key"
+)
+
+var (
+	roleLevels = map[string]int{
+		RoleReadOnly: 1,
+		RoleOperator: 2,
+		RoleAdmin:    3,
+	}
+
+	ErrInvalidAdminRole = errors.New("admin role must be one of read-only, operator or admin")
+)
+
+// AdminKey is an API key allowed to call the admin routes. Keys are given
+// either in plain text or as the hex encoded sha256 hash of the key.
+type AdminKey struct {
+	Name      string `mapstructure:"name"`
+	Key       string `mapstructure:"key"`
+	KeySha256 string `mapstructure:"key_sha256"`
+	Role      string `mapstructure:"role"`
+}
+
+// AdminCert grants a role to the client certificates with a common name,
+// which requires the admin listener to verify client certificates.
+type AdminCert struct {
+	CommonName string `mapstructure:"common_name"`
+	Role       string `mapstructure:"role"`
+}
+
+type adminIdentity struct {
+	name string
+	role string
+}
+
+// AdminAuth authenticates and authorizes callers of the admin routes and
+// writes an audit log entry for every call.
+type AdminAuth struct {
+	keys  map[[sha256.Size]byte]adminIdentity
+	certs map[string]adminIdentity
+	audit *zap.Logger
+}
+
+// NewAdminAuth loads the api keys in admin.api_keys and the client
+// certificates in admin.client_certs.
+func NewAdminAuth() (*AdminAuth, error) {
+	var keys []AdminKey
+	var certs []AdminCert
+
+	if err := viper.UnmarshalKey("admin.api_keys", &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse admin.api_keys - %s", err.Error())
+	}
+	if err := viper.UnmarshalKey("admin.client_certs", &certs); err != nil {
+		return nil, fmt.Errorf("failed to parse admin.client_certs - %s", err.Error())
+	}
+
+	a := &AdminAuth{
+		keys:  make(map[[sha256.Size]byte]adminIdentity),
+		certs: make(map[string]adminIdentity),
+		audit: zap.L().Named("audit"),
+	}
+
+	for _, k := range keys {
+		if _, ok := roleLevels[k.Role]; !ok {
+			return nil, fmt.Errorf("api key '%s' - %w", k.Name, ErrInvalidAdminRole)
+		}
+
+		var sum [sha256.Size]byte
+		switch {
+		case k.KeySha256 != "":
+			b, err := hex.DecodeString(k.KeySha256)
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("api key '%s' has an invalid sha256 hash", k.Name)
+			}
+			copy(sum[:], b)
+		case k.Key != "":
+			sum = sha256.Sum256([]byte(k.Key))
+		default:
+			return nil, fmt.Errorf("api key '%s' has neither a key nor a key_sha256", k.Name)
+		}
+		a.keys[sum] = adminIdentity{name: k.Name, role: k.Role}
+	}
+
+	for _, c := range certs {
+		if _, ok := roleLevels[c.Role]; !ok {
+			return nil, fmt.Errorf("client cert '%s' - %w", c.CommonName, ErrInvalidAdminRole)
+		}
+		a.certs[c.CommonName] = adminIdentity{name: "cert:" + c.CommonName, role: c.Role}
+	}
+
+	if len(a.keys) == 0 && len(a.certs) == 0 {
+		zap.L().Warn("no admin api keys or client certs configured, all admin routes will be refused")
+	}
+
+	return a, nil
+}
+
+// identify returns who made the request, a verified client certificate takes
+// precedence over an api key.
+func (a *AdminAuth) identify(req *http.Request) (adminIdentity, bool) {
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		if id, ok := a.certs[req.TLS.VerifiedChains[0][0].Subject.CommonName]; ok {
+			return id, true
+		}
+	}
+
+	key := req.Header.Get(apiKeyHeader)
+	if key == "" {
+		key = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return adminIdentity{}, false
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	for k, id := range a.keys {
+		if subtle.ConstantTimeCompare(k[:], sum[:]) == 1 {
+			return id, true
+		}
+	}
+
+	return adminIdentity{}, false
+}
+
+// Require only passes requests on to handler if the caller has at least the
+// given role. Every call, allowed or not, is written to the audit log.
+func (a *AdminAuth) Require(role string, handler httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		id, ok := a.identify(req)
+		switch {
+		case !ok:
+			rec.Header().Set(HeaderContentType, ContentTypeJSON)
+			rec.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(rec, "{\"error\": \"missing or invalid api key\"}")
+		case roleLevels[id.role] < roleLevels[role]:
+			rec.Header().Set(HeaderContentType, ContentTypeJSON)
+			rec.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(rec, "{\"error\": \"role '%s' is required\"}", role)
+		default:
+			handler(rec, req, params)
+		}
+
+		// X-Forwarded-For is set by the client unless a proxy overwrites it,
+		// so it never replaces the address the call came from
+		ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+
+		a.audit.Info("admin call",
+			zap.String("caller", id.name),
+			zap.String("role", id.role),
+			zap.String("required_role", role),
+			zap.String("method", req.Method),
+			zap.String("url_path", req.URL.Path),
+			zap.String("query", req.URL.RawQuery),
+			zap.String("ip_addr", ip),
+			zap.String("forwarded_for", req.Header.Get("X-Forwarded-For")),
+			zap.Int("status", rec.status),
+			zap.Int64("durationMs", time.Since(start).Milliseconds()),
+		)
+	}
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAdminAuthRequire(t *testing.T) {
+	viper.Set("admin.api_keys", []map[string]interface{}{
+		{"name": "viewer", "key": "viewer-key", "role": RoleReadOnly},
+		// sha256 of "operator-key"
+		{"name": "ops", "key_sha256": "c9736463f555cdb7d2a78cfd7aa8b8c4f09d906d78f8dab9228eda30a28c2818", "role": RoleOperator},
+		{"name": "root", "key": "admin-key", "role": RoleAdmin},
+	})
+	defer viper.Set("admin.api_keys", nil)
+
+	admin, err := NewAdminAuth()
+	require.NoError(t, err)
+
+	ok := func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	tests := []struct {
+		name   string
+		role   string
+		header string
+		key    string
+		status int
+	}{
+		{"no key", RoleReadOnly, "", "", http.StatusUnauthorized},
+		{"unknown key", RoleReadOnly, apiKeyHeader, "nope", http.StatusUnauthorized},
+		{"read-only reads", RoleReadOnly, apiKeyHeader, "viewer-key", http.StatusOK},
+		{"read-only operates", RoleOperator, apiKeyHeader, "viewer-key", http.StatusForbidden},
+		{"hashed key operates", RoleOperator, apiKeyHeader, "operator-key", http.StatusOK},
+		{"operator administers", RoleAdmin, apiKeyHeader, "operator-key", http.StatusForbidden},
+		{"admin operates", RoleOperator, "Authorization", "Bearer admin-key", http.StatusOK},
+		{"admin administers", RoleAdmin, apiKeyHeader, "admin-key", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/info", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			admin.Require(tt.role, ok)(w, req, nil)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestNewAdminAuthInvalidRole(t *testing.T) {
+	viper.Set("admin.api_keys", []map[string]interface{}{
+		{"name": "ops", "key": "key", "role": "superuser"},
+	})
+	defer viper.Set("admin.api_keys", nil)
+
+	_, err := NewAdminAuth()
+	assert.ErrorIs(t, err, ErrInvalidAdminRole)
+}
+
+func TestAdminAuthAuditLog(t *testing.T) {
+	viper.Set("admin.api_keys", []map[string]interface{}{
+		{"name": "root", "key": "admin-key", "role": RoleAdmin},
+	})
+	defer viper.Set("admin.api_keys", nil)
+
+	admin, err := NewAdminAuth()
+	require.NoError(t, err)
+	core, logs := observer.New(zap.InfoLevel)
+	admin.audit = zap.New(core)
+
+	ok := func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// the forwarded address is whatever the client claims, it is logged next
+	// to the address the call came from
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/info", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set(apiKeyHeader, "admin-key")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	admin.Require(RoleAdmin, ok)(httptest.NewRecorder(), req, nil)
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "203.0.113.7", fields["ip_addr"])
+	assert.Equal(t, "10.0.0.1", fields["forwarded_for"])
+	assert.Equal(t, "root", fields["caller"])
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	sessionHeader = "owl-session-id"
+)
+
+type challengeResponse struct {
+	WalletAddr string `json:"walletAddr"`
+	Nonce      string `json:"nonce"`
+	Message    string `json:"message"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
+
+type loginRequest struct {
+	WalletAddr string `json:"walletAddr"`
+	Nonce      string `json:"nonce"`
+	Signature  string `json:"signature"`
+}
+
+type loginResponse struct {
+	SessionId  string `json:"sessionId"`
+	WalletAddr string `json:"walletAddr"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
+
+// loginMessage is the message a player signs with the key of their wallet
+// address to log in.
+func loginMessage(walletAddr, nonce string) string {
+	return fmt.Sprintf("nightowl:login:%s:%s", walletAddr, nonce)
+}
+
+// AuthChallenge issues a single use nonce the player signs to log in
+//
+//     curl -X POST "http://host:port/api/v1/auth/challenge?walletAddr=9f..."
+//
+func AuthChallenge(rdb redis.UniversalClient) httprouter.Handle {
+	sessions := state.NewSessionStore(context.Background(), rdb)
+
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+
+		walletAddr := req.URL.Query().Get("walletAddr")
+		addr, err := erg.DecodeAddress(walletAddr)
+		if err != nil || addr.Type != erg.P2PKType {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "{\"error\": \"'walletAddr' must be a p2pk wallet address\"}")
+			return
+		}
+
+		ttl := time.Duration(config.Current().Auth.ChallengeTTL) * time.Second
+		nonce, err := sessions.CreateChallenge(walletAddr, ttl)
+		if err != nil {
+			log.Error("failed to create login challenge", zap.Error(err), zap.String("wallet_addr", walletAddr))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to create login challenge\"}")
+			return
+		}
+
+		json.NewEncoder(w).Encode(challengeResponse{
+			WalletAddr: walletAddr,
+			Nonce:      nonce,
+			Message:    loginMessage(walletAddr, nonce),
+			ExpiresAt:  time.Now().Add(ttl).Unix(),
+		})
+	}
+}
+
+// Login verifies the signature of a challenge and starts a session for the
+// wallet address, its id goes into the owl-session-id header of later requests
+//
+//     curl -X POST http://host:port/api/v1/auth/login -d '{"walletAddr": "9f...", "nonce": "...", "signature": "<hex>"}'
+//
+func Login(rdb redis.UniversalClient) httprouter.Handle {
+	sessions := state.NewSessionStore(context.Background(), rdb)
+
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		var body loginRequest
+		log := zap.L()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+
+		err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 4096)).Decode(&body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "{\"error\": \"invalid login request\"}")
+			return
+		}
+
+		sig, err := hex.DecodeString(body.Signature)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "{\"error\": \"'signature' must be hex encoded\"}")
+			return
+		}
+
+		walletAddr, err := sessions.TakeChallenge(body.Nonce)
+		switch {
+		case err == state.ErrChallengeNotFound || (err == nil && walletAddr != body.WalletAddr):
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "{\"error\": \"challenge not found or expired\"}")
+			return
+		case err != nil:
+			log.Error("failed to get login challenge", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to log in please try again\"}")
+			return
+		}
+
+		err = erg.VerifyAddress(walletAddr, []byte(loginMessage(walletAddr, body.Nonce)), sig)
+		if err != nil {
+			log.Debug("login signature rejected", zap.Error(err), zap.String("wallet_addr", walletAddr))
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "{\"error\": \"invalid signature\"}")
+			return
+		}
+
+		session, err := sessions.Create(walletAddr, time.Duration(config.Current().Auth.SessionTTL)*time.Second)
+		if err != nil {
+			log.Error("failed to create session", zap.Error(err), zap.String("wallet_addr", walletAddr))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to log in please try again\"}")
+			return
+		}
+
+		log.Info("player logged in", zap.String("wallet_addr", walletAddr))
+
+		json.NewEncoder(w).Encode(loginResponse{
+			SessionId:  session.Id,
+			WalletAddr: session.Address,
+			ExpiresAt:  session.ExpiresAt,
+		})
+	}
+}
+
+// Logout ends the session given in the owl-session-id header
+//
+//     curl -X DELETE -H "owl-session-id: ..." http://host:port/api/v1/auth/session
+//
+func Logout(rdb redis.UniversalClient) httprouter.Handle {
+	sessions := state.NewSessionStore(context.Background(), rdb)
+
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		err := sessions.Delete(req.Header.Get(sessionHeader))
+		if err != nil {
+			log.Error("failed to delete session", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to log out please try again\"}")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fmt.Fprint(w, "")
+	}
+}
+
+// RequirePlayer only passes requests on to handler whose session belongs to
+// the wallet address of the request, given either as the walletAddr route
+// parameter or query parameter.
+func RequirePlayer(rdb redis.UniversalClient, handler httprouter.Handle) httprouter.Handle {
+	sessions := state.NewSessionStore(context.Background(), rdb)
+
+	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		log := zap.L()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		session, err := sessions.Get(req.Header.Get(sessionHeader))
+		switch {
+		case err == state.ErrSessionNotFound:
+			w.Header().Set(HeaderContentType, ContentTypeJSON)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "{\"error\": \"session not found or expired please log in\"}")
+			return
+		case err != nil:
+			log.Error("failed to get session", zap.Error(err))
+			w.Header().Set(HeaderContentType, ContentTypeJSON)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to get session please try again\"}")
+			return
+		}
+
+		walletAddr := params.ByName("walletAddr")
+		if walletAddr == "" {
+			walletAddr = req.URL.Query().Get("walletAddr")
+		}
+		if walletAddr != session.Address {
+			log.Debug("session used for another wallet address",
+				zap.String("wallet_addr", walletAddr),
+				zap.String("session_addr", session.Address),
+			)
+			w.Header().Set(HeaderContentType, ContentTypeJSON)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "{\"error\": \"session does not belong to the wallet address\"}")
+			return
+		}
+
+		handler(w, req, params)
+	}
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWallet(t *testing.T) (*erg.SecretKey, string) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	require.NoError(t, err)
+
+	sk, err := erg.NewSecretKey(secret)
+	require.NoError(t, err)
+
+	return sk, sk.Address(erg.MainnetPrefix).String()
+}
+
+func challenge(t *testing.T, rdb redis.UniversalClient, walletAddr string) challengeResponse {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/challenge?walletAddr="+walletAddr, nil)
+	w := httptest.NewRecorder()
+	AuthChallenge(rdb)(w, req, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var c challengeResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&c))
+	return c
+}
+
+func login(rdb redis.UniversalClient, body loginRequest) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	Login(rdb)(w, req, nil)
+	return w
+}
+
+func TestLogin(t *testing.T) {
+	viper.Set("auth.challenge_ttl", 60)
+	viper.Set("auth.session_ttl", 3600)
+	defer viper.Set("auth", nil)
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	sk, walletAddr := newTestWallet(t)
+	signed := func(c challengeResponse) loginRequest {
+		sig, err := sk.Sign([]byte(c.Message))
+		require.NoError(t, err)
+		return loginRequest{WalletAddr: walletAddr, Nonce: c.Nonce, Signature: hex.EncodeToString(sig)}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		w := login(rdb, signed(challenge(t, rdb, walletAddr)))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp loginResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, walletAddr, resp.WalletAddr)
+		assert.NotEmpty(t, resp.SessionId)
+	})
+
+	t.Run("expired challenge", func(t *testing.T) {
+		body := signed(challenge(t, rdb, walletAddr))
+		mr.FastForward(61 * time.Second)
+
+		w := login(rdb, body)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "challenge not found or expired")
+	})
+
+	t.Run("reused challenge", func(t *testing.T) {
+		body := signed(challenge(t, rdb, walletAddr))
+		require.Equal(t, http.StatusOK, login(rdb, body).Code)
+
+		w := login(rdb, body)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "challenge not found or expired")
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		other, _ := newTestWallet(t)
+		c := challenge(t, rdb, walletAddr)
+		sig, err := other.Sign([]byte(c.Message))
+		require.NoError(t, err)
+
+		w := login(rdb, loginRequest{WalletAddr: walletAddr, Nonce: c.Nonce, Signature: hex.EncodeToString(sig)})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid signature")
+
+		// the failed attempt used up the challenge
+		w = login(rdb, signed(c))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("challenge of another wallet", func(t *testing.T) {
+		_, otherAddr := newTestWallet(t)
+		body := signed(challenge(t, rdb, otherAddr))
+
+		w := login(rdb, body)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestRequirePlayer(t *testing.T) {
+	viper.Set("auth.challenge_ttl", 60)
+	viper.Set("auth.session_ttl", 3600)
+	defer viper.Set("auth", nil)
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	sk, walletAddr := newTestWallet(t)
+	_, otherAddr := newTestWallet(t)
+
+	c := challenge(t, rdb, walletAddr)
+	sig, err := sk.Sign([]byte(c.Message))
+	require.NoError(t, err)
+	w := login(rdb, loginRequest{WalletAddr: walletAddr, Nonce: c.Nonce, Signature: hex.EncodeToString(sig)})
+	require.Equal(t, http.StatusOK, w.Code)
+	var session loginResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&session))
+
+	ok := func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	tests := []struct {
+		name       string
+		sessionId  string
+		walletAddr string
+		status     int
+	}{
+		{"own session", session.SessionId, walletAddr, http.StatusOK},
+		{"missing session", "", walletAddr, http.StatusUnauthorized},
+		{"unknown session", "nope", walletAddr, http.StatusUnauthorized},
+		{"foreign session", session.SessionId, otherAddr, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/bets?walletAddr="+tt.walletAddr, nil)
+			if tt.sessionId != "" {
+				req.Header.Set(sessionHeader, tt.sessionId)
+			}
+			w := httptest.NewRecorder()
+
+			RequirePlayer(rdb, ok)(w, req, nil)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	// sessions end with their ttl
+	mr.FastForward(3601 * time.Second)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/bets?walletAddr="+walletAddr, nil)
+	req.Header.Set(sessionHeader, session.SessionId)
+	w = httptest.NewRecorder()
+	RequirePlayer(rdb, ok)(w, req, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
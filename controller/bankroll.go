@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/services/bankroll"
+	"go.uber.org/zap"
+)
+
+// Bankroll returns the house balances, pending exposure, limits and pause
+// state last computed by the payout service
+//
+//     curl http://host:port/api/v1/bankroll
+//
+func Bankroll(rdb redis.UniversalClient) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+
+		st, err := bankroll.LoadState(context.Background(), rdb)
+		if err != nil {
+			log.Error("failed to get bankroll state", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to get bankroll state\"}")
+			return
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		json.NewEncoder(w).Encode(st)
+	}
+}
+
+// SetBankrollPause manually pauses or resumes accepting and settling bets,
+// parameters which are left out keep their current value
+//
+//     curl -X PUT "http://host:port/api/v1/bankroll/pause?accept=true&settle=false"
+//
+func SetBankrollPause(rdb redis.UniversalClient) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		var accept, settle *bool
+		log := zap.L()
+
+		query := req.URL.Query()
+		for name, flag := range map[string]**bool{"accept": &accept, "settle": &settle} {
+			if !query.Has(name) {
+				continue
+			}
+			val, err := strconv.ParseBool(query.Get(name))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "{\"error\": \"'%s' must be true or false\"}", name)
+				return
+			}
+			*flag = &val
+		}
+
+		if accept == nil && settle == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "{\"error\": \"one of 'accept' or 'settle' is required\"}")
+			return
+		}
+
+		err := bankroll.SetPause(context.Background(), rdb, accept, settle)
+		if err != nil {
+			log.Error("failed to set bankroll pause", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to set bankroll pause\"}")
+			return
+		}
+
+		log.Info("bankroll pause flags updated", zap.Boolp("accept", accept), zap.Boolp("settle", settle))
+
+		w.WriteHeader(http.StatusNoContent)
+		fmt.Fprint(w, "")
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+// PendingBets lists the bets waiting to be resolved by the payout service
+//
+//     curl http://host:port/api/v1/bets/pending
+//
+func PendingBets(rdb redis.UniversalClient) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+
+		bets, err := state.NewBetQueue(context.Background(), rdb).Pending()
+		if err != nil {
+			log.Error("failed to get pending bets", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to get pending bets\"}")
+			return
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		json.NewEncoder(w).Encode(bets)
+	}
+}
+
+// DeadLetterBets lists the bets which failed too many times and wait for an
+// operator to retry them
+//
+//     curl http://host:port/api/v1/bets/deadletter
+//
+func DeadLetterBets(rdb redis.UniversalClient) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+
+		bets, err := state.NewBetQueue(context.Background(), rdb).DeadLetters()
+		if err != nil {
+			log.Error("failed to get dead letter bets", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to get dead letter bets\"}")
+			return
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		json.NewEncoder(w).Encode(bets)
+	}
+}
+
+// RetryBet moves a dead lettered bet back to the pending queue
+//
+//     curl -X POST http://host:port/api/v1/bets/deadletter/<boxId>/retry
+//
+func RetryBet(rdb redis.UniversalClient) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		log := zap.L()
+		start := time.Now()
+		boxId := params.ByName("boxId")
+
+		err := state.NewBetQueue(context.Background(), rdb).Retry(boxId)
+		switch {
+		case err == state.ErrBetNotQueued:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "{\"error\": \"bet %s is not in the dead letter set\"}", boxId)
+			return
+		case err != nil:
+			log.Error("failed to retry bet", zap.Error(err), zap.String("erg_utxo_box_id", boxId))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to retry bet\"}")
+			return
+		}
+
+		log.Info("dead letter bet queued for retry",
+			zap.Int64("durationMs", time.Since(start).Milliseconds()),
+			zap.String("erg_utxo_box_id", boxId),
+		)
+
+		w.WriteHeader(http.StatusNoContent)
+		fmt.Fprint(w, "")
+	}
+}
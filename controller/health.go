@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/erg"
+)
+
+const (
+	statusOk   = "ok"
+	statusFail = "fail"
+)
+
+// HealthCheck reports whether a dependency of a service can be used.
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+type checkResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// AddCheck registers a check run by /readyz.
+func (r *Router) AddCheck(name string, check HealthCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, namedCheck{name: name, check: check})
+}
+
+// Healthz tells that the process is alive and serving requests
+//
+//     curl http://host:port/healthz
+//
+func Healthz() httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		json.NewEncoder(w).Encode(healthResponse{Status: statusOk})
+	}
+}
+
+// Readyz runs every registered check and only answers 200 when all of them
+// pass and the service was marked ready
+//
+//     curl http://host:port/readyz
+//
+func (r *Router) Readyz() httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		r.mu.RLock()
+		ready := r.ready
+		checks := r.checks
+		r.mu.RUnlock()
+
+		timeout := time.Duration(config.Current().Health.Timeout) * time.Second
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		resp := healthResponse{
+			Status: statusOk,
+			Checks: make(map[string]checkResult, len(checks)+1),
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, c := range checks {
+			wg.Add(1)
+			go func(c namedCheck) {
+				defer wg.Done()
+				res := runCheck(ctx, c.check)
+				mu.Lock()
+				resp.Checks[c.name] = res
+				mu.Unlock()
+			}(c)
+		}
+		wg.Wait()
+
+		resp.Checks["started"] = checkResult{Status: statusOk}
+		if !ready {
+			resp.Checks["started"] = checkResult{Status: statusFail, Error: "service is still starting"}
+		}
+
+		for _, res := range resp.Checks {
+			if res.Status != statusOk {
+				resp.Status = statusFail
+			}
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		if resp.Status != statusOk {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func runCheck(ctx context.Context, check HealthCheck) checkResult {
+	start := time.Now()
+	err := check(ctx)
+
+	res := checkResult{
+		Status:     statusOk,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		res.Status = statusFail
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// RedisCheck pings the redis db.
+func RedisCheck(rdb redis.UniversalClient) HealthCheck {
+	return func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	}
+}
+
+// NATSCheck requires the nats connection to be connected.
+func NATSCheck(nc *nats.Conn) HealthCheck {
+	return func(_ context.Context) error {
+		if !nc.IsConnected() {
+			return fmt.Errorf("nats connection is %s", nc.Status().String())
+		}
+		return nil
+	}
+}
+
+// NodeCheck requires the ergo node to be reachable and no more than maxLag
+// blocks behind its headers and peers.
+func NodeCheck(node *erg.ErgNode, maxLag int) HealthCheck {
+	return func(ctx context.Context) error {
+		info, err := node.WithContext(ctx).GetNodeInfo()
+		if err != nil {
+			return err
+		}
+		return nodeSynced(info, maxLag)
+	}
+}
+
+func nodeSynced(info erg.NodeInfo, maxLag int) error {
+	if info.FullHeight == 0 {
+		return errors.New("node has not applied any full block yet")
+	}
+	if lag := info.HeadersHeight - info.FullHeight; lag > maxLag {
+		return fmt.Errorf("node is %d blocks behind its headers", lag)
+	}
+	if lag := info.MaxPeerHeight - info.FullHeight; lag > maxLag {
+		return fmt.Errorf("node is %d blocks behind its peers", lag)
+	}
+	return nil
+}
+
+// HeartbeatCheck requires last to have happened within maxAge, what names
+// the event in the error.
+func HeartbeatCheck(what string, last func() time.Time, maxAge time.Duration) HealthCheck {
+	return func(_ context.Context) error {
+		t := last()
+		if t.IsZero() {
+			return fmt.Errorf("no %s yet", what)
+		}
+		if age := time.Since(t); age > maxAge {
+			return fmt.Errorf("last %s was %s ago", what, age.Truncate(time.Second))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeSynced(t *testing.T) {
+	tests := []struct {
+		name   string
+		info   erg.NodeInfo
+		synced bool
+	}{
+		{"synced", erg.NodeInfo{FullHeight: 800000, HeadersHeight: 800000, MaxPeerHeight: 800001}, true},
+		{"no full blocks", erg.NodeInfo{HeadersHeight: 800000}, false},
+		{"behind headers", erg.NodeInfo{FullHeight: 799000, HeadersHeight: 800000}, false},
+		{"behind peers", erg.NodeInfo{FullHeight: 800000, HeadersHeight: 800000, MaxPeerHeight: 800010}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := nodeSynced(tt.info, 2)
+			assert.Equal(t, tt.synced, err == nil, err)
+		})
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	viper.Set("health.timeout", 1)
+	defer viper.Set("health.timeout", nil)
+
+	r := &Router{}
+	r.AddCheck("redis", func(context.Context) error { return nil })
+
+	get := func() (int, healthResponse) {
+		var resp healthResponse
+		w := httptest.NewRecorder()
+		r.Readyz()(w, httptest.NewRequest(http.MethodGet, "/readyz", nil), nil)
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return w.Code, resp
+	}
+
+	code, resp := get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, statusFail, resp.Checks["started"].Status)
+	assert.Equal(t, statusOk, resp.Checks["redis"].Status)
+
+	r.Ready()
+	code, resp = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, statusOk, resp.Status)
+
+	r.AddCheck("nats", func(context.Context) error { return errors.New("nats connection is CLOSED") })
+	code, resp = get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "nats connection is CLOSED", resp.Checks["nats"].Error)
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/buildinfo"
+	"github.com/nightowlcasino/nightowl/contracts"
+)
+
+// Info returns the build info of the service along with the active network
+// and contract registry when one was loaded
+//
+//     curl http://host:port/api/v1/info
+//
+func Info() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		info := make(map[string]interface{})
+
+		data, _ := json.Marshal(buildinfo.Info)
+		json.Unmarshal(data, &info)
+
+		if reg := contracts.Current(); reg != nil {
+			info["network"] = reg.Network
+			info["contracts"] = reg
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		json.NewEncoder(w).Encode(info)
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,18 +11,21 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/julienschmidt/httprouter"
 	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/services/notif"
+	"github.com/nightowlcasino/nightowl/state"
 	"go.uber.org/zap"
 )
 
 var (
-	notifTypes = []string{"swap","roulette"}
+	notifTypes = []string{"swap","roulette","refund"}
 )
 
-func SendNotifs(nc *nats.Conn, rdb *redis.Client) httprouter.Handle {
+func SendNotifs(nc *nats.Conn, rdb redis.UniversalClient) httprouter.Handle {
 	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		log := zap.L()
 		start := time.Now()
-		var count, failedCount int
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
@@ -33,45 +37,17 @@ func SendNotifs(nc *nats.Conn, rdb *redis.Client) httprouter.Handle {
 			zap.String("wallet_addr", walletAddr),
 		)
 
-		// check if there are any pending notifications to send to the user from the redis db
-		var errs *multierror.Error
-		for _, typ := range notifTypes {
-			match := fmt.Sprintf("notif:%s:%s:*", typ, walletAddr)
-			iter := rdb.Scan(context.Background(), 0, match, 0).Iterator()
-			for iter.Next(context.Background()) {
-				n, err := rdb.Get(context.Background(), iter.Val()).Result()
-				if err != nil {
-					log.Error("failed to get notification from redis db",
-						zap.Error(err),
-						zap.String("redis_key", iter.Val()),
-					)
-					errs = multierror.Append(err, errs.Errors...)
-				} else {
-					// send notification to nats queue for user to consume
-					err = nc.Publish("notif.payouts", []byte(n))
-					if err != nil {
-						log.Error("failed to send notification to nats queue",
-							zap.Error(err),
-							zap.String("wallet_addr", walletAddr),
-						)
-						errs = multierror.Append(err, errs.Errors...)
-						failedCount++
-					} else {
-						count++
-					}
-				}
-			}
-			if err := iter.Err(); err != nil {
-				log.Error("query failed to get notification from redis db",
-					zap.Error(err),
-					zap.String("redis_key", match),
-					zap.String("wallet_addr", walletAddr),
-				)
-				errs = multierror.Append(err, errs.Errors...)
-			}
+		// with jetstream the broker redelivers notifications until they are
+		// acked, so the player only needs to know which consumer to pull from
+		if notif.JetStreamEnabled() {
+			sendStreamConsumer(w, nc, walletAddr, start)
+			return
 		}
 
-		if errs.ErrorOrNil() != nil {
+		// check if there are any pending notifications to send to the user from the redis db
+		count, failedCount, err := replayNotifs(nc, rdb, walletAddr)
+
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "{\"error\": \"failed to send some or all notification(s) to wallet address %s please try again\"}", walletAddr)
 			log.Error("failed to send notification(s)",
@@ -91,4 +67,100 @@ func SendNotifs(nc *nats.Conn, rdb *redis.Client) httprouter.Handle {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprint(w, "{}")
 	}
-}
\ No newline at end of file
+}
+
+// replayNotifs sends the notifications stored in redis for a wallet address
+// back through the notif service, which removes them once the player acks.
+func replayNotifs(nc *nats.Conn, rdb redis.UniversalClient, walletAddr string) (count, failedCount int, err error) {
+	log := zap.L()
+
+	var errs *multierror.Error
+	for _, typ := range notifTypes {
+		match := state.Key(fmt.Sprintf("notif:%s:%s:*", typ, walletAddr))
+		err := state.ScanKeys(context.Background(), rdb, match, func(key string) error {
+			n, err := rdb.Get(context.Background(), key).Result()
+			if err != nil {
+				log.Error("failed to get notification from redis db",
+					zap.Error(err),
+					zap.String("redis_key", key),
+				)
+				errs = multierror.Append(err, errs.Errors...)
+				return nil
+			}
+
+			// send notification to nats queue for user to consume
+			err = nc.Publish(broker.Subject(config.Current().NATS.NotifPayoutsSubj), []byte(n))
+			if err != nil {
+				log.Error("failed to send notification to nats queue",
+					zap.Error(err),
+					zap.String("wallet_addr", walletAddr),
+				)
+				errs = multierror.Append(err, errs.Errors...)
+				failedCount++
+			} else {
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error("query failed to get notification from redis db",
+				zap.Error(err),
+				zap.String("redis_key", match),
+				zap.String("wallet_addr", walletAddr),
+			)
+			errs = multierror.Append(err, errs.Errors...)
+		}
+	}
+
+	return count, failedCount, errs.ErrorOrNil()
+}
+
+type streamConsumer struct {
+	Stream   string `json:"stream"`
+	Consumer string `json:"consumer"`
+	Subject  string `json:"subject"`
+	Pending  uint64 `json:"pending"`
+}
+
+func sendStreamConsumer(w http.ResponseWriter, nc *nats.Conn, walletAddr string, start time.Time) {
+	log := zap.L()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Error("failed to create jetstream context", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "{\"error\": \"notifications are unavailable please try again\"}")
+		return
+	}
+
+	info, err := notif.EnsureConsumer(js, walletAddr)
+	if err != nil {
+		log.Error("failed to get notification consumer", zap.Error(err), zap.String("wallet_addr", walletAddr))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "{\"error\": \"failed to get notifications of wallet address %s please try again\"}", walletAddr)
+		return
+	}
+
+	resp, err := json.Marshal(streamConsumer{
+		Stream:   config.Current().NATS.JetStream.Stream,
+		Consumer: info.Name,
+		Subject:  notif.StreamSubject(walletAddr),
+		Pending:  info.NumPending + uint64(info.NumAckPending),
+	})
+	if err != nil {
+		log.Error("failed to marshal notification consumer", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "{\"error\": \"notifications are unavailable please try again\"}")
+		return
+	}
+
+	log.Info("notification consumer ready",
+		zap.Int64("durationMs", time.Since(start).Milliseconds()),
+		zap.String("wallet_addr", walletAddr),
+		zap.String("consumer", info.Name),
+	)
+
+	w.Header().Set(HeaderContentType, ContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
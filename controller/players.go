@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	maxPlayerBetsLimit = 100
+)
+
+type playerBetsResponse struct {
+	Bets   []state.PlayerBet `json:"bets"`
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+	More   bool              `json:"more"`
+}
+
+// PlayerBets lists the bets of a player newest first. Bets can be filtered by
+// game, by status or outcome (pending, won, lost, refunded, rejected) and by
+// the unix time range they were placed in
+//
+//     curl -H "owl-session-id: ..." "http://host:port/api/v1/players/9f.../bets?game=roulette&status=won&from=1660000000&to=1670000000&offset=0&limit=20"
+//
+func PlayerBets(rdb redis.UniversalClient) httprouter.Handle {
+	players := state.NewPlayerIndex(context.Background(), rdb)
+
+	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		log := zap.L()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+
+		walletAddr := params.ByName("walletAddr")
+		query := req.URL.Query()
+		q := state.PlayerBetQuery{
+			Game:   query.Get("game"),
+			Status: query.Get("status"),
+			Limit:  20,
+		}
+
+		for name, val := range map[string]*int{"offset": &q.Offset, "limit": &q.Limit} {
+			if !query.Has(name) {
+				continue
+			}
+			n, err := strconv.Atoi(query.Get(name))
+			if err != nil || n < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "{\"error\": \"'%s' must be a positive number\"}", name)
+				return
+			}
+			*val = n
+		}
+		if q.Limit == 0 || q.Limit > maxPlayerBetsLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": \"'limit' must be between 1 and %d\"}", maxPlayerBetsLimit)
+			return
+		}
+
+		for name, val := range map[string]*int64{"from": &q.From, "to": &q.To} {
+			if !query.Has(name) {
+				continue
+			}
+			n, err := strconv.ParseInt(query.Get(name), 10, 64)
+			if err != nil || n < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "{\"error\": \"'%s' must be a unix time\"}", name)
+				return
+			}
+			*val = n
+		}
+
+		bets, more, err := players.Bets(walletAddr, q)
+		if err != nil {
+			log.Error("failed to get bets of player", zap.Error(err), zap.String("wallet_addr", walletAddr))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to get bets please try again\"}")
+			return
+		}
+
+		json.NewEncoder(w).Encode(playerBetsResponse{
+			Bets:   bets,
+			Offset: q.Offset,
+			Limit:  q.Limit,
+			More:   more,
+		})
+	}
+}
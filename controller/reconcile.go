@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/services/reconcile"
+	"go.uber.org/zap"
+)
+
+// ReconcileReport returns the report of the last reconciliation of the
+// settled bets against the chain
+//
+//     curl http://host:port/api/v1/reconcile
+//
+func ReconcileReport(rdb redis.UniversalClient) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+
+		report, err := reconcile.LoadReport(context.Background(), rdb)
+		if err != nil {
+			log.Error("failed to get reconcile report", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to get reconcile report\"}")
+			return
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		json.NewEncoder(w).Encode(report)
+	}
+}
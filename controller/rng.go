@@ -9,6 +9,8 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/config"
 	"github.com/nightowlcasino/nightowl/services/rng"
 	"go.uber.org/zap"
 )
@@ -55,6 +57,13 @@ func SendRandNum(nc *nats.Conn) httprouter.Handle {
 			zap.String("session_id", sessionId),
 		)
 
+		if !config.Current().GameEnabled(game) {
+			w.Header().Set(HeaderContentType, ContentTypeJSON)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "{\"error\": \"game '%s' is disabled\"}", game)
+			return
+		}
+
 		go func(game, boxId, walletAddr string, nc *nats.Conn) {
 			timeout := time.NewTicker(120 * time.Second)
 			wake := make(chan bool, 1)
@@ -75,7 +84,7 @@ func SendRandNum(nc *nats.Conn) httprouter.Handle {
 					return
 				case <-wake:
 					if randNum, ok := rng.GetRandHashMap().Get(boxId); ok {
-						topic := fmt.Sprintf("%s.%s", game, walletAddr)
+						topic := broker.Subject(fmt.Sprintf("%s.%s", game, walletAddr))
 						nc.Publish(topic, []byte(randNum))
 						log.Info("successfully sent random number",
 							zap.Int64("durationMs",  time.Since(start).Milliseconds()),
@@ -124,7 +133,7 @@ func SendTestRandNum(nc *nats.Conn) httprouter.Handle {
 			go wait(10 * time.Second, wake)
 
 			for range wake {
-				topic := fmt.Sprintf("roulette.%s", walletAddr)
+				topic := broker.Subject(fmt.Sprintf("roulette.%s", walletAddr))
 				nc.Publish(topic, []byte(randNum))
 				log.Info("successfully sent random number",
 					zap.Int64("durationMs", time.Since(start).Milliseconds()),
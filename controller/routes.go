@@ -1,31 +1,110 @@
 package controller
 
 import (
-	"encoding/json"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 
 	"github.com/didip/tollbooth"
 	"github.com/didip/tollbooth/limiter"
 	"github.com/go-redis/redis/v9"
 	"github.com/julienschmidt/httprouter"
 	"github.com/nats-io/nats.go"
-	"github.com/nightowlcasino/nightowl/buildinfo"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/metrics"
 	"go.uber.org/zap"
 )
 
 type Router struct {
 	http.Handler
 
-	ready bool
+	mu     sync.RWMutex
+	ready  bool
+	checks []namedCheck
 }
 
+// Ready marks the service as started, /readyz fails until then.
 func (r *Router) Ready() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.ready = true
 }
 
-func NewRouter(nats *nats.Conn, rdb *redis.Client, serviceProvider string) *Router {
-	h := httprouter.New()
+// NewRouter returns the router of the public routes of a service. The admin
+// routes are added as well when admin is given, for services without a
+// separate admin listener.
+func NewRouter(nats *nats.Conn, rdb redis.UniversalClient, serviceProvider string, admin *AdminAuth) *Router {
+	h := metrics.Router{Router: httprouter.New()}
+	h.RedirectTrailingSlash = false
+	h.RedirectFixedPath = false
+
+	r := &Router{
+		Handler: h,
+	}
+
+	// the limiters are replaced on a config reload, tollbooth keeps the rate
+	// of a client for the lifetime of its bucket
+	limitr, authLimitr := new(atomic.Value), new(atomic.Value)
+	limits := config.Current().RateLimits
+	limitr.Store(notifLimiter(limits.Notifs))
+	authLimitr.Store(authLimiter(limits.Auth))
+
+	config.OnReload("rate limits", func(conf *config.Config) (func(), error) {
+		return func() {
+			reloadLimiter(limitr, conf.RateLimits.Notifs, notifLimiter)
+			reloadLimiter(authLimitr, conf.RateLimits.Auth, authLimiter)
+		}, nil
+	})
+
+	// probes shared by all services, the checks are added by each service
+	h.GET("/healthz", Healthz())
+	h.GET("/readyz", r.Readyz())
+
+	// player login shared by all services, sessions are stored in redis
+	h.POST("/api/v1/auth/challenge", reloadableLimitHandler(AuthChallenge(rdb), authLimitr))
+	h.OPTIONS("/api/v1/auth/challenge", optsMethods("POST, OPTIONS"))
+	h.POST("/api/v1/auth/login", reloadableLimitHandler(Login(rdb), authLimitr))
+	h.OPTIONS("/api/v1/auth/login", optsMethods("POST, OPTIONS"))
+	h.DELETE("/api/v1/auth/session", Logout(rdb))
+	h.OPTIONS("/api/v1/auth/session", optsMethods("DELETE, OPTIONS"))
+
+	if admin != nil {
+		adminRoutes(h, rdb, serviceProvider, admin)
+	}
+
+	switch serviceProvider {
+	case "rng":
+		h.GET("/api/v1/random-number/:game", RequirePlayer(rdb, SendRandNum(nats)))
+		h.OPTIONS("/api/v1/random-number/:game", opts())
+
+		h.GET("/api/v1/test/random-number/roulette", RequirePlayer(rdb, SendTestRandNum(nats)))
+		h.OPTIONS("/api/v1/test/random-number/roulette", opts())
+
+	case "payout":
+		h.GET("/api/v1/notifs/:walletAddr", reloadableLimitHandler(RequirePlayer(rdb, SendNotifs(nats, rdb)), limitr))
+		h.OPTIONS("/api/v1/notifs/:walletAddr", opts())
+
+		h.GET("/api/v1/players/:walletAddr/bets", RequirePlayer(rdb, PlayerBets(rdb)))
+		h.OPTIONS("/api/v1/players/:walletAddr/bets", opts())
+
+		// aggregated stats and leaderboards of every game
+		h.GET("/api/v1/stats", Stats(rdb))
+		h.OPTIONS("/api/v1/stats", opts())
+		h.GET("/api/v1/leaderboard", Leaderboard(rdb))
+		h.OPTIONS("/api/v1/leaderboard", opts())
+
+		// notifications and acks of a player over a websocket
+		h.GET("/api/v1/ws/notifs", NotifGateway(nats, rdb))
+	}
+
+	return r
+}
+
+// NewAdminRouter returns the router of the admin listener of a service.
+func NewAdminRouter(rdb redis.UniversalClient, serviceProvider string, admin *AdminAuth) *Router {
+	h := metrics.Router{Router: httprouter.New()}
 	h.RedirectTrailingSlash = false
 	h.RedirectFixedPath = false
 
@@ -33,8 +112,40 @@ func NewRouter(nats *nats.Conn, rdb *redis.Client, serviceProvider string) *Rout
 		Handler: h,
 	}
 
-	// this limiter is set to only handle 1req/10secs
-	limitr := tollbooth.NewLimiter(.1, nil).
+	adminRoutes(h, rdb, serviceProvider, admin)
+
+	r.ready = true
+
+	return r
+}
+
+// adminRoutes adds the routes meant for operators, every one of them requires
+// an api key or client certificate with a sufficient role.
+func adminRoutes(h metrics.Router, rdb redis.UniversalClient, serviceProvider string, admin *AdminAuth) {
+	h.GET("/metrics", admin.Require(RoleReadOnly, metrics.Handler()))
+	h.GET("/api/v1/info", admin.Require(RoleReadOnly, Info()))
+	h.GET("/api/v1/verbosity", admin.Require(RoleReadOnly, Verbosity()))
+	h.PUT("/api/v1/verbosity", admin.Require(RoleAdmin, SetVerbosity()))
+
+	switch serviceProvider {
+	case "payout":
+		// bets the payout service could not resolve
+		h.GET("/api/v1/bets/pending", admin.Require(RoleReadOnly, PendingBets(rdb)))
+		h.GET("/api/v1/bets/deadletter", admin.Require(RoleReadOnly, DeadLetterBets(rdb)))
+		h.POST("/api/v1/bets/deadletter/:boxId/retry", admin.Require(RoleOperator, RetryBet(rdb)))
+
+		// house bankroll and risk limits
+		h.GET("/api/v1/bankroll", admin.Require(RoleReadOnly, Bankroll(rdb)))
+		h.PUT("/api/v1/bankroll/pause", admin.Require(RoleOperator, SetBankrollPause(rdb)))
+
+		// settled bets checked against the chain
+		h.GET("/api/v1/reconcile", admin.Require(RoleReadOnly, ReconcileReport(rdb)))
+	}
+}
+
+// notifLimiter limits the notification requests of a client to max per second.
+func notifLimiter(max float64) *limiter.Limiter {
+	return tollbooth.NewLimiter(max, nil).
 		SetIPLookups([]string{"RemoteAddr", "X-Forwarded-For", "X-Real-IP"}).
 		SetMessage("Please slow down your requests :)").
 		SetOnLimitReached(func(w http.ResponseWriter, r *http.Request) {
@@ -44,9 +155,9 @@ func NewRouter(nats *nats.Conn, rdb *redis.Client, serviceProvider string) *Rout
 			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
 
 			// This will only be defined when site is accessed via non-anonymous proxy
-    		// and takes precedence over RemoteAddr
-    		// Header.Get is case-insensitive
-    		forward := r.Header.Get("X-Forwarded-For")
+			// and takes precedence over RemoteAddr
+			// Header.Get is case-insensitive
+			forward := r.Header.Get("X-Forwarded-For")
 			if forward != "" {
 				ip = forward
 			}
@@ -56,43 +167,46 @@ func NewRouter(nats *nats.Conn, rdb *redis.Client, serviceProvider string) *Rout
 				zap.String("ip_addr", ip),
 			)
 		})
+}
 
-	// administrative routes
-	h.GET("/api/v1/info", func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-		json.NewEncoder(w).Encode(buildinfo.Info)
-	})
-	h.GET("/api/v1/verbosity", Verbosity())
-	h.PUT("/api/v1/verbosity", SetVerbosity())
-
-	switch serviceProvider {
-	case "rng":
-		h.GET("/api/v1/random-number/:game", SendRandNum(nats))
-		h.OPTIONS("/api/v1/random-number/:game", opts())
-
-		h.GET("/api/v1/test/random-number/roulette", SendTestRandNum(nats))
-		h.OPTIONS("/api/v1/test/random-number/roulette", opts())
+// authLimiter is a looser limiter for logins, which every player needs once
+// per session.
+func authLimiter(max float64) *limiter.Limiter {
+	return tollbooth.NewLimiter(max, nil).
+		SetIPLookups([]string{"RemoteAddr", "X-Forwarded-For", "X-Real-IP"})
+}
 
-	case "payout":
-		h.GET("/api/v1/notifs/:walletAddr", LimitHandler(SendNotifs(nats, rdb), limitr))
-		h.OPTIONS("/api/v1/notifs/:walletAddr", opts())
+func LimitHandler(handler httprouter.Handle, lmt *limiter.Limiter) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		limit(lmt, handler, w, r, ps)
 	}
+}
 
-	r.ready = true
+// reloadableLimitHandler is LimitHandler with the limiter held by lmt.
+func reloadableLimitHandler(handler httprouter.Handle, lmt *atomic.Value) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		limit(lmt.Load().(*limiter.Limiter), handler, w, r, ps)
+	}
+}
 
-	return r
+// reloadLimiter swaps the limiter held by lmt for one built by newLimiter
+// when its rate changed. Swapping resets the request counts of every client,
+// so a limiter whose rate stayed the same is kept.
+func reloadLimiter(lmt *atomic.Value, max float64, newLimiter func(float64) *limiter.Limiter) {
+	if lmt.Load().(*limiter.Limiter).GetMax() != max {
+		lmt.Store(newLimiter(max))
+	}
 }
 
-func LimitHandler(handler httprouter.Handle, lmt *limiter.Limiter) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		httpError := tollbooth.LimitByRequest(lmt, w, r)
-		if httpError != nil {
-			lmt.ExecOnLimitReached(w, r)
-			w.Header().Add("Content-Type", lmt.GetMessageContentType())
-			w.WriteHeader(httpError.StatusCode)
-			w.Write([]byte(httpError.Message))
-			return
-		}
-
-		handler(w, r, ps)
+func limit(lmt *limiter.Limiter, handler httprouter.Handle, w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	httpError := tollbooth.LimitByRequest(lmt, w, r)
+	if httpError != nil {
+		lmt.ExecOnLimitReached(w, r)
+		w.Header().Add("Content-Type", lmt.GetMessageContentType())
+		w.WriteHeader(httpError.StatusCode)
+		w.Write([]byte(httpError.Message))
+		return
 	}
+
+	handler(w, r, ps)
 }
\ No newline at end of file
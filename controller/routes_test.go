@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/didip/tollbooth/limiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadLimiter(t *testing.T) {
+	lmt := new(atomic.Value)
+	orig := authLimiter(5)
+	lmt.Store(orig)
+
+	// the request counts of clients survive a reload which keeps the rate
+	reloadLimiter(lmt, 5, authLimiter)
+	assert.Same(t, orig, lmt.Load().(*limiter.Limiter))
+
+	reloadLimiter(lmt, 10, authLimiter)
+	assert.NotSame(t, orig, lmt.Load().(*limiter.Limiter))
+	assert.Equal(t, float64(10), lmt.Load().(*limiter.Limiter).GetMax())
+}
@@ -25,11 +25,36 @@ func NewServer(handler http.Handler, port int) *http_no.Server {
 		http_no.IdleTimeout(2*time.Minute))
 }
 
+// NewAdminServer returns the server of the admin listener. When tls is given
+// and has client CAs, client certificates are verified if presented, callers
+// without one can still use an api key.
+func NewAdminServer(handler http.Handler, port int, tls *http_no.TLSFiles) (*http_no.Server, error) {
+	options := []http_no.ServerOption{
+		http_no.ReadTimeout(1*time.Minute),
+		http_no.WriteTimeout(1*time.Minute),
+		http_no.IdleTimeout(2*time.Minute),
+	}
+
+	if tls != nil {
+		option, err := http_no.TLSFromFiles(*tls)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+
+	return http_no.NewServer(":"+strconv.Itoa(port), handler, options...), nil
+}
+
 func opts() httprouter.Handle {
+	return optsMethods("GET, OPTIONS")
+}
+
+func optsMethods(methods string) httprouter.Handle {
 	return func (w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, owl-session-id")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", methods)
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "")
 	}
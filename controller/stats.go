@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/services/stats"
+	"go.uber.org/zap"
+)
+
+const (
+	maxLeaderboardLimit = 100
+)
+
+// Stats returns the totals wagered and paid out per token, the realised and
+// theoretical house edge, bet counts per subgame and chip spot and how often
+// every random number came up, of one game or of every game
+//
+//     curl "http://host:port/api/v1/stats?game=roulette"
+//
+func Stats(rdb redis.UniversalClient) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+
+		games := []string{req.URL.Query().Get("game")}
+		if games[0] == "" {
+			var err error
+			games, err = stats.Games(context.Background(), rdb)
+			if err != nil {
+				log.Error("failed to get games with stats", zap.Error(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, "{\"error\": \"failed to get stats\"}")
+				return
+			}
+		}
+
+		resp := make(map[string]stats.GameStats)
+		for _, game := range games {
+			gs, err := stats.Load(context.Background(), rdb, game)
+			if err != nil {
+				log.Error("failed to get game stats", zap.Error(err), zap.String("game", game))
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, "{\"error\": \"failed to get stats\"}")
+				return
+			}
+			resp[game] = gs
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// Leaderboard returns the players with the highest net winnings of a day or
+// ISO week, the current one unless a date within the period is given
+//
+//     curl "http://host:port/api/v1/leaderboard?game=roulette&token=OWL&period=week&date=2022-08-05&limit=10"
+//
+func Leaderboard(rdb redis.UniversalClient) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+
+		query := req.URL.Query()
+		game := query.Get("game")
+		token := query.Get("token")
+		if game == "" || token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "{\"error\": \"'game' and 'token' are required\"}")
+			return
+		}
+
+		period := query.Get("period")
+		switch period {
+		case "":
+			period = stats.PeriodDay
+		case stats.PeriodDay, stats.PeriodWeek:
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "{\"error\": \"'period' must be day or week\"}")
+			return
+		}
+
+		at := time.Now()
+		if query.Has("date") {
+			var err error
+			at, err = time.Parse("2006-01-02", query.Get("date"))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, "{\"error\": \"'date' must be formatted as YYYY-MM-DD\"}")
+				return
+			}
+		}
+
+		limit := 10
+		if query.Has("limit") {
+			n, err := strconv.Atoi(query.Get("limit"))
+			if err != nil || n < 1 || n > maxLeaderboardLimit {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "{\"error\": \"'limit' must be between 1 and %d\"}", maxLeaderboardLimit)
+				return
+			}
+			limit = n
+		}
+
+		entries, err := stats.Leaderboard(context.Background(), rdb, game, token, period, at, limit)
+		if err != nil {
+			log.Error("failed to get leaderboard", zap.Error(err), zap.String("game", game))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "{\"error\": \"failed to get leaderboard\"}")
+			return
+		}
+
+		json.NewEncoder(w).Encode(entries)
+	}
+}
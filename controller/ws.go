@@ -0,0 +1,357 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/services/notif"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	wsNotifType = "notif"
+	wsAckType   = "ack"
+
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = 30 * time.Second
+	wsReadLimit  = 512
+	wsSendBuffer = 64
+	wsFetchBatch = 10
+	wsFetchWait  = 5 * time.Second
+)
+
+// wsMessage is the envelope of every message on the notification socket. The
+// gateway sends notifications with an id the player acks with the same id.
+type wsMessage struct {
+	Type  string          `json:"type"`
+	Id    uint64          `json:"id,omitempty"`
+	Notif json.RawMessage `json:"notif,omitempty"`
+}
+
+// notifConn bridges the notifications of one wallet address to a websocket.
+type notifConn struct {
+	ws         *websocket.Conn
+	walletAddr string
+	out        chan wsMessage
+	done       chan struct{}
+
+	mu     sync.Mutex
+	nextId uint64
+	acks   map[uint64]func() error
+}
+
+// NotifGateway upgrades the request to a websocket which delivers the
+// notifications of a player and passes the player's acks back to the notif
+// service. The player logs in with a signed challenge first, see Login.
+//
+//	curl -i -N -H "Connection: Upgrade" -H "Upgrade: websocket" -H "Sec-WebSocket-Version: 13" -H "Sec-WebSocket-Key: bmlnaHRvd2w=" \
+//	  "localhost:8090/api/v1/ws/notifs?session=ab12..."
+func NotifGateway(nc *nats.Conn, rdb redis.UniversalClient) httprouter.Handle {
+	sessions := state.NewSessionStore(context.Background(), rdb)
+	upgrader := websocket.Upgrader{
+		CheckOrigin: checkOrigin,
+	}
+
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		log := zap.L()
+
+		walletAddr, err := wsWalletAddr(req, sessions)
+		if err != nil {
+			log.Debug("notification socket unauthorized", zap.Error(err))
+			w.Header().Set(HeaderContentType, ContentTypeJSON)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "{\"error\": \"%s\"}", err.Error())
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			// the upgrader already replied with an error
+			log.Debug("failed to upgrade notification socket", zap.Error(err), zap.String("wallet_addr", walletAddr))
+			return
+		}
+
+		c := &notifConn{
+			ws:         ws,
+			walletAddr: walletAddr,
+			out:        make(chan wsMessage, wsSendBuffer),
+			done:       make(chan struct{}),
+			acks:       make(map[uint64]func() error),
+		}
+
+		log.Info("notification socket connected", zap.String("wallet_addr", walletAddr))
+		start := time.Now()
+
+		go c.writeLoop()
+
+		var stopSub func()
+		if notif.JetStreamEnabled() {
+			stopSub, err = c.subscribeBoth(nc)
+		} else {
+			stopSub, err = c.subscribe(nc, rdb)
+		}
+		if err != nil {
+			log.Error("failed to subscribe to notifications", zap.Error(err), zap.String("wallet_addr", walletAddr))
+			c.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "notifications are unavailable please try again"),
+				time.Now().Add(wsWriteWait))
+			c.close()
+			return
+		}
+
+		c.readLoop()
+		stopSub()
+		c.close()
+
+		log.Info("notification socket disconnected",
+			zap.Int64("durationMs", time.Since(start).Milliseconds()),
+			zap.String("wallet_addr", walletAddr),
+		)
+	}
+}
+
+// checkOrigin allows the origins in payout.ws.allowed_origins, or any origin
+// if none are configured like the rest of the player routes.
+func checkOrigin(req *http.Request) bool {
+	allowed := config.Current().Payout.WS.AllowedOrigins
+	if len(allowed) == 0 {
+		return true
+	}
+
+	origin := req.Header.Get("Origin")
+	for _, o := range allowed {
+		if o == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wsWalletAddr returns the wallet address of the session of the request.
+// Browsers can not set headers on websockets, so the session id may also be
+// given as a query parameter.
+func wsWalletAddr(req *http.Request, sessions *state.SessionStore) (string, error) {
+	sessionId := req.Header.Get(sessionHeader)
+	if sessionId == "" {
+		sessionId = req.URL.Query().Get("session")
+	}
+
+	session, err := sessions.Get(sessionId)
+	if err != nil {
+		return "", err
+	}
+
+	return session.Address, nil
+}
+
+// subscribe relays the notifications sent to the wallet address, then has the
+// notif service resend the ones stored in redis.
+func (c *notifConn) subscribe(nc *nats.Conn, rdb redis.UniversalClient) (func(), error) {
+	stop, err := c.subscribeCore(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	// stored notifications come back through the subscription
+	if _, _, err := replayNotifs(nc, rdb, c.walletAddr); err != nil {
+		zap.L().Error("failed to resend stored notifications", zap.Error(err), zap.String("wallet_addr", c.walletAddr))
+	}
+
+	return stop, nil
+}
+
+// subscribeBoth relays the notifications of the stream along with the ones
+// sent to the wallet address directly, e.g. the bet received notifications of
+// the mempool service, which are not stored.
+func (c *notifConn) subscribeBoth(nc *nats.Conn) (func(), error) {
+	stopCore, err := c.subscribeCore(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	stopStream, err := c.subscribeStream(nc)
+	if err != nil {
+		stopCore()
+		return nil, err
+	}
+
+	return func() {
+		stopStream()
+		stopCore()
+	}, nil
+}
+
+// subscribeCore relays the notifications sent to the wallet address.
+func (c *notifConn) subscribeCore(nc *nats.Conn) (func(), error) {
+	subj := broker.Subject(fmt.Sprintf("notif.%s", c.walletAddr))
+	sub, err := nc.Subscribe(subj, func(msg *nats.Msg) {
+		reply := msg.Reply
+		c.deliver(msg.Data, func() error {
+			// bet received notifications are not waiting for an ack
+			if reply == "" {
+				return nil
+			}
+			return nc.Publish(reply, []byte(wsAckType))
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to subject '%s' - %s", subj, err.Error())
+	}
+
+	return func() { sub.Unsubscribe() }, nil
+}
+
+// subscribeStream pulls the notifications of the wallet address from its
+// durable consumer. Notifications not acked before the socket closes are
+// redelivered on the next connect.
+func (c *notifConn) subscribeStream(nc *nats.Conn) (func(), error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jetstream context - %s", err.Error())
+	}
+
+	info, err := notif.EnsureConsumer(js, c.walletAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := js.PullSubscribe(notif.StreamSubject(c.walletAddr), info.Name, nats.Bind(info.Stream, info.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to consumer '%s' - %s", info.Name, err.Error())
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+
+			msgs, err := sub.Fetch(wsFetchBatch, nats.MaxWait(wsFetchWait))
+			switch {
+			case err == nats.ErrTimeout:
+				continue
+			case err != nil:
+				zap.L().Error("failed to fetch notifications", zap.Error(err), zap.String("consumer", info.Name))
+				c.close()
+				return
+			}
+
+			for _, msg := range msgs {
+				msg := msg
+				c.deliver(msg.Data, func() error { return msg.Ack() })
+			}
+		}
+	}()
+
+	return func() {
+		<-stopped
+		sub.Unsubscribe()
+	}, nil
+}
+
+// deliver queues a notification for the player and remembers how to ack it.
+func (c *notifConn) deliver(data []byte, ack func() error) {
+	c.mu.Lock()
+	c.nextId++
+	id := c.nextId
+	c.acks[id] = ack
+	c.mu.Unlock()
+
+	c.send(wsMessage{Type: wsNotifType, Id: id, Notif: data})
+}
+
+func (c *notifConn) send(msg wsMessage) {
+	select {
+	case c.out <- msg:
+	case <-c.done:
+	}
+}
+
+// ack passes the ack of the player on to whoever sent the notification.
+func (c *notifConn) ack(id uint64) {
+	c.mu.Lock()
+	ack, ok := c.acks[id]
+	delete(c.acks, id)
+	c.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if err := ack(); err != nil {
+		zap.L().Error("failed to ack notification", zap.Error(err), zap.String("wallet_addr", c.walletAddr))
+	}
+}
+
+func (c *notifConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+		c.ws.Close()
+	}
+}
+
+// readLoop handles the acks of the player until the socket is closed.
+func (c *notifConn) readLoop() {
+	c.ws.SetReadLimit(wsReadLimit)
+	c.ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var msg wsMessage
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		if msg.Type == wsAckType {
+			c.ack(msg.Id)
+		}
+	}
+}
+
+// writeLoop is the only writer of the socket, as websocket connections do not
+// support concurrent writes. It also keeps the connection alive with pings.
+func (c *notifConn) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.out:
+			c.ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.ws.WriteJSON(msg); err != nil {
+				c.close()
+				return
+			}
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
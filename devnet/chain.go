@@ -0,0 +1,387 @@
+package devnet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/services/rng"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	// nanoErg value of the boxes created by the chain
+	boxValue = 1000000
+	// funds of the house at genesis, large enough for any bankroll limit
+	houseNanoErgs = 1000000000000000
+	houseTokens   = 1000000000000
+	txFee         = 1000000
+)
+
+var (
+	ErrUnknownBox = errors.New("box is unknown or spent")
+	ErrNotP2PK    = errors.New("wallet address must be a p2pk address")
+)
+
+type box struct {
+	erg.ErgTxOutputNode
+	address   string
+	bytes     string
+	rendered  erg.Registers
+	confirmed bool
+	spent     bool
+}
+
+type tx struct {
+	id      string
+	height  int
+	inputs  []string
+	outputs []*box
+}
+
+// Chain is a fake ergo node and explorer. Bets placed through it are mined in
+// the next block, and every block publishes a random number for the bets of
+// the block before on the nats random number subject, the way the oracle pool
+// does, and records it in an oracle tx. Txs sent through its node wallet are
+// accepted without any signature and mined in the next block.
+type Chain struct {
+	reg      *contracts.Registry
+	network  byte
+	nats     *nats.Conn
+	sessions *state.SessionStore
+
+	mu        sync.Mutex
+	height    int
+	boxes     map[string]*box
+	byBytes   map[string]string
+	mempool   []*tx
+	txs       map[string]*tx
+	confirmed []*tx
+	// random hash of the last block and the bets mined in it
+	hash string
+	slot []string
+
+	stop chan bool
+	done chan bool
+}
+
+// NewChain creates a chain serving the contracts of reg whose house address
+// holds plenty of ERG and OWL. Random numbers are published on nc and players
+// logged in with sessions, both are optional.
+func NewChain(reg *contracts.Registry, nc *nats.Conn, sessions *state.SessionStore) (*Chain, error) {
+	c := &Chain{
+		reg:      reg,
+		network:  erg.MainnetPrefix,
+		nats:     nc,
+		sessions: sessions,
+		boxes:    make(map[string]*box),
+		byBytes:  make(map[string]string),
+		txs:      make(map[string]*tx),
+		stop:     make(chan bool),
+		done:     make(chan bool),
+	}
+	if reg.Network == contracts.Testnet {
+		c.network = erg.TestnetPrefix
+	}
+
+	houseTree, err := erg.AddressToErgoTree(reg.HouseAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid house address - %s", err.Error())
+	}
+
+	assets := []erg.Tokens{}
+	for _, id := range reg.Tokens {
+		assets = append(assets, erg.Tokens{TokenId: id, Amount: houseTokens})
+	}
+
+	c.height = 1
+	genesis := c.newTx(nil, c.newBox(houseTree, reg.HouseAddress, houseNanoErgs, assets, erg.RegistersNode{}))
+	c.confirm(genesis)
+
+	return c, nil
+}
+
+// Start mines a block every blockTime.
+func (c *Chain) Start(blockTime time.Duration) {
+	go func() {
+		ticker := time.NewTicker(blockTime)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stop:
+				close(c.done)
+				return
+			case <-ticker.C:
+				c.Mine()
+			}
+		}
+	}()
+}
+
+// Stop stops mining blocks.
+func (c *Chain) Stop() {
+	c.stop <- true
+	<-c.done
+}
+
+// Mine mines the txs of the mempool into a new block, records the random
+// number of the bets mined in the previous block in an oracle tx and publishes
+// the random number of the new block along with the bets mined in it.
+func (c *Chain) Mine() {
+	log := zap.L()
+
+	c.mu.Lock()
+	c.height++
+
+	var bets []string
+	for _, t := range c.mempool {
+		c.confirm(t)
+		for _, b := range t.outputs {
+			if c.isGameBox(b) {
+				bets = append(bets, b.BoxId)
+			}
+		}
+	}
+	c.mempool = nil
+
+	hash := randomHex(32)
+	if len(c.slot) > 0 {
+		c.confirm(c.oracleTx(c.hash, hash, c.slot))
+	}
+	c.hash, c.slot = hash, bets
+	height := c.height
+	c.mu.Unlock()
+
+	log.Debug("mined block", zap.Int("height", height), zap.String("hash", hash), zap.Strings("bets", bets))
+
+	if c.nats == nil {
+		return
+	}
+
+	msg, _ := json.Marshal(rng.CombinedHashes{Hash: hash, Boxes: bets})
+	subj := config.Current().NATS.RandomNumberSubj
+	if err := c.nats.Publish(subj, msg); err != nil {
+		log.Error("failed to publish random number", zap.Error(err), zap.String("nats_subject", subj))
+	}
+}
+
+// PlaceBet adds a roulette bet of amount OWL on the chipspot of a subgame by
+// walletAddr to the mempool and returns the id of the bet box.
+func (c *Chain) PlaceBet(walletAddr string, subgame, chipspot, amount int) (string, error) {
+	addr, err := erg.DecodeAddress(walletAddr)
+	if err != nil {
+		return "", err
+	}
+	if addr.Type != erg.P2PKType {
+		return "", ErrNotP2PK
+	}
+	if amount <= 0 {
+		return "", fmt.Errorf("bet amount must be greater than 0, got %d", amount)
+	}
+
+	playerTree, _ := addr.ErgoTree()
+	gameTree := c.reg.GameErgoTree(contracts.Roulette)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.newBox(gameTree, c.addressOf(gameTree), boxValue,
+		[]erg.Tokens{{TokenId: c.reg.TokenId("OWL"), Amount: amount}},
+		erg.RegistersNode{
+			R4: "04" + vlq(zigzag(subgame)),
+			R5: "04" + vlq(zigzag(chipspot)),
+			R6: "0e" + vlq(uint64(len(playerTree))) + hex.EncodeToString(playerTree),
+		},
+	)
+	c.mempool = append(c.mempool, c.newTx(nil, b))
+
+	return b.BoxId, nil
+}
+
+// Login starts a session for walletAddr without asking for a signature.
+func (c *Chain) Login(walletAddr string) (state.Session, error) {
+	if c.sessions == nil {
+		return state.Session{}, errors.New("sessions are not available")
+	}
+	if _, err := erg.DecodeAddress(walletAddr); err != nil {
+		return state.Session{}, err
+	}
+
+	return c.sessions.Create(walletAddr, time.Duration(config.Current().Auth.SessionTTL)*time.Second)
+}
+
+// Send adds the tx described by a node wallet payment request to the mempool
+// and returns its id.
+func (c *Chain) Send(req erg.TxRequest) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	spending := make(map[string]bool)
+	for _, t := range c.mempool {
+		for _, id := range t.inputs {
+			spending[id] = true
+		}
+	}
+
+	for _, raw := range req.DataInputsRaw {
+		if b, ok := c.boxes[c.byBytes[raw]]; !ok || b.spent {
+			return "", ErrUnknownBox
+		}
+	}
+
+	var inputs []string
+	for _, raw := range req.InputsRaw {
+		b, ok := c.boxes[c.byBytes[raw]]
+		if !ok || b.spent {
+			return "", ErrUnknownBox
+		}
+		if spending[b.BoxId] {
+			return "", fmt.Errorf("box %s is already spent by a tx in the mempool", b.BoxId)
+		}
+		inputs = append(inputs, b.BoxId)
+	}
+
+	var outputs []*box
+	for _, r := range req.Requests {
+		tree, err := erg.AddressToErgoTree(r.Address)
+		if err != nil {
+			return "", fmt.Errorf("invalid output address '%s' - %s", r.Address, err.Error())
+		}
+		outputs = append(outputs, c.newBox(tree, r.Address, r.Value, r.Assets, erg.RegistersNode{
+			R4: r.Registers["R4"],
+			R5: r.Registers["R5"],
+			R6: r.Registers["R6"],
+		}))
+	}
+
+	t := c.newTx(inputs, outputs...)
+	c.mempool = append(c.mempool, t)
+
+	return t.id, nil
+}
+
+func (c *Chain) newBox(tree, address string, value int, assets []erg.Tokens, regs erg.RegistersNode) *box {
+	bytes := randomHex(48)
+	id, _ := erg.BoxIdFromBytes(bytes)
+
+	b := &box{
+		ErgTxOutputNode: erg.ErgTxOutputNode{
+			BoxId:               id,
+			Value:               value,
+			Assets:              assets,
+			AdditionalRegisters: regs,
+			ErgoTree:            tree,
+			CreationHeight:      c.height,
+		},
+		address: address,
+		bytes:   bytes,
+		rendered: erg.Registers{
+			R4: erg.Reg{Value: regs.R4},
+			R5: erg.Reg{Value: regs.R5},
+		},
+	}
+	c.boxes[id] = b
+	c.byBytes[bytes] = id
+
+	return b
+}
+
+func (c *Chain) newTx(inputs []string, outputs ...*box) *tx {
+	t := &tx{
+		id:      randomHex(32),
+		inputs:  inputs,
+		outputs: outputs,
+	}
+	for _, b := range outputs {
+		b.TxId = t.id
+	}
+
+	return t
+}
+
+func (c *Chain) confirm(t *tx) {
+	t.height = c.height
+	for _, id := range t.inputs {
+		c.boxes[id].spent = true
+	}
+	for _, b := range t.outputs {
+		b.confirmed = true
+	}
+	c.txs[t.id] = t
+	c.confirmed = append(c.confirmed, t)
+}
+
+// oracleTx records that the bets attached to hash are resolved with next, in
+// the register layout of the oracle pool.
+func (c *Chain) oracleTx(hash, next string, bets []string) *tx {
+	tree, _ := erg.AddressToErgoTree(c.reg.OracleAddress)
+	b := c.newBox(tree, c.reg.OracleAddress, boxValue, nil, erg.RegistersNode{})
+	b.rendered = erg.Registers{
+		R4: erg.Reg{Value: "[" + hash + "," + next + "]"},
+		R5: erg.Reg{Value: "[[" + strings.Join(bets, ",") + "]]"},
+	}
+
+	return c.newTx(nil, b)
+}
+
+func (c *Chain) isGameBox(b *box) bool {
+	for _, g := range c.reg.Games {
+		if b.ErgoTree == g.ErgoTree {
+			return true
+		}
+	}
+	return false
+}
+
+// addressOf returns the address of an ergoTree, P2PK for trees of a single
+// public key and P2S for every other tree.
+func (c *Chain) addressOf(tree string) string {
+	b, err := hex.DecodeString(tree)
+	if err != nil {
+		return ""
+	}
+
+	if len(b) == 36 && strings.HasPrefix(tree, "0008cd") {
+		return erg.NewP2PKAddress(c.network, b[3:]).String()
+	}
+	return erg.Address{Network: c.network, Type: erg.P2SType, Content: b}.String()
+}
+
+// RandomAddress returns a new P2PK address of the network of the chain. The
+// public key is random bytes, which is all the services ever look at.
+func (c *Chain) RandomAddress() string {
+	pubKey, _ := hex.DecodeString("02" + randomHex(32))
+	return erg.NewP2PKAddress(c.network, pubKey).String()
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// zigzag and vlq encode an Int register the way sigma serializes it.
+func zigzag(n int) uint64 {
+	return uint64((int64(n) << 1) ^ (int64(n) >> 63))
+}
+
+func vlq(n uint64) string {
+	var b []byte
+	for n >= 0x80 {
+		b = append(b, byte(n)|0x80)
+		n >>= 7
+	}
+	b = append(b, byte(n))
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,114 @@
+package devnet
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startChain(t *testing.T) (*Chain, *erg.ErgNode, *erg.Explorer) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	reg, err := contracts.Load()
+	require.NoError(t, err)
+
+	chain, err := NewChain(reg, nil, nil)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(chain.Handler())
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	for _, prefix := range []string{"ergo_node", "explorer_node"} {
+		viper.Set(prefix+".scheme", "http")
+		viper.Set(prefix+".fqdn", u.Hostname())
+		viper.Set(prefix+".port", port)
+	}
+
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	client.RetryMax = 0
+
+	node, _ := erg.NewErgNode(client)
+	explorer, _ := erg.NewExplorer(client)
+
+	return chain, node, explorer
+}
+
+func TestBetFlow(t *testing.T) {
+	chain, node, explorer := startChain(t)
+	player := chain.RandomAddress()
+
+	boxId, err := chain.PlaceBet(player, 0, 17, 100)
+	require.NoError(t, err)
+
+	// the bet is in the mempool until the next block, the node answers an
+	// empty box for boxes it has no utxo of
+	utxo, err := node.GetErgUtxoBox(boxId)
+	require.NoError(t, err)
+	assert.Empty(t, utxo.BoxId)
+	outputs, err := node.GetUnconfirmedOutputsByErgoTree(chain.reg.GameErgoTree(contracts.Roulette), 10, 0)
+	require.NoError(t, err)
+	require.Len(t, outputs, 1)
+	assert.Equal(t, boxId, outputs[0].BoxId)
+
+	chain.Mine()
+	bet, err := node.GetErgUtxoBox(boxId)
+	require.NoError(t, err)
+	assert.Equal(t, "0422", bet.AdditionalRegisters.R5)
+
+	// the random number of the bet is recorded in the oracle tx of the next block
+	chain.Mine()
+	oracleTxs, err := explorer.GetOracleTxs(chain.reg.OracleAddress, 0, 10, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, oracleTxs.Items, 1)
+	assert.Equal(t, "[["+boxId+"]]", oracleTxs.Items[0].Outputs[0].AdditionalRegisters.R5.Value)
+
+	// paying out spends the bet box
+	bytes, err := node.SerializeErgBox(boxId)
+	require.NoError(t, err)
+	payload, _ := json.Marshal(erg.TxRequest{
+		Requests:  []erg.PaymentRequest{{Address: player, Value: boxValue, Assets: bet.Assets}},
+		Fee:       txFee,
+		InputsRaw: []string{bytes},
+	})
+	resp, err := node.PostErgOracleTx(payload)
+	require.NoError(t, err)
+
+	var txId string
+	require.NoError(t, json.Unmarshal(resp, &txId))
+	_, err = node.PostErgOracleTx(payload)
+	assert.Error(t, err, "double spend within the mempool")
+
+	chain.Mine()
+	utxo, err = node.GetErgUtxoBox(boxId)
+	require.NoError(t, err)
+	assert.Empty(t, utxo.BoxId)
+	tx, err := explorer.GetErgTx(txId)
+	require.NoError(t, err)
+	assert.Equal(t, player, tx.Outputs[0].Address)
+
+	balance, err := explorer.GetConfirmedBalance(player)
+	require.NoError(t, err)
+	assert.Equal(t, boxValue, balance.NanoErgs)
+}
+
+func TestPlaceBetRejected(t *testing.T) {
+	chain, _, _ := startChain(t)
+
+	_, err := chain.PlaceBet(chain.reg.OracleAddress, 0, 1, 100)
+	assert.ErrorIs(t, err, ErrNotP2PK)
+	_, err = chain.PlaceBet(chain.RandomAddress(), 0, 1, 0)
+	assert.Error(t, err)
+}
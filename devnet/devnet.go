@@ -0,0 +1,112 @@
+// Package devnet provides in-process stand-ins for the nats server, the redis
+// db and the ergo node and explorer, so that the whole bet, random number,
+// payout and notification flow can run on a laptop. None of it is meant for
+// production use.
+package devnet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// redisTick is how often the clock of the in-memory redis db is advanced, it
+// only expires keys when told to.
+const redisTick = time.Second
+
+// NATS is an embedded nats server with JetStream enabled.
+type NATS struct {
+	*server.Server
+	storeDir string
+}
+
+// StartNATS starts a nats server listening on port of the loopback interface,
+// a random port if port is 0. JetStream data is kept in a temp dir removed on
+// Close.
+func StartNATS(port int) (*NATS, error) {
+	if port == 0 {
+		port = server.RANDOM_PORT
+	}
+
+	dir, err := os.MkdirTemp("", "nightowl-nats-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jetstream store dir - %s", err.Error())
+	}
+
+	ns, err := server.NewServer(&server.Options{
+		ServerName: "nightowl-dev",
+		Host:       "127.0.0.1",
+		Port:       port,
+		JetStream:  true,
+		StoreDir:   dir,
+		NoSigs:     true,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create embedded nats server - %s", err.Error())
+	}
+
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		ns.Shutdown()
+		os.RemoveAll(dir)
+		return nil, errors.New("embedded nats server did not start in time")
+	}
+
+	return &NATS{Server: ns, storeDir: dir}, nil
+}
+
+// Close stops the server and removes its JetStream data.
+func (n *NATS) Close() {
+	n.Shutdown()
+	n.WaitForShutdown()
+	os.RemoveAll(n.storeDir)
+}
+
+// Redis is an in-memory redis db.
+type Redis struct {
+	*miniredis.Miniredis
+	stop chan bool
+}
+
+// StartRedis starts an in-memory redis db listening on addr, a random port of
+// the loopback interface if addr is empty. Its data is lost on Close.
+func StartRedis(addr string) (*Redis, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+
+	m := miniredis.NewMiniRedis()
+	if err := m.StartAddr(addr); err != nil {
+		return nil, fmt.Errorf("failed to start in-memory redis db - %s", err.Error())
+	}
+
+	r := &Redis{Miniredis: m, stop: make(chan bool)}
+	go r.tick()
+
+	return r, nil
+}
+
+func (r *Redis) tick() {
+	ticker := time.NewTicker(redisTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.FastForward(redisTick)
+		}
+	}
+}
+
+// Close stops the db.
+func (r *Redis) Close() {
+	close(r.stop)
+	r.Miniredis.Close()
+}
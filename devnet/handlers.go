@@ -0,0 +1,375 @@
+package devnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/nightowlcasino/nightowl/erg"
+)
+
+// Handler serves the node and explorer endpoints used by the services, and
+// the dev endpoints to log in players and place bets.
+func (c *Chain) Handler() http.Handler {
+	r := httprouter.New()
+
+	// node
+	r.POST("/wallet/unlock", ok)
+	r.GET("/wallet/lock", ok)
+	r.POST("/wallet/transaction/send", c.sendTx)
+	r.GET("/info", c.info)
+	r.GET("/blocks/lastHeaders/:count", c.lastHeaders)
+	r.GET("/utxo/byId/:boxId", c.utxoBox)
+	r.GET("/utxo/withPool/byIdBinary/:boxId", c.serializedBox)
+	r.GET("/transactions/unconfirmed", c.unconfirmedTxs)
+	r.GET("/transactions/unconfirmed/byTransactionId/:txId", c.unconfirmedTx)
+	r.POST("/transactions/unconfirmed/outputs/byErgoTree", c.unconfirmedOutputs)
+	r.GET("/transactions/getFee", fee)
+	r.GET("/utils/ergoTreeToAddress/:ergoTree", c.ergoTreeToAddress)
+
+	// explorer
+	r.GET("/api/v1/transactions/:txId", c.explorerTx)
+	r.GET("/api/v1/addresses/:address/transactions", c.addressTxs)
+	r.GET("/api/v1/addresses/:address/balance/confirmed", c.balance)
+	r.GET("/api/v1/boxes/unspent/byAddress/:address", c.unspentBoxes)
+
+	// dev
+	r.POST("/dev/login", c.login)
+	r.POST("/dev/bets", c.placeBet)
+
+	return r
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in the error format of the node.
+func writeError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  status,
+		"reason": http.StatusText(status),
+		"detail": detail,
+	})
+}
+
+func page(r *http.Request, total int) (int, int) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	start := offset
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	return start, end
+}
+
+func ok(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func fee(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	fmt.Fprint(w, txFee)
+}
+
+func (c *Chain) sendTx(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req erg.TxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := c.Send(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, id)
+}
+
+func (c *Chain) info(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeJSON(w, erg.NodeInfo{
+		FullHeight:    c.height,
+		HeadersHeight: c.height,
+		MaxPeerHeight: c.height,
+		PeersCount:    1,
+	})
+}
+
+func (c *Chain) lastHeaders(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeJSON(w, []map[string]int{{"height": c.height, "timestamp": int(time.Now().UnixMilli())}})
+}
+
+func (c *Chain) utxoBox(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.boxes[ps.ByName("boxId")]
+	if !ok || !b.confirmed || b.spent {
+		writeError(w, http.StatusNotFound, "box not found")
+		return
+	}
+
+	writeJSON(w, b.ErgTxOutputNode)
+}
+
+func (c *Chain) serializedBox(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.boxes[ps.ByName("boxId")]
+	if !ok || b.spent {
+		writeError(w, http.StatusNotFound, "box not found")
+		return
+	}
+
+	writeJSON(w, erg.Serialized{BoxId: b.BoxId, Bytes: b.bytes})
+}
+
+func (c *Chain) unconfirmedTxs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	txs := []erg.ErgTxUnconfirmed{}
+	start, end := page(r, len(c.mempool))
+	for _, t := range c.mempool[start:end] {
+		txs = append(txs, unconfirmed(t))
+	}
+
+	writeJSON(w, txs)
+}
+
+func (c *Chain) unconfirmedTx(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range c.mempool {
+		if t.id == ps.ByName("txId") {
+			writeJSON(w, unconfirmed(t))
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "tx not found")
+}
+
+func (c *Chain) unconfirmedOutputs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var tree string
+	if err := json.NewDecoder(r.Body).Decode(&tree); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matching []erg.ErgTxOutputNode
+	for _, t := range c.mempool {
+		for _, b := range t.outputs {
+			if b.ErgoTree == tree {
+				matching = append(matching, b.ErgTxOutputNode)
+			}
+		}
+	}
+
+	start, end := page(r, len(matching))
+	writeJSON(w, append([]erg.ErgTxOutputNode{}, matching[start:end]...))
+}
+
+func (c *Chain) ergoTreeToAddress(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	addr := c.addressOf(ps.ByName("ergoTree"))
+	if addr == "" {
+		writeError(w, http.StatusBadRequest, "invalid ergoTree")
+		return
+	}
+
+	writeJSON(w, map[string]string{"address": addr})
+}
+
+func (c *Chain) explorerTx(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, ok := c.txs[ps.ByName("txId")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "tx not found")
+		return
+	}
+
+	writeJSON(w, c.explorerErgTx(t))
+}
+
+func (c *Chain) addressTxs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	address := ps.ByName("address")
+	from, _ := strconv.Atoi(r.URL.Query().Get("fromHeight"))
+	to, err := strconv.Atoi(r.URL.Query().Get("toHeight"))
+	if err != nil {
+		to = -1
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var txs []erg.ErgTx
+	for _, t := range c.confirmed {
+		if t.height < from || to >= 0 && t.height > to {
+			continue
+		}
+		for _, b := range t.outputs {
+			if b.address == address {
+				txs = append(txs, c.explorerErgTx(t))
+				break
+			}
+		}
+	}
+
+	start, end := page(r, len(txs))
+	writeJSON(w, erg.ErgBoxIds{Items: append([]erg.ErgTx{}, txs[start:end]...)})
+}
+
+func (c *Chain) balance(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	balance := erg.AddressBalance{Tokens: []erg.Tokens{}}
+	tokens := make(map[string]int)
+	for _, b := range c.unspent(ps.ByName("address")) {
+		balance.NanoErgs += b.Value
+		for _, t := range b.Assets {
+			tokens[t.TokenId] += t.Amount
+		}
+	}
+	for id, amount := range tokens {
+		balance.Tokens = append(balance.Tokens, erg.Tokens{TokenId: id, Amount: amount})
+	}
+	sort.Slice(balance.Tokens, func(i, j int) bool {
+		return balance.Tokens[i].TokenId < balance.Tokens[j].TokenId
+	})
+
+	writeJSON(w, balance)
+}
+
+func (c *Chain) unspentBoxes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unspent := c.unspent(ps.ByName("address"))
+	boxes := erg.ExplorerBoxes{Items: []erg.ExplorerBox{}, Total: len(unspent)}
+	start, end := page(r, len(unspent))
+	for _, b := range unspent[start:end] {
+		boxes.Items = append(boxes.Items, erg.ExplorerBox{BoxId: b.BoxId, Value: b.Value, Assets: b.Assets})
+	}
+
+	writeJSON(w, boxes)
+}
+
+func (c *Chain) login(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req struct {
+		WalletAddr string `json:"walletAddr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	session, err := c.Login(req.WalletAddr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// same response as the login of the services
+	writeJSON(w, map[string]interface{}{
+		"sessionId":  session.Id,
+		"walletAddr": session.Address,
+		"expiresAt":  session.ExpiresAt,
+	})
+}
+
+func (c *Chain) placeBet(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req struct {
+		WalletAddr string `json:"walletAddr"`
+		Subgame    int    `json:"subgame"`
+		Chipspot   int    `json:"chipspot"`
+		Amount     int    `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// bets of players who did not pick an address are placed by a new one
+	if req.WalletAddr == "" {
+		req.WalletAddr = c.RandomAddress()
+	}
+
+	boxId, err := c.PlaceBet(req.WalletAddr, req.Subgame, req.Chipspot, req.Amount)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, map[string]string{"boxId": boxId, "walletAddr": req.WalletAddr})
+}
+
+// unspent returns the mined boxes of an address which are not spent.
+func (c *Chain) unspent(address string) []*box {
+	var boxes []*box
+	for _, t := range c.confirmed {
+		for _, b := range t.outputs {
+			if b.address == address && !b.spent {
+				boxes = append(boxes, b)
+			}
+		}
+	}
+	return boxes
+}
+
+func (c *Chain) explorerErgTx(t *tx) erg.ErgTx {
+	ergTx := erg.ErgTx{
+		Id:            t.id,
+		Height:        t.height,
+		Confirmations: c.height - t.height + 1,
+	}
+	for _, b := range t.outputs {
+		ergTx.Outputs = append(ergTx.Outputs, erg.ErgTxOutput{
+			BoxId:               b.BoxId,
+			Value:               b.Value,
+			Address:             b.address,
+			Assets:              b.Assets,
+			AdditionalRegisters: b.rendered,
+			ErgoTree:            b.ErgoTree,
+		})
+	}
+	return ergTx
+}
+
+func unconfirmed(t *tx) erg.ErgTxUnconfirmed {
+	utx := erg.ErgTxUnconfirmed{Id: t.id}
+	for _, b := range t.outputs {
+		utx.Outputs = append(utx.Outputs, b.ErgTxOutputNode)
+	}
+	return utx
+}
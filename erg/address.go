@@ -0,0 +1,167 @@
+package erg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	MainnetPrefix byte = 0x00
+	TestnetPrefix byte = 0x10
+
+	P2PKType byte = 0x01
+	P2SHType byte = 0x02
+	P2SType  byte = 0x03
+
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	checksumLength = 4
+)
+
+var (
+	ErrInvalidAddress  = errors.New("invalid erg address")
+	ErrInvalidChecksum = errors.New("invalid erg address checksum")
+)
+
+// Address is a decoded ergo address. Content holds the public key for P2PK
+// addresses, the script hash for P2SH addresses and the ergoTree for P2S
+// addresses.
+type Address struct {
+	Network byte
+	Type    byte
+	Content []byte
+}
+
+// DecodeAddress parses a base58 encoded ergo address and verifies its checksum.
+func DecodeAddress(addr string) (Address, error) {
+	var a Address
+
+	raw, err := base58Decode(addr)
+	if err != nil {
+		return a, err
+	}
+
+	if len(raw) < 1+checksumLength+1 {
+		return a, ErrInvalidAddress
+	}
+
+	body := raw[:len(raw)-checksumLength]
+	sum := blake2b.Sum256(body)
+	if !bytes.Equal(sum[:checksumLength], raw[len(raw)-checksumLength:]) {
+		return a, ErrInvalidChecksum
+	}
+
+	a.Network = body[0] & 0xf0
+	a.Type = body[0] & 0x0f
+	a.Content = body[1:]
+
+	switch a.Type {
+	case P2PKType:
+		if len(a.Content) != 33 {
+			return a, fmt.Errorf("p2pk address public key has length %d - %w", len(a.Content), ErrInvalidAddress)
+		}
+	case P2SHType, P2SType:
+	default:
+		return a, fmt.Errorf("unknown address type %d - %w", a.Type, ErrInvalidAddress)
+	}
+
+	return a, nil
+}
+
+// NewP2PKAddress builds a P2PK address from a compressed public key.
+func NewP2PKAddress(network byte, pubKey []byte) Address {
+	return Address{
+		Network: network,
+		Type:    P2PKType,
+		Content: pubKey,
+	}
+}
+
+// String returns the base58 encoding of the address.
+func (a Address) String() string {
+	body := append([]byte{a.Network | a.Type}, a.Content...)
+	sum := blake2b.Sum256(body)
+	return base58Encode(append(body, sum[:checksumLength]...))
+}
+
+// ErgoTree returns the serialized ergoTree which guards boxes sent to this
+// address.
+func (a Address) ErgoTree() ([]byte, error) {
+	switch a.Type {
+	case P2PKType:
+		return append([]byte{0x00, 0x08, 0xcd}, a.Content...), nil
+	case P2SType:
+		return a.Content, nil
+	default:
+		return nil, fmt.Errorf("ergoTree of p2sh addresses is not supported - %w", ErrInvalidAddress)
+	}
+}
+
+// AddressToErgoTree is a convenience wrapper returning the hex encoded ergoTree
+// of a base58 encoded address.
+func AddressToErgoTree(addr string) (string, error) {
+	a, err := DecodeAddress(addr)
+	if err != nil {
+		return "", err
+	}
+
+	tree, err := a.ErgoTree()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(tree), nil
+}
+
+func base58Encode(b []byte) string {
+	x := new(big.Int).SetBytes(b)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	// reverse to big endian
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	x := new(big.Int)
+	base := big.NewInt(58)
+
+	for _, c := range []byte(s) {
+		idx := bytes.IndexByte([]byte(base58Alphabet), c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character '%c' - %w", c, ErrInvalidAddress)
+		}
+		x.Mul(x, base)
+		x.Add(x, big.NewInt(int64(idx)))
+	}
+
+	out := x.Bytes()
+	for _, c := range []byte(s) {
+		if c != base58Alphabet[0] {
+			break
+		}
+		out = append([]byte{0x00}, out...)
+	}
+
+	return out, nil
+}
@@ -1,7 +1,9 @@
 package erg
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -9,12 +11,16 @@ import (
 
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/nightowlcasino/nightowl/config"
-	"github.com/spf13/viper"
 )
 
 var (
-	oracleAddress     = "4FC5xSYb7zfRdUhm6oRmE11P2GJqSMY8UARPbHkmXEq6hTinXq4XNWdJs73BEV44MdmJ49Qo"
 	getErgTxsEndpoint = "/api/v1/transactions/"
+	getUnspentBoxes   = "/api/v1/boxes/unspent/byAddress/"
+	getAddresses      = "/api/v1/addresses/"
+	getBoxEndpoint    = "/api/v1/boxes/"
+
+	ErrTxNotFound  = errors.New("tx not found")
+	ErrBoxNotFound = errors.New("box not found")
 )
 
 type Explorer struct {
@@ -22,33 +28,50 @@ type Explorer struct {
 	url *url.URL
 	user string
 	pass string
+	ctx context.Context
 }
 
 func NewExplorer(client *retryablehttp.Client) (*Explorer, error) {
 	var node *Explorer
 
 	config.SetExplorerDefaults()
+	conf := config.Current()
 
 	var u = &url.URL{
-		Scheme: viper.Get("explorer_node.scheme").(string),
-		Host: viper.Get("explorer_node.fqdn").(string)+":"+strconv.Itoa(viper.Get("explorer_node.port").(int)),
+		Scheme: conf.ExplorerNode.Scheme,
+		Host: conf.ExplorerNode.FQDN+":"+strconv.Itoa(conf.ExplorerNode.Port),
 	}
 
 	node = &Explorer{
 		client:     client,
 		url:        u,
-	    user:       viper.Get("ergo_node.user").(string),
-	    pass:       viper.Get("ergo_node.password").(string),
+	    user:       conf.ErgoNode.User,
+	    pass:       conf.ErgoNode.Password,
 	}
 
 	return node, nil
 }
 
-func (e *Explorer) GetOracleTxs(minHeight, maxHeight, limit, offset int) (ErgBoxIds, error) {
+// WithContext returns a copy of the explorer client whose requests are made
+// with ctx.
+func (e *Explorer) WithContext(ctx context.Context) *Explorer {
+	c := *e
+	c.ctx = ctx
+	return &c
+}
+
+func (e *Explorer) context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+func (e *Explorer) GetOracleTxs(oracleAddress string, minHeight, maxHeight, limit, offset int) (ErgBoxIds, error) {
 	var ergTxs ErgBoxIds
 
 	endpoint := fmt.Sprintf("%s/api/v1/addresses/%s/transactions?fromHeight=%d&toHeight=%d&limit=%d&offset=%d", e.url.String(), oracleAddress, minHeight, maxHeight, limit, offset)
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(e.context(), "GET", endpoint, nil)
 	if err != nil {
 		return ergTxs, fmt.Errorf("failed to build oracle transactions request - %s", err.Error())
 	}
@@ -76,7 +99,7 @@ func (e *Explorer) GetErgTx(unconfirmedTx string) (ErgTx, error) {
 	var ergTx ErgTx
 
 	endpoint := fmt.Sprintf("%s%s%s", e.url.String(), getErgTxsEndpoint, unconfirmedTx)
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(e.context(), "GET", endpoint, nil)
 	if err != nil {
 		return ergTx, fmt.Errorf("failed to build explorer transaction request - %s", err.Error())
 	}
@@ -92,6 +115,10 @@ func (e *Explorer) GetErgTx(unconfirmedTx string) (ErgTx, error) {
 		return ergTx, fmt.Errorf("error reading erg tx body - %s", err.Error())
 	}
 
+	if resp.StatusCode == 404 {
+		return ergTx, ErrTxNotFound
+	}
+
 	if resp.StatusCode != 200 {
 		return ergTx, fmt.Errorf("http status code != 200 - %s", resp.Status)
 	}
@@ -102,4 +129,106 @@ func (e *Explorer) GetErgTx(unconfirmedTx string) (ErgTx, error) {
 	}
 
 	return ergTx, nil
-}
\ No newline at end of file
+}
+
+// GetBox returns a box whether it is spent or not, unlike the node which only
+// knows the unspent ones.
+func (e *Explorer) GetBox(boxId string) (ErgTxOutput, error) {
+	var box ErgTxOutput
+
+	endpoint := fmt.Sprintf("%s%s%s", e.url.String(), getBoxEndpoint, boxId)
+	req, err := retryablehttp.NewRequestWithContext(e.context(), "GET", endpoint, nil)
+	if err != nil {
+		return box, fmt.Errorf("failed to build explorer box request - %s", err.Error())
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return box, fmt.Errorf("error calling ergo api explorer - %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return box, fmt.Errorf("error reading erg box body - %s", err.Error())
+	}
+
+	if resp.StatusCode == 404 {
+		return box, ErrBoxNotFound
+	}
+
+	if resp.StatusCode != 200 {
+		return box, fmt.Errorf("http status code != 200 - %s", resp.Status)
+	}
+
+	err = json.Unmarshal(body, &box)
+	if err != nil {
+		return box, fmt.Errorf("error unmarshalling erg box - %s", err.Error())
+	}
+
+	return box, nil
+}
+
+func (e *Explorer) GetUnspentBoxes(address string, limit, offset int) (ExplorerBoxes, error) {
+	var boxes ExplorerBoxes
+
+	endpoint := fmt.Sprintf("%s%s%s?limit=%d&offset=%d", e.url.String(), getUnspentBoxes, address, limit, offset)
+	req, err := retryablehttp.NewRequestWithContext(e.context(), "GET", endpoint, nil)
+	if err != nil {
+		return boxes, fmt.Errorf("failed to build unspent boxes request - %s", err.Error())
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return boxes, fmt.Errorf("error calling ergo api explorer - %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return boxes, fmt.Errorf("error reading unspent boxes body - %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		return boxes, fmt.Errorf("http status code != 200 - %s", resp.Status)
+	}
+
+	err = json.Unmarshal(body, &boxes)
+	if err != nil {
+		return boxes, fmt.Errorf("error unmarshalling unspent boxes - %s", err.Error())
+	}
+
+	return boxes, nil
+}
+
+func (e *Explorer) GetConfirmedBalance(address string) (AddressBalance, error) {
+	var balance AddressBalance
+
+	endpoint := fmt.Sprintf("%s%s%s/balance/confirmed", e.url.String(), getAddresses, address)
+	req, err := retryablehttp.NewRequestWithContext(e.context(), "GET", endpoint, nil)
+	if err != nil {
+		return balance, fmt.Errorf("failed to build address balance request - %s", err.Error())
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return balance, fmt.Errorf("error calling ergo api explorer - %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return balance, fmt.Errorf("error reading address balance body - %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		return balance, fmt.Errorf("http status code != 200 - %s", resp.Status)
+	}
+
+	err = json.Unmarshal(body, &balance)
+	if err != nil {
+		return balance, fmt.Errorf("error unmarshalling address balance - %s", err.Error())
+	}
+
+	return balance, nil
+}
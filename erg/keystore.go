@@ -0,0 +1,181 @@
+package erg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	keystoreCipher  = "aes-256-gcm"
+	keystoreKdf     = "scrypt"
+
+	scryptN     = 1 << 18
+	scryptR     = 8
+	scryptP     = 1
+	scryptDKLen = 32
+)
+
+var (
+	ErrKeystoreDecrypt = errors.New("failed to decrypt keystore, wrong password or corrupted file")
+)
+
+// Keystore is the on disk format of an encrypted secret key.
+type Keystore struct {
+	Version int            `json:"version"`
+	Address string         `json:"address"`
+	Crypto  KeystoreCrypto `json:"crypto"`
+}
+
+type KeystoreCrypto struct {
+	Cipher     string    `json:"cipher"`
+	CipherText string    `json:"ciphertext"`
+	Nonce      string    `json:"nonce"`
+	Kdf        string    `json:"kdf"`
+	KdfParams  KdfParams `json:"kdfparams"`
+}
+
+type KdfParams struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// EncryptKeystore encrypts the secret with a key derived from password.
+func EncryptKeystore(sk *SecretKey, password string, network byte) (*Keystore, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate keystore salt - %s", err.Error())
+	}
+
+	params := KdfParams{
+		N:     scryptN,
+		R:     scryptR,
+		P:     scryptP,
+		DKLen: scryptDKLen,
+		Salt:  hex.EncodeToString(salt),
+	}
+
+	gcm, err := keystoreAEAD(password, params)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate keystore nonce - %s", err.Error())
+	}
+
+	return &Keystore{
+		Version: keystoreVersion,
+		Address: sk.Address(network).String(),
+		Crypto: KeystoreCrypto{
+			Cipher:     keystoreCipher,
+			CipherText: hex.EncodeToString(gcm.Seal(nil, nonce, sk.Bytes(), nil)),
+			Nonce:      hex.EncodeToString(nonce),
+			Kdf:        keystoreKdf,
+			KdfParams:  params,
+		},
+	}, nil
+}
+
+// Decrypt returns the secret key stored in the keystore.
+func (ks *Keystore) Decrypt(password string) (*SecretKey, error) {
+	if ks.Version != keystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", ks.Version)
+	}
+	if ks.Crypto.Cipher != keystoreCipher || ks.Crypto.Kdf != keystoreKdf {
+		return nil, fmt.Errorf("unsupported keystore cipher '%s' or kdf '%s'", ks.Crypto.Cipher, ks.Crypto.Kdf)
+	}
+
+	gcm, err := keystoreAEAD(password, ks.Crypto.KdfParams)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hex.DecodeString(ks.Crypto.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("keystore nonce is not valid hex - %s", err.Error())
+	}
+	ct, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("keystore ciphertext is not valid hex - %s", err.Error())
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("keystore nonce has length %d", len(nonce))
+	}
+
+	secret, err := gcm.Open(nil, nonce, ct, nil)
+	if err != nil {
+		return nil, ErrKeystoreDecrypt
+	}
+
+	return NewSecretKey(secret)
+}
+
+// LoadKeystore reads and decrypts a keystore file.
+func LoadKeystore(path, password string) (*SecretKey, error) {
+	var ks Keystore
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore file - %s", err.Error())
+	}
+
+	err = json.Unmarshal(data, &ks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal keystore file - %s", err.Error())
+	}
+
+	return ks.Decrypt(password)
+}
+
+// WriteKeystore encrypts the secret and writes it to path readable only by
+// the current user.
+func WriteKeystore(path string, sk *SecretKey, password string, network byte) error {
+	ks, err := EncryptKeystore(sk, password, network)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal keystore - %s", err.Error())
+	}
+
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write keystore file - %s", err.Error())
+	}
+
+	return nil
+}
+
+func keystoreAEAD(password string, params KdfParams) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("keystore salt is not valid hex - %s", err.Error())
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive keystore key - %s", err.Error())
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keystore cipher - %s", err.Error())
+	}
+
+	return cipher.NewGCM(block)
+}
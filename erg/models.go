@@ -25,23 +25,53 @@ type ErgTxUnconfirmed struct {
 
 type ErgTxOutput struct {
 	BoxId               string    `json:"boxId"`
+	Value               int       `json:"value"`
+	Address             string    `json:"address"`
+	Assets              []Tokens  `json:"assets,omitempty"`
 	AdditionalRegisters Registers `json:"additionalRegisters,omitempty"`
 	ErgoTree            string    `json:"ergoTree"`
 }
 
 type ErgTxOutputNode struct {
 	BoxId               string        `json:"boxId"`
+	Value               int           `json:"value"`
 	Assets              []Tokens      `json:"assets,omitempty"`
 	AdditionalRegisters RegistersNode `json:"additionalRegisters,omitempty"`
 	ErgoTree            string        `json:"ergoTree"`
+	CreationHeight      int           `json:"creationHeight"`
 	TxId                string        `json:"transactionId"`
 }
 
+type ExplorerBoxes struct {
+	Items []ExplorerBox `json:"items"`
+	Total int           `json:"total"`
+}
+
+type ExplorerBox struct {
+	BoxId  string   `json:"boxId"`
+	Value  int      `json:"value"`
+	Assets []Tokens `json:"assets"`
+}
+
+type AddressBalance struct {
+	NanoErgs int      `json:"nanoErgs"`
+	Tokens   []Tokens `json:"tokens"`
+}
+
 type ErgHeader []struct {
 	Timestamp int `json:"timestamp"`
 	Height    int `json:"height"`
 }
 
+// NodeInfo is the part of the node /info response telling how far the node is
+// synced. FullHeight is zero while the node has not applied any full block.
+type NodeInfo struct {
+	FullHeight    int `json:"fullHeight"`
+	HeadersHeight int `json:"headersHeight"`
+	MaxPeerHeight int `json:"maxPeerHeight"`
+	PeersCount    int `json:"peersCount"`
+}
+
 type Tokens struct {
 	TokenId string `json:"tokenId"`
 	Amount  int    `json:"amount"`
@@ -55,6 +85,7 @@ type Serialized struct {
 type Registers struct {
 	R4 Reg `json:"R4"`
 	R5 Reg `json:"R5"`
+	R6 Reg `json:"R6"`
 }
 
 type RegistersNode struct {
@@ -2,6 +2,7 @@ package erg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,20 +11,22 @@ import (
 
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/nightowlcasino/nightowl/config"
-	"github.com/spf13/viper"
 )
 
 var (
 	walletLock        				= "/wallet/lock"
 	walletUnlock      				= "/wallet/unlock"
 	postErgTx         				= "/wallet/transaction/send"
+	postTx            				= "/transactions"
 	getUtxoBox        				= "/utxo/byId/"
 	getLastHeaders    				= "/blocks/lastHeaders/1"
 	getUnconfirmedTxs 				= "/transactions/unconfirmed"
+	getUnconfirmedTx  				= "/transactions/unconfirmed/byTransactionId/"
 	getUnconfirmedOutputsByErgoTree = "/transactions/unconfirmed/outputs/byErgoTree"
 	getTxFee          				= "/transactions/getFee"
 	ergoTreeToAddr    				= "/utils/ergoTreeToAddress/"
 	serializeBox      				= "/utxo/withPool/byIdBinary/"
+	getInfo           				= "/info"
 )
 
 type ErgNode struct {
@@ -33,37 +36,54 @@ type ErgNode struct {
 	pass string
 	apiKey string
 	walletPass string
+	ctx context.Context
 }
 
 func NewErgNode(client *retryablehttp.Client) (*ErgNode, error) {
 	var node *ErgNode
 
 	config.SetNodeDefaults()
+	conf := config.Current().ErgoNode
 
 	var u = &url.URL{
-		Scheme: viper.Get("ergo_node.scheme").(string),
-		Host: viper.Get("ergo_node.fqdn").(string)+":"+strconv.Itoa(viper.Get("ergo_node.port").(int)),
+		Scheme: conf.Scheme,
+		Host: conf.FQDN+":"+strconv.Itoa(conf.Port),
 	}
 
 	node = &ErgNode{
 		client:     client,
 		url:        u,
-	    user:       viper.Get("ergo_node.user").(string),
-	    pass:       viper.Get("ergo_node.password").(string),
-	    apiKey:     viper.Get("ergo_node.api_key").(string),
-	    walletPass: viper.Get("ergo_node.wallet_password").(string),
+	    user:       conf.User,
+	    pass:       conf.Password,
+	    apiKey:     conf.ApiKey,
+	    walletPass: conf.WalletPassword,
 	}
 
 	return node, nil
 }
 
+// WithContext returns a copy of the node client whose requests are made with
+// ctx, so that they are part of the trace of the bet they are made for.
+func (n *ErgNode) WithContext(ctx context.Context) *ErgNode {
+	c := *n
+	c.ctx = ctx
+	return &c
+}
+
+func (n *ErgNode) context() context.Context {
+	if n.ctx == nil {
+		return context.Background()
+	}
+	return n.ctx
+}
+
 func (n *ErgNode) unlockWallet() ([]byte, error) {
 	var ret []byte
 
 	endpoint := fmt.Sprintf("%s%s", n.url.String(), walletUnlock)
 	body := bytes.NewBuffer([]byte(fmt.Sprintf("{\"pass\": \"%s\"}", n.walletPass)))
 
-	req, err := retryablehttp.NewRequest("POST", endpoint, body)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "POST", endpoint, body)
 	if err != nil {
 		return ret, fmt.Errorf("error creating erg node unlock wallet request - %s", err.Error())
 	}
@@ -89,7 +109,7 @@ func (n *ErgNode) lockWallet() ([]byte, error) {
 
 	endpoint := fmt.Sprintf("%s%s", n.url.String(), walletLock)
 
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
 	if err != nil {
 		return ret, fmt.Errorf("error creating erg node lock wallet request - %s", err.Error())
 	}
@@ -116,7 +136,7 @@ func (n *ErgNode) GetCurrenHeight() (int, error) {
 
 	endpoint := fmt.Sprintf("%s%s", n.url.String(), getLastHeaders)
 
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
 	if err != nil {
 		return height, fmt.Errorf("error creating block last headers request - %s", err.Error())
 	}
@@ -144,12 +164,44 @@ func (n *ErgNode) GetCurrenHeight() (int, error) {
 	return height, nil
 }
 
+// GetNodeInfo returns the sync state of the node.
+func (n *ErgNode) GetNodeInfo() (NodeInfo, error) {
+	var info NodeInfo
+
+	endpoint := fmt.Sprintf("%s%s", n.url.String(), getInfo)
+
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
+	if err != nil {
+		return info, fmt.Errorf("error creating node info request - %s", err.Error())
+	}
+	req.SetBasicAuth(n.user, n.pass)
+	req.Header.Set("api_key", n.apiKey)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return info, fmt.Errorf("error calling node info - %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return info, fmt.Errorf("error parsing node info response - %s", err.Error())
+	}
+
+	err = json.Unmarshal(body, &info)
+	if err != nil {
+		return info, fmt.Errorf("error unmarshalling node info response - %s", err.Error())
+	}
+
+	return info, nil
+}
+
 func (n *ErgNode) GetUnconfirmedTxs(limit, offset int) ([]ErgTxUnconfirmed, error) {
 	var txs []ErgTxUnconfirmed
 
 	endpoint := fmt.Sprintf("%s%s?limit=%d&offset=%d", n.url.String(), getUnconfirmedTxs, limit, offset)
 
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
 	if err != nil {
 		return txs, fmt.Errorf("error creating unconfirmed txs request - %s", err.Error())
 	}
@@ -186,7 +238,7 @@ func (n *ErgNode) GetUnconfirmedOutputsByErgoTree(ergoTree string, limit, offset
 		return outputs, fmt.Errorf("error marshalling unconfirmed tx outputs payload - %s", err.Error())
 	}
 
-	req, err := retryablehttp.NewRequest("POST", endpoint, bytes.NewBuffer(payload))
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "POST", endpoint, bytes.NewBuffer(payload))
 	if err != nil {
 		return outputs, fmt.Errorf("error creating unconfirmed tx outputs request - %s", err.Error())
 	}
@@ -226,7 +278,7 @@ func (n *ErgNode) PostErgOracleTx(payload []byte) ([]byte, error) {
 	endpoint := fmt.Sprintf("%s%s", n.url.String(), postErgTx)
 	body := bytes.NewBuffer(payload)
 
-	req, err := retryablehttp.NewRequest("POST", endpoint, body)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "POST", endpoint, body)
 	if err != nil {
 		return ret, fmt.Errorf("error creating postErgOracleTx request - %s", err.Error())
 	}
@@ -252,12 +304,51 @@ func (n *ErgNode) PostErgOracleTx(payload []byte) ([]byte, error) {
 	return ret, nil
 }
 
+// SubmitTx sends an already signed tx to the node mempool and returns the
+// node response containing the tx id.
+func (n *ErgNode) SubmitTx(tx SignedTx) ([]byte, error) {
+	var ret []byte
+
+	payload, err := json.Marshal(tx)
+	if err != nil {
+		return ret, fmt.Errorf("error marshalling signed tx - %s", err.Error())
+	}
+
+	endpoint := fmt.Sprintf("%s%s", n.url.String(), postTx)
+
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "POST", endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return ret, fmt.Errorf("error creating submitTx request - %s", err.Error())
+	}
+	req.SetBasicAuth(n.user, n.pass)
+	req.Header.Set("api_key", n.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return ret, fmt.Errorf("error submitting signed erg tx to node - %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	ret, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return ret, fmt.Errorf("error parsing submit tx response - %s", err.Error())
+	}
+
+	// Some was wrong, report the error
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("response status code %d - %s", resp.StatusCode, string(ret))
+	}
+
+	return ret, nil
+}
+
 func (n *ErgNode) SerializeErgBox(boxId string) (string, error) {
 	var bytes Serialized
 
 	endpoint := fmt.Sprintf("%s%s%s", n.url.String(), serializeBox, boxId)
 
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
 	if err != nil {
 		return bytes.Bytes, fmt.Errorf("error creating SerializeErgBox request - %s", err.Error())
 	}
@@ -286,7 +377,7 @@ func (n *ErgNode) GetErgUtxoBox(boxId string) (ErgTxOutputNode, error) {
 
 	endpoint := fmt.Sprintf("%s%s%s", n.url.String(), getUtxoBox, boxId)
 
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
 	if err != nil {
 		return utxo, fmt.Errorf("error creating getErgBoxes request - %s", err.Error())
 	}
@@ -314,12 +405,48 @@ func (n *ErgNode) GetErgUtxoBox(boxId string) (ErgTxOutputNode, error) {
 	return utxo, nil
 }
 
+// GetUnconfirmedTx returns a tx from the mempool of the node, the tx is empty
+// if the node does not know about it.
+func (n *ErgNode) GetUnconfirmedTx(txId string) (ErgTxUnconfirmed, error) {
+	var tx ErgTxUnconfirmed
+
+	endpoint := fmt.Sprintf("%s%s%s", n.url.String(), getUnconfirmedTx, txId)
+
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
+	if err != nil {
+		return tx, fmt.Errorf("error creating getUnconfirmedTx request - %s", err.Error())
+	}
+	req.SetBasicAuth(n.user, n.pass)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return tx, fmt.Errorf("error getting unconfirmed tx - %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return tx, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return tx, fmt.Errorf("error parsing unconfirmed tx response - %s", err.Error())
+	}
+
+	err = json.Unmarshal(body, &tx)
+	if err != nil {
+		return tx, fmt.Errorf("error unmarshalling unconfirmed tx response - %s", err.Error())
+	}
+
+	return tx, nil
+}
+
 func (n *ErgNode) ErgoTreeToAddress(ergoTree string) (string, error) {
 	var address map[string]interface{}
 
 	endpoint := fmt.Sprintf("%s%s%s", n.url.String(), ergoTreeToAddr, ergoTree)
 
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
 	if err != nil {
 		return "", fmt.Errorf("error creating ergoTreeToAddress request - %s", err.Error())
 	}
@@ -348,7 +475,7 @@ func (n *ErgNode) GetTxFee(txSize int) (int, error) {
 
 	endpoint := fmt.Sprintf("%s%s?waitTime=1&txSize=%d", n.url.String(), getTxFee, txSize)
 
-	req, err := retryablehttp.NewRequest("GET", endpoint, nil)
+	req, err := retryablehttp.NewRequestWithContext(n.context(), "GET", endpoint, nil)
 	if err != nil {
 		return fee, fmt.Errorf("error creating getTxFee request - %s", err.Error())
 	}
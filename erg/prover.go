@@ -0,0 +1,236 @@
+package erg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// soundnessBytes is the length of the Fiat-Shamir challenge
+	soundnessBytes = 24
+	// schnorrProofLength is the challenge followed by the 32 byte response
+	schnorrProofLength = soundnessBytes + 32
+)
+
+var (
+	ErrInvalidSecret    = errors.New("invalid secret key")
+	ErrInvalidSignature = errors.New("invalid schnorr signature")
+)
+
+// SecretKey is a secp256k1 secret able to prove knowledge of the discrete log
+// of its public key (the ProveDlog sigma proposition behind P2PK addresses).
+type SecretKey struct {
+	key *secp256k1.PrivateKey
+}
+
+// ReducedInput describes what has to be proven to spend an input. An empty
+// PubKey means the input script reduced to true and needs no proof.
+type ReducedInput struct {
+	BoxId  string `json:"boxId"`
+	PubKey string `json:"pubKey,omitempty"`
+}
+
+// ReducedTx is an unsigned transaction whose input scripts have already been
+// reduced to the sigma propositions that must be proven.
+type ReducedTx struct {
+	Tx     UnsignedTx     `json:"unsignedTx"`
+	Inputs []ReducedInput `json:"reducedInputs"`
+}
+
+func NewSecretKey(secret []byte) (*SecretKey, error) {
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("secret must be 32 bytes, got %d - %w", len(secret), ErrInvalidSecret)
+	}
+
+	key := secp256k1.PrivKeyFromBytes(secret)
+	if key.Key.IsZero() {
+		return nil, ErrInvalidSecret
+	}
+
+	return &SecretKey{key: key}, nil
+}
+
+// PubKey returns the compressed public key.
+func (sk *SecretKey) PubKey() []byte {
+	return sk.key.PubKey().SerializeCompressed()
+}
+
+// Bytes returns the raw 32 byte secret.
+func (sk *SecretKey) Bytes() []byte {
+	return sk.key.Serialize()
+}
+
+// Address returns the P2PK address of the secret for the given network.
+func (sk *SecretKey) Address(network byte) Address {
+	return NewP2PKAddress(network, sk.PubKey())
+}
+
+// Sign produces a non-interactive schnorr proof of knowledge of the secret
+// bound to msg, in the format expected by ergo for a single ProveDlog leaf.
+func (sk *SecretKey) Sign(msg []byte) ([]byte, error) {
+	var r secp256k1.ModNScalar
+	var rnd [32]byte
+
+	for {
+		if _, err := rand.Read(rnd[:]); err != nil {
+			return nil, fmt.Errorf("failed to read randomness - %s", err.Error())
+		}
+		if overflow := r.SetBytes(&rnd); overflow == 0 && !r.IsZero() {
+			break
+		}
+	}
+
+	// commitment a = g^r
+	var a secp256k1.JacobianPoint
+	secp256k1.ScalarBaseMultNonConst(&r, &a)
+	a.ToAffine()
+	commitment := secp256k1.NewPublicKey(&a.X, &a.Y).SerializeCompressed()
+
+	challenge := fiatShamirChallenge(sk.PubKey(), commitment, msg)
+
+	// z = r + e*w mod n
+	var e, z secp256k1.ModNScalar
+	e.SetByteSlice(challenge)
+	z.Mul2(&e, &sk.key.Key).Add(&r)
+	zb := z.Bytes()
+
+	return append(challenge, zb[:]...), nil
+}
+
+// Verify checks a schnorr proof produced by Sign (or any ergo wallet signing
+// a message with a P2PK key) against the given compressed public key.
+func Verify(pubKey, msg, sig []byte) error {
+	if len(sig) != schnorrProofLength {
+		return fmt.Errorf("signature has length %d - %w", len(sig), ErrInvalidSignature)
+	}
+
+	pk, err := secp256k1.ParsePubKey(pubKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key - %s", err.Error())
+	}
+
+	var e, z secp256k1.ModNScalar
+	e.SetByteSlice(sig[:soundnessBytes])
+	if overflow := z.SetByteSlice(sig[soundnessBytes:]); overflow {
+		return ErrInvalidSignature
+	}
+
+	// a = g^z * h^-e
+	var gz, h, he, a secp256k1.JacobianPoint
+	secp256k1.ScalarBaseMultNonConst(&z, &gz)
+	pk.AsJacobian(&h)
+	secp256k1.ScalarMultNonConst(e.Negate(), &h, &he)
+	secp256k1.AddNonConst(&gz, &he, &a)
+	if a.Z.IsZero() {
+		return ErrInvalidSignature
+	}
+	a.ToAffine()
+	commitment := secp256k1.NewPublicKey(&a.X, &a.Y).SerializeCompressed()
+
+	if !bytes.Equal(fiatShamirChallenge(pubKey, commitment, msg), sig[:soundnessBytes]) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// VerifyAddress checks a signature of msg made with the key of a P2PK address.
+func VerifyAddress(addr string, msg, sig []byte) error {
+	a, err := DecodeAddress(addr)
+	if err != nil {
+		return err
+	}
+	if a.Type != P2PKType {
+		return fmt.Errorf("only p2pk addresses can sign messages - %w", ErrInvalidAddress)
+	}
+
+	return Verify(a.Content, msg, sig)
+}
+
+// SignReduced proves every input of a reduced transaction which requires the
+// public key of sk. Inputs locked by any other key cause an error.
+func (sk *SecretKey) SignReduced(rtx ReducedTx) (SignedTx, error) {
+	var signed SignedTx
+
+	if len(rtx.Inputs) != len(rtx.Tx.Inputs) {
+		return signed, fmt.Errorf("reduced tx has %d reduced inputs for %d inputs", len(rtx.Inputs), len(rtx.Tx.Inputs))
+	}
+
+	msg, err := rtx.Tx.BytesToSign()
+	if err != nil {
+		return signed, fmt.Errorf("failed to serialize unsigned tx - %s", err.Error())
+	}
+
+	txId := blake2b.Sum256(msg)
+	pubKey := hex.EncodeToString(sk.PubKey())
+
+	signed.Id = hex.EncodeToString(txId[:])
+	signed.DataInputs = rtx.Tx.DataInputs
+	signed.Outputs = rtx.Tx.Outputs
+	if signed.DataInputs == nil {
+		signed.DataInputs = []DataInput{}
+	}
+
+	for i, in := range rtx.Tx.Inputs {
+		var proof []byte
+
+		if rtx.Inputs[i].BoxId != in.BoxId {
+			return signed, fmt.Errorf("reduced input %d box id %s does not match tx input %s", i, rtx.Inputs[i].BoxId, in.BoxId)
+		}
+
+		switch rtx.Inputs[i].PubKey {
+		case "":
+		case pubKey:
+			proof, err = sk.Sign(msg)
+			if err != nil {
+				return signed, fmt.Errorf("failed to sign input %s - %s", in.BoxId, err.Error())
+			}
+		default:
+			return signed, fmt.Errorf("input %s requires a proof for unknown public key %s", in.BoxId, rtx.Inputs[i].PubKey)
+		}
+
+		ext := in.Extension
+		if ext == nil {
+			ext = map[string]string{}
+		}
+
+		signed.Inputs = append(signed.Inputs, SignedInput{
+			BoxId: in.BoxId,
+			SpendingProof: SpendingProof{
+				ProofBytes: hex.EncodeToString(proof),
+				Extension:  ext,
+			},
+		})
+	}
+
+	return signed, nil
+}
+
+// fiatShamirChallenge hashes the serialized proof tree of a single ProveDlog
+// leaf together with the message and truncates it to the soundness length.
+func fiatShamirChallenge(pubKey, commitment, msg []byte) []byte {
+	var w bytes.Buffer
+
+	// ErgoTree with constant segregation holding SigmaPropConstant(ProveDlog(pk))
+	prop := append([]byte{0x10, 0x01, 0x08, 0xcd}, pubKey...)
+	prop = append(prop, 0x73, 0x00)
+
+	// leaf prefix
+	w.WriteByte(0x01)
+	binary.Write(&w, binary.BigEndian, int16(len(prop)))
+	w.Write(prop)
+	binary.Write(&w, binary.BigEndian, int16(len(commitment)))
+	w.Write(commitment)
+	w.Write(msg)
+
+	sum := blake2b.Sum256(w.Bytes())
+
+	return sum[:soundnessBytes]
+}
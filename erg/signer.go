@@ -0,0 +1,385 @@
+package erg
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nightowlcasino/nightowl/config"
+)
+
+const (
+	minerFeeErgoTree = "1005040004000e36100204a00b08cd0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ea02d192a39a8cc7a701730073011001020402d19683030193a38cc7b2a57300000193c2b2a57301007473027303830108cdeeac93b1a57304"
+	minChangeValue   = 1000000 // 0.0010 ERG
+	unspentPageSize  = 50
+	// spentBoxTTL is how long a box spent by a submitted tx is kept from being
+	// spent again. Confirmed boxes are no longer listed by the explorer long
+	// before, a tx dropped from the mempool frees its boxes once it passes.
+	spentBoxTTL = 30 * time.Minute
+)
+
+var (
+	ErrUnsupportedInput = errors.New("input box can not be spent by the signer")
+	ErrMissingDataInput = errors.New("tx request has no data input")
+)
+
+// Signer signs and submits txs described by a node wallet payment request
+// (the /wallet/transaction/send payload) and returns the node response
+// containing the tx id. The requests made to do so are part of the trace in
+// ctx.
+type Signer interface {
+	SendTx(ctx context.Context, payload []byte) ([]byte, error)
+}
+
+// PaymentRequest is a single output of a node wallet payment request.
+type PaymentRequest struct {
+	Address   string            `json:"address"`
+	Value     int               `json:"value"`
+	Assets    []Tokens          `json:"assets,omitempty"`
+	Registers map[string]string `json:"registers,omitempty"`
+}
+
+// TxRequest is the node wallet payment request format used when building the
+// game result txs.
+type TxRequest struct {
+	Requests      []PaymentRequest `json:"requests"`
+	Fee           int              `json:"fee"`
+	InputsRaw     []string         `json:"inputsRaw"`
+	DataInputsRaw []string         `json:"dataInputsRaw"`
+}
+
+// NodeSigner hands the payment request to the node wallet which selects
+// inputs, signs and broadcasts the tx.
+type NodeSigner struct {
+	node *ErgNode
+}
+
+// LocalSigner builds and signs txs itself with a secret loaded from an
+// encrypted keystore. Inputs needed to pay for fees and box values are taken
+// from the P2PK address of the secret, and the signed tx is submitted through
+// the node /transactions endpoint.
+type LocalSigner struct {
+	node     *ErgNode
+	explorer *Explorer
+	secret   *SecretKey
+	address  string
+	ergoTree string
+	// ergoTrees of the game contracts, mapped to whether they read the oracle
+	// box on every spend
+	scripts map[string]bool
+	spent   *spentBoxes
+}
+
+// spentBoxes are the boxes of the signer spent by submitted txs which are not
+// confirmed yet. The explorer still lists them as unspent until they are.
+type spentBoxes struct {
+	mu    sync.Mutex
+	boxes map[string]time.Time
+}
+
+// reserve marks a box as spent and reports whether it was unspent before.
+func (b *spentBoxes) reserve(boxId string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for id, at := range b.boxes {
+		if now.Sub(at) >= spentBoxTTL {
+			delete(b.boxes, id)
+		}
+	}
+
+	if _, ok := b.boxes[boxId]; ok {
+		return false
+	}
+	b.boxes[boxId] = now
+	return true
+}
+
+// release makes boxes of a tx which was never submitted available again.
+func (b *spentBoxes) release(inputs []ReducedInput) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, in := range inputs {
+		delete(b.boxes, in.BoxId)
+	}
+}
+
+// NewSigner creates the signer configured by signer.type. scripts maps the
+// ergoTrees of the game contracts, whose boxes are spent without a proof, to
+// whether every spend of their boxes reads the oracle box as a data input.
+func NewSigner(node *ErgNode, explorer *Explorer, scripts map[string]bool) (Signer, error) {
+	conf := config.Current().Signer
+
+	switch conf.Type {
+	case "node":
+		return NewNodeSigner(node), nil
+	case "local":
+		network := MainnetPrefix
+		if conf.Network == "testnet" {
+			network = TestnetPrefix
+		}
+
+		secret, err := LoadKeystore(conf.KeystoreFile, conf.KeystorePassword)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewLocalSigner(node, explorer, secret, network, scripts)
+	default:
+		return nil, fmt.Errorf("unknown signer type '%s'", conf.Type)
+	}
+}
+
+func NewNodeSigner(node *ErgNode) *NodeSigner {
+	return &NodeSigner{node: node}
+}
+
+func (s *NodeSigner) SendTx(ctx context.Context, payload []byte) ([]byte, error) {
+	return s.node.WithContext(ctx).PostErgOracleTx(payload)
+}
+
+func NewLocalSigner(node *ErgNode, explorer *Explorer, secret *SecretKey, network byte, scripts map[string]bool) (*LocalSigner, error) {
+	addr := secret.Address(network)
+	tree, err := addr.ErgoTree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ergoTree of signer address - %s", err.Error())
+	}
+
+	return &LocalSigner{
+		node:     node,
+		explorer: explorer,
+		secret:   secret,
+		address:  addr.String(),
+		ergoTree: hex.EncodeToString(tree),
+		scripts:  scripts,
+		spent:    &spentBoxes{boxes: make(map[string]time.Time)},
+	}, nil
+}
+
+// Address returns the address whose boxes fund the txs built by the signer.
+func (s *LocalSigner) Address() string {
+	return s.address
+}
+
+func (s *LocalSigner) SendTx(ctx context.Context, payload []byte) ([]byte, error) {
+	var req TxRequest
+
+	err := json.Unmarshal(payload, &req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tx request - %s", err.Error())
+	}
+
+	// the signer is shared, its clients are only bound to ctx for this tx
+	signer := *s
+	signer.node = s.node.WithContext(ctx)
+	if s.explorer != nil {
+		signer.explorer = s.explorer.WithContext(ctx)
+	}
+
+	rtx, err := signer.Reduce(req)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := s.secret.SignReduced(rtx)
+	if err != nil {
+		s.spent.release(rtx.Inputs)
+		return nil, err
+	}
+
+	resp, err := signer.node.SubmitTx(signed)
+	if err != nil {
+		s.spent.release(rtx.Inputs)
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Reduce turns a payment request into a reduced tx. The raw inputs of the
+// request must either belong to the signer or be guarded by one of the
+// scripts of the signer. Script inputs get no proof, whether their script
+// accepts the tx is only checked by the node, and a request spending a script
+// which always reads the oracle box without a data input fails with
+// ErrMissingDataInput. Any other input fails with ErrUnsupportedInput. Every
+// box added to balance the tx belongs to the signer and is kept from other
+// txs until it is confirmed as spent.
+func (s *LocalSigner) Reduce(req TxRequest) (ReducedTx, error) {
+	var rtx ReducedTx
+
+	height, err := s.node.GetCurrenHeight()
+	if err != nil {
+		return rtx, fmt.Errorf("failed to get current height - %s", err.Error())
+	}
+
+	pubKey := hex.EncodeToString(s.secret.PubKey())
+	oracleInputs := 0
+	inErg := 0
+	inTokens := make(map[string]int)
+	outErg := req.Fee
+	outTokens := make(map[string]int)
+
+	for _, raw := range req.InputsRaw {
+		boxId, err := BoxIdFromBytes(raw)
+		if err != nil {
+			return rtx, err
+		}
+
+		box, err := s.node.GetErgUtxoBox(boxId)
+		if err != nil {
+			return rtx, fmt.Errorf("failed to get input box %s - %s", boxId, err.Error())
+		}
+		if box.BoxId == "" {
+			return rtx, fmt.Errorf("input box %s is spent or unknown", boxId)
+		}
+
+		input := ReducedInput{BoxId: boxId}
+		readsOracle, isScript := s.scripts[box.ErgoTree]
+		switch {
+		case box.ErgoTree == s.ergoTree:
+			input.PubKey = pubKey
+		case !isScript:
+			return rtx, fmt.Errorf("input box %s is guarded by an unknown script - %w", boxId, ErrUnsupportedInput)
+		case readsOracle:
+			oracleInputs++
+		}
+
+		inErg += box.Value
+		for _, t := range box.Assets {
+			inTokens[t.TokenId] += t.Amount
+		}
+
+		rtx.Tx.Inputs = append(rtx.Tx.Inputs, UnsignedInput{BoxId: boxId})
+		rtx.Inputs = append(rtx.Inputs, input)
+	}
+
+	if oracleInputs > 0 && len(req.DataInputsRaw) == 0 {
+		return rtx, fmt.Errorf("%d input boxes need the oracle box - %w", oracleInputs, ErrMissingDataInput)
+	}
+
+	for _, raw := range req.DataInputsRaw {
+		boxId, err := BoxIdFromBytes(raw)
+		if err != nil {
+			return rtx, err
+		}
+		rtx.Tx.DataInputs = append(rtx.Tx.DataInputs, DataInput{BoxId: boxId})
+	}
+
+	for _, r := range req.Requests {
+		tree, err := AddressToErgoTree(r.Address)
+		if err != nil {
+			return rtx, fmt.Errorf("failed to get ergoTree of request address %s - %s", r.Address, err.Error())
+		}
+
+		outErg += r.Value
+		for _, t := range r.Assets {
+			outTokens[t.TokenId] += t.Amount
+		}
+
+		rtx.Tx.Outputs = append(rtx.Tx.Outputs, newBoxCandidate(r.Value, tree, height, r.Assets, r.Registers))
+	}
+
+	// add boxes of the signer until every output and a valid change box are
+	// covered, skipping the boxes spent by txs still in the mempool
+	var funding []ReducedInput
+	offset := 0
+	for !balanced(inErg, outErg, inTokens, outTokens) {
+		boxes, err := s.explorer.GetUnspentBoxes(s.address, unspentPageSize, offset)
+		if err != nil {
+			s.spent.release(funding)
+			return rtx, fmt.Errorf("failed to get unspent boxes of signer - %s", err.Error())
+		}
+		if len(boxes.Items) == 0 {
+			s.spent.release(funding)
+			return rtx, fmt.Errorf("not enough funds in %s to cover the tx", s.address)
+		}
+		offset += unspentPageSize
+
+		for _, box := range boxes.Items {
+			if !s.spent.reserve(box.BoxId) {
+				continue
+			}
+			funding = append(funding, ReducedInput{BoxId: box.BoxId, PubKey: pubKey})
+
+			inErg += box.Value
+			for _, t := range box.Assets {
+				inTokens[t.TokenId] += t.Amount
+			}
+
+			rtx.Tx.Inputs = append(rtx.Tx.Inputs, UnsignedInput{BoxId: box.BoxId})
+			rtx.Inputs = append(rtx.Inputs, ReducedInput{BoxId: box.BoxId, PubKey: pubKey})
+
+			if balanced(inErg, outErg, inTokens, outTokens) {
+				break
+			}
+		}
+	}
+
+	// change output, returning leftover erg and tokens to the signer
+	var change []Tokens
+	for id, amt := range inTokens {
+		if amt > outTokens[id] {
+			change = append(change, Tokens{TokenId: id, Amount: amt - outTokens[id]})
+		}
+	}
+	sort.Slice(change, func(i, j int) bool { return change[i].TokenId < change[j].TokenId })
+	if inErg > outErg {
+		rtx.Tx.Outputs = append(rtx.Tx.Outputs, newBoxCandidate(inErg-outErg, s.ergoTree, height, change, nil))
+	}
+
+	rtx.Tx.Outputs = append(rtx.Tx.Outputs, newBoxCandidate(req.Fee, minerFeeErgoTree, height, nil, nil))
+
+	return rtx, nil
+}
+
+// newBoxCandidate returns an output whose assets and registers are empty
+// rather than nil, the node does not accept null for either.
+func newBoxCandidate(value int, tree string, height int, assets []Tokens, regs map[string]string) BoxCandidate {
+	if assets == nil {
+		assets = []Tokens{}
+	}
+	if regs == nil {
+		regs = map[string]string{}
+	}
+
+	return BoxCandidate{
+		Value:               value,
+		ErgoTree:            tree,
+		CreationHeight:      height,
+		Assets:              assets,
+		AdditionalRegisters: regs,
+	}
+}
+
+// balanced reports whether the inputs cover the outputs while leaving either
+// nothing or enough erg for a change box.
+func balanced(inErg, outErg int, inTokens, outTokens map[string]int) bool {
+	hasChangeTokens := false
+	for id, amt := range outTokens {
+		if inTokens[id] < amt {
+			return false
+		}
+	}
+	for id, amt := range inTokens {
+		if amt > outTokens[id] {
+			hasChangeTokens = true
+		}
+	}
+
+	change := inErg - outErg
+	switch {
+	case change < 0:
+		return false
+	case change == 0:
+		return !hasChangeTokens
+	default:
+		return change >= minChangeValue
+	}
+}
@@ -0,0 +1,323 @@
+package erg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSecret(t *testing.T) *SecretKey {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	require.NoError(t, err)
+
+	sk, err := NewSecretKey(secret)
+	require.NoError(t, err)
+
+	return sk
+}
+
+func TestDecodeAddress(t *testing.T) {
+	oracleAddress := "4FC5xSYb7zfRdUhm6oRmE11P2GJqSMY8UARPbHkmXEq6hTinXq4XNWdJs73BEV44MdmJ49Qo"
+	testCases := []struct {
+		name     string
+		input    string
+		wantType byte
+		wantErr  bool
+	}{
+		{
+			"TestOracleAddress",
+			oracleAddress,
+			P2SType,
+			false,
+		},
+		{
+			"TestBadChecksum",
+			oracleAddress[:len(oracleAddress)-1] + "1",
+			0,
+			true,
+		},
+		{
+			"TestBadCharacter",
+			"0OIl",
+			0,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, err := DecodeAddress(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantType, addr.Type)
+			assert.Equal(t, MainnetPrefix, addr.Network)
+			assert.Equal(t, tc.input, addr.String())
+		})
+	}
+}
+
+func TestP2PKAddressErgoTree(t *testing.T) {
+	sk := newTestSecret(t)
+
+	addr, err := DecodeAddress(sk.Address(TestnetPrefix).String())
+	require.NoError(t, err)
+	assert.Equal(t, TestnetPrefix, addr.Network)
+	assert.Equal(t, P2PKType, addr.Type)
+
+	tree, err := addr.ErgoTree()
+	require.NoError(t, err)
+	assert.Equal(t, "0008cd"+hex.EncodeToString(sk.PubKey()), hex.EncodeToString(tree))
+}
+
+func TestSignVerify(t *testing.T) {
+	sk := newTestSecret(t)
+	other := newTestSecret(t)
+	msg := []byte("nightowl")
+
+	sig, err := sk.Sign(msg)
+	require.NoError(t, err)
+	assert.Len(t, sig, schnorrProofLength)
+
+	assert.NoError(t, Verify(sk.PubKey(), msg, sig))
+	assert.ErrorIs(t, Verify(sk.PubKey(), []byte("nightOwl"), sig), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(other.PubKey(), msg, sig), ErrInvalidSignature)
+}
+
+func TestVerifyAddress(t *testing.T) {
+	sk := newTestSecret(t)
+	other := newTestSecret(t)
+	msg := []byte("nightowl")
+
+	sig, err := sk.Sign(msg)
+	require.NoError(t, err)
+
+	assert.NoError(t, VerifyAddress(sk.Address(MainnetPrefix).String(), msg, sig))
+	assert.ErrorIs(t, VerifyAddress(other.Address(MainnetPrefix).String(), msg, sig), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifyAddress("not-an-address", msg, sig), ErrInvalidAddress)
+}
+
+func TestSignReduced(t *testing.T) {
+	sk := newTestSecret(t)
+	pubKey := hex.EncodeToString(sk.PubKey())
+	boxA := hex.EncodeToString(make([]byte, 32))
+	boxB := "01" + boxA[2:]
+
+	rtx := ReducedTx{
+		Tx: UnsignedTx{
+			Inputs: []UnsignedInput{{BoxId: boxA}, {BoxId: boxB}},
+			Outputs: []BoxCandidate{{
+				Value:               minChangeValue,
+				ErgoTree:            minerFeeErgoTree,
+				CreationHeight:      800000,
+				AdditionalRegisters: map[string]string{"R4": "0400"},
+			}},
+		},
+		Inputs: []ReducedInput{{BoxId: boxA}, {BoxId: boxB, PubKey: pubKey}},
+	}
+
+	signed, err := sk.SignReduced(rtx)
+	require.NoError(t, err)
+
+	txId, err := rtx.Tx.Id()
+	require.NoError(t, err)
+	assert.Equal(t, txId, signed.Id)
+
+	msg, err := rtx.Tx.BytesToSign()
+	require.NoError(t, err)
+
+	assert.Empty(t, signed.Inputs[0].SpendingProof.ProofBytes)
+	proof, err := hex.DecodeString(signed.Inputs[1].SpendingProof.ProofBytes)
+	require.NoError(t, err)
+	assert.NoError(t, Verify(sk.PubKey(), msg, proof))
+
+	// inputs locked by someone else can't be signed
+	rtx.Inputs[0].PubKey = hex.EncodeToString(newTestSecret(t).PubKey())
+	_, err = sk.SignReduced(rtx)
+	assert.Error(t, err)
+}
+
+func TestKeystore(t *testing.T) {
+	sk := newTestSecret(t)
+	path := filepath.Join(t.TempDir(), "house.keystore")
+
+	err := WriteKeystore(path, sk, "owls", MainnetPrefix)
+	require.NoError(t, err)
+
+	loaded, err := LoadKeystore(path, "owls")
+	require.NoError(t, err)
+	assert.Equal(t, sk.Bytes(), loaded.Bytes())
+
+	_, err = LoadKeystore(path, "bats")
+	assert.ErrorIs(t, err, ErrKeystoreDecrypt)
+}
+
+func TestLocalSignerReduceInputs(t *testing.T) {
+	sk := newTestSecret(t)
+	addr := sk.Address(MainnetPrefix)
+	tree, err := addr.ErgoTree()
+	require.NoError(t, err)
+
+	script := "1001"
+	other, err := newTestSecret(t).Address(MainnetPrefix).ErgoTree()
+	require.NoError(t, err)
+
+	// every input box is worth the output and the fee, its bytes are its tree
+	boxes := make(map[string]ErgTxOutputNode)
+	for _, tree := range []string{hex.EncodeToString(tree), script, hex.EncodeToString(other)} {
+		boxId, err := BoxIdFromBytes(tree)
+		require.NoError(t, err)
+		boxes[boxId] = ErgTxOutputNode{BoxId: boxId, Value: 2 * minChangeValue, ErgoTree: tree}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == getLastHeaders {
+			w.Write([]byte(`[{"height":800000}]`))
+			return
+		}
+		json.NewEncoder(w).Encode(boxes[strings.TrimPrefix(r.URL.Path, getUtxoBox)])
+	}))
+	defer srv.Close()
+
+	viper.Reset()
+	defer viper.Reset()
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	viper.Set("ergo_node.scheme", "http")
+	viper.Set("ergo_node.fqdn", u.Hostname())
+	viper.Set("ergo_node.port", port)
+
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	client.RetryMax = 0
+	node, err := NewErgNode(client)
+	require.NoError(t, err)
+
+	signer, err := NewLocalSigner(node, nil, sk, MainnetPrefix, map[string]bool{script: true})
+	require.NoError(t, err)
+
+	request := func(input string) TxRequest {
+		return TxRequest{
+			Requests:      []PaymentRequest{{Address: addr.String(), Value: minChangeValue}},
+			Fee:           minChangeValue,
+			InputsRaw:     []string{input},
+			DataInputsRaw: []string{"ab"},
+		}
+	}
+
+	// boxes of the signer are signed with its key
+	rtx, err := signer.Reduce(request(hex.EncodeToString(tree)))
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sk.PubKey()), rtx.Inputs[0].PubKey)
+
+	// boxes of the scripts of the signer are spent without a proof
+	rtx, err = signer.Reduce(request(script))
+	require.NoError(t, err)
+	assert.Empty(t, rtx.Inputs[0].PubKey)
+
+	// as long as the tx has the data input the scripts read
+	req := request(script)
+	req.DataInputsRaw = nil
+	_, err = signer.Reduce(req)
+	assert.ErrorIs(t, err, ErrMissingDataInput)
+
+	// boxes of anyone else can't be spent
+	_, err = signer.Reduce(request(hex.EncodeToString(other)))
+	assert.ErrorIs(t, err, ErrUnsupportedInput)
+}
+
+func TestLocalSignerFunding(t *testing.T) {
+	sk := newTestSecret(t)
+	addr := sk.Address(MainnetPrefix)
+
+	// the signer holds two boxes, each enough to fund one tx
+	boxes := ExplorerBoxes{Items: []ExplorerBox{
+		{BoxId: strings.Repeat("01", 32), Value: 3 * minChangeValue},
+		{BoxId: strings.Repeat("02", 32), Value: 3 * minChangeValue},
+	}}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == getLastHeaders:
+			w.Write([]byte(`[{"height":800000}]`))
+		case r.URL.Query().Get("offset") == "0":
+			json.NewEncoder(w).Encode(boxes)
+		default:
+			json.NewEncoder(w).Encode(ExplorerBoxes{})
+		}
+	}))
+	defer srv.Close()
+
+	viper.Reset()
+	defer viper.Reset()
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	for _, prefix := range []string{"ergo_node", "explorer_node"} {
+		viper.Set(prefix+".scheme", "http")
+		viper.Set(prefix+".fqdn", u.Hostname())
+		viper.Set(prefix+".port", port)
+	}
+
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	client.RetryMax = 0
+	node, err := NewErgNode(client)
+	require.NoError(t, err)
+	explorer, err := NewExplorer(client)
+	require.NoError(t, err)
+
+	signer, err := NewLocalSigner(node, explorer, sk, MainnetPrefix, nil)
+	require.NoError(t, err)
+
+	req := TxRequest{
+		Requests: []PaymentRequest{{Address: addr.String(), Value: minChangeValue}},
+		Fee:      minChangeValue,
+	}
+
+	// boxes spent by a tx in the mempool are not used again
+	first, err := signer.Reduce(req)
+	require.NoError(t, err)
+	second, err := signer.Reduce(req)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Inputs[0].BoxId, second.Inputs[0].BoxId)
+
+	_, err = signer.Reduce(req)
+	assert.Error(t, err)
+
+	// until the tx that spent them fails
+	signer.spent.release(first.Inputs)
+	third, err := signer.Reduce(req)
+	require.NoError(t, err)
+	assert.Equal(t, first.Inputs[0].BoxId, third.Inputs[0].BoxId)
+
+	// the change and fee outputs carry empty assets and registers, never null
+	signed, err := sk.SignReduced(first)
+	require.NoError(t, err)
+	data, err := json.Marshal(signed)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "null")
+
+	var tx SignedTx
+	require.NoError(t, json.Unmarshal(data, &tx))
+	assert.Equal(t, signed, tx)
+	require.Len(t, tx.Outputs, 3)
+	for _, out := range tx.Outputs[1:] {
+		assert.NotNil(t, out.Assets)
+		assert.NotNil(t, out.AdditionalRegisters)
+	}
+}
@@ -0,0 +1,204 @@
+package erg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// UnsignedInput references a box that is spent by a transaction.
+type UnsignedInput struct {
+	BoxId     string            `json:"boxId"`
+	Extension map[string]string `json:"extension"`
+}
+
+// DataInput references a box that is only read by a transaction.
+type DataInput struct {
+	BoxId string `json:"boxId"`
+}
+
+// BoxCandidate is a transaction output which has not been assigned a box id yet.
+type BoxCandidate struct {
+	Value               int               `json:"value"`
+	ErgoTree            string            `json:"ergoTree"`
+	CreationHeight      int               `json:"creationHeight"`
+	Assets              []Tokens          `json:"assets"`
+	AdditionalRegisters map[string]string `json:"additionalRegisters"`
+}
+
+// UnsignedTx is an ergo transaction whose inputs carry no spending proofs.
+type UnsignedTx struct {
+	Inputs     []UnsignedInput `json:"inputs"`
+	DataInputs []DataInput     `json:"dataInputs"`
+	Outputs    []BoxCandidate  `json:"outputs"`
+}
+
+// SpendingProof proves the right to spend an input box.
+type SpendingProof struct {
+	ProofBytes string            `json:"proofBytes"`
+	Extension  map[string]string `json:"extension"`
+}
+
+// SignedInput is an input box together with its spending proof.
+type SignedInput struct {
+	BoxId         string        `json:"boxId"`
+	SpendingProof SpendingProof `json:"spendingProof"`
+}
+
+// SignedTx is the json representation of a transaction accepted by the node
+// /transactions endpoint.
+type SignedTx struct {
+	Id         string         `json:"id"`
+	Inputs     []SignedInput  `json:"inputs"`
+	DataInputs []DataInput    `json:"dataInputs"`
+	Outputs    []BoxCandidate `json:"outputs"`
+}
+
+// BoxIdFromBytes returns the box id of a serialized erg box.
+func BoxIdFromBytes(boxBytes string) (string, error) {
+	b, err := hex.DecodeString(boxBytes)
+	if err != nil {
+		return "", fmt.Errorf("serialized box is not valid hex - %s", err.Error())
+	}
+
+	sum := blake2b.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// BytesToSign serializes the transaction the same way the ergo reference
+// implementation does when computing the message that input proofs commit to.
+func (tx UnsignedTx) BytesToSign() ([]byte, error) {
+	var w bytes.Buffer
+
+	putUint(&w, uint64(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		if err := putHex(&w, in.BoxId); err != nil {
+			return nil, fmt.Errorf("input box id %s - %s", in.BoxId, err.Error())
+		}
+		// empty proof
+		putUint(&w, 0)
+		if err := putExtension(&w, in.Extension); err != nil {
+			return nil, fmt.Errorf("input box id %s - %s", in.BoxId, err.Error())
+		}
+	}
+
+	putUint(&w, uint64(len(tx.DataInputs)))
+	for _, in := range tx.DataInputs {
+		if err := putHex(&w, in.BoxId); err != nil {
+			return nil, fmt.Errorf("data input box id %s - %s", in.BoxId, err.Error())
+		}
+	}
+
+	// distinct token ids in order of appearance
+	var tokenIds []string
+	tokenIdx := make(map[string]int)
+	for _, out := range tx.Outputs {
+		for _, t := range out.Assets {
+			if _, ok := tokenIdx[t.TokenId]; !ok {
+				tokenIdx[t.TokenId] = len(tokenIds)
+				tokenIds = append(tokenIds, t.TokenId)
+			}
+		}
+	}
+
+	putUint(&w, uint64(len(tokenIds)))
+	for _, id := range tokenIds {
+		if err := putHex(&w, id); err != nil {
+			return nil, fmt.Errorf("token id %s - %s", id, err.Error())
+		}
+	}
+
+	putUint(&w, uint64(len(tx.Outputs)))
+	for i, out := range tx.Outputs {
+		putUint(&w, uint64(out.Value))
+		if err := putHex(&w, out.ErgoTree); err != nil {
+			return nil, fmt.Errorf("output %d ergoTree - %s", i, err.Error())
+		}
+		putUint(&w, uint64(out.CreationHeight))
+
+		w.WriteByte(byte(len(out.Assets)))
+		for _, t := range out.Assets {
+			putUint(&w, uint64(tokenIdx[t.TokenId]))
+			putUint(&w, uint64(t.Amount))
+		}
+
+		regs := registerNames(out.AdditionalRegisters)
+		w.WriteByte(byte(len(regs)))
+		for _, r := range regs {
+			if err := putHex(&w, out.AdditionalRegisters[r]); err != nil {
+				return nil, fmt.Errorf("output %d register %s - %s", i, r, err.Error())
+			}
+		}
+	}
+
+	return w.Bytes(), nil
+}
+
+// Id returns the transaction id, the blake2b256 hash of BytesToSign.
+func (tx UnsignedTx) Id() (string, error) {
+	msg, err := tx.BytesToSign()
+	if err != nil {
+		return "", err
+	}
+
+	sum := blake2b.Sum256(msg)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// registerNames returns the non standard register names of a box in
+// serialization order. Registers must be densely packed starting from R4.
+func registerNames(regs map[string]string) []string {
+	names := make([]string, 0, len(regs))
+	for r := range regs {
+		names = append(names, r)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func putExtension(w *bytes.Buffer, ext map[string]string) error {
+	ids := make([]int, 0, len(ext))
+	for k := range ext {
+		id, err := strconv.Atoi(k)
+		if err != nil || id < 0 || id > 255 {
+			return fmt.Errorf("context extension key '%s' is not a byte", k)
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	w.WriteByte(byte(len(ids)))
+	for _, id := range ids {
+		w.WriteByte(byte(id))
+		if err := putHex(w, ext[strconv.Itoa(id)]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func putHex(w *bytes.Buffer, s string) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("value is not valid hex - %s", err.Error())
+	}
+	w.Write(b)
+	return nil
+}
+
+// putUint writes n using the variable length quantity encoding used by the
+// ergo serializers.
+func putUint(w *bytes.Buffer, n uint64) {
+	for n >= 0x80 {
+		w.WriteByte(byte(n) | 0x80)
+		n >>= 7
+	}
+	w.WriteByte(byte(n))
+}
@@ -3,6 +3,8 @@ package http_no
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -66,6 +68,45 @@ func TLS(certContents, keyContents []byte) ServerOption {
 	}
 }
 
+// TLSFiles are the paths of the server cert and key and optionally of the CA
+// certs client certificates are verified with.
+type TLSFiles struct {
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// TLSFromFiles configures the server certs from files. With a client CA file
+// the server also verifies client certificates, but only if one is presented.
+func TLSFromFiles(files TLSFiles) (ServerOption, error) {
+	cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server cert - %s", err.Error())
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if files.ClientCAFile != "" {
+		contents, err := os.ReadFile(files.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client ca file - %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(contents) {
+			return nil, fmt.Errorf("no certs found in client ca file %s", files.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return func(s *Server) {
+		s.TLSConfig = config
+	}, nil
+}
+
 // WriteTimeout sets the server's WriteTimeout.
 func WriteTimeout(t time.Duration) ServerOption {
 	return func(s *Server) {
@@ -107,7 +148,8 @@ type Server struct {
 // Close the server. Will try to gracefully shutdown, but if the server takes
 // longer than 5 seconds to stop, forcibly shuts it down.
 func (s *Server) Close() error {
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	return s.Shutdown(ctx)
 }
 
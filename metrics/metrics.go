@@ -0,0 +1,329 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/buildinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+)
+
+const (
+	namespace = "nightowl"
+)
+
+var (
+	// box ids, tx ids, ergo trees and addresses in request paths
+	idSegment = regexp.MustCompile(`^([0-9a-fA-F]{16,}|[1-9A-HJ-NP-Za-km-z]{30,}|[0-9]+)$`)
+
+	lastBeacon int64
+
+	ergRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "erg_request_duration_seconds",
+		Help:      "Latency of requests to the ergo node and explorer by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"target", "method", "endpoint", "code"})
+
+	ergRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "erg_request_errors_total",
+		Help:      "Requests to the ergo node and explorer which failed or returned a server error, by endpoint.",
+	}, []string{"target", "method", "endpoint"})
+
+	betsDetected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bets_detected_total",
+		Help:      "Bets seen for the first time, in the mempool or in an oracle tx.",
+	}, []string{"game", "source"})
+
+	betsSettled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bets_settled_total",
+		Help:      "Bets settled by the payout service by outcome (won, lost, refunded).",
+	}, []string{"game", "outcome"})
+
+	betsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bets_failed_total",
+		Help:      "Failed attempts to resolve a bet.",
+	}, []string{"game"})
+
+	betsDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bets_dead_lettered_total",
+		Help:      "Bets moved to the dead letter set after failing too many times.",
+	}, []string{"game"})
+
+	beaconsReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drand_beacons_received_total",
+		Help:      "Combined drand beacons received from the oracle.",
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "drand_last_beacon_age_seconds",
+		Help:      "Seconds since the last drand beacon was received, -1 if none was received yet.",
+	}, func() float64 {
+		last := atomic.LoadInt64(&lastBeacon)
+		if last == 0 {
+			return -1
+		}
+		return time.Since(time.Unix(0, last)).Seconds()
+	})
+
+	redisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_errors_total",
+		Help:      "Failed redis commands by command.",
+	}, []string{"command"})
+
+	natsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nats_errors_total",
+		Help:      "Failed nats operations by operation.",
+	}, []string{"op"})
+
+	natsConnectionEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nats_connection_events_total",
+		Help:      "Disconnects, reconnects and closes of the nats connection.",
+	}, []string{"event"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served by route and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the HTTP requests served by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	buildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build info of the running binary, always 1.",
+	}, []string{"version", "revision", "build_date", "go_version"})
+)
+
+func init() {
+	buildInfo.WithLabelValues(
+		buildinfo.Info.GitVersion,
+		buildinfo.Info.GitRevision,
+		buildinfo.Info.Date,
+		buildinfo.Info.GoVersion,
+	).Set(1)
+}
+
+// Handler serves the metrics of the default registry.
+func Handler() httprouter.Handle {
+	h := promhttp.Handler()
+	return func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		h.ServeHTTP(w, req)
+	}
+}
+
+// RegisterPendingNotifs exposes the number of payouts whose players were not
+// notified yet, as returned by count.
+func RegisterPendingNotifs(count func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "notifs_pending",
+		Help:      "Payouts whose players were not notified yet.",
+	}, func() float64 {
+		return float64(count())
+	}))
+}
+
+func BetDetected(game, source string) {
+	betsDetected.WithLabelValues(game, source).Inc()
+}
+
+func BetSettled(game, outcome string) {
+	betsSettled.WithLabelValues(game, outcome).Inc()
+}
+
+func BetFailed(game string) {
+	betsFailed.WithLabelValues(game).Inc()
+}
+
+func BetDeadLettered(game string) {
+	betsDeadLettered.WithLabelValues(game).Inc()
+}
+
+func BeaconReceived() {
+	beaconsReceived.Inc()
+	atomic.StoreInt64(&lastBeacon, time.Now().UnixNano())
+}
+
+func NATSError(op string) {
+	natsErrors.WithLabelValues(op).Inc()
+}
+
+func NATSConnectionEvent(event string) {
+	natsConnectionEvents.WithLabelValues(event).Inc()
+}
+
+// NATSErrorHandler counts the asynchronous errors of a nats connection.
+func NATSErrorHandler(_ *nats.Conn, _ *nats.Subscription, _ error) {
+	NATSError("async")
+}
+
+// InstrumentTransport measures the requests made through rt to the ergo node
+// and explorer.
+func InstrumentTransport(rt http.RoundTripper) http.RoundTripper {
+	return roundTripper{next: rt}
+}
+
+type roundTripper struct {
+	next http.RoundTripper
+}
+
+func (r roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := requestTarget(req.URL.Hostname())
+	endpoint := endpointTemplate(req.URL.Path)
+	start := time.Now()
+
+	resp, err := r.next.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	ergRequestDuration.WithLabelValues(target, req.Method, endpoint, code).Observe(time.Since(start).Seconds())
+	if err != nil || resp.StatusCode >= 500 {
+		ergRequestErrors.WithLabelValues(target, req.Method, endpoint).Inc()
+	}
+
+	return resp, err
+}
+
+func requestTarget(host string) string {
+	switch host {
+	case viper.GetString("ergo_node.fqdn"):
+		return "node"
+	case viper.GetString("explorer_node.fqdn"):
+		return "explorer"
+	default:
+		return host
+	}
+}
+
+// endpointTemplate replaces the ids in a request path, so that every box or tx
+// does not end up with its own label value.
+func endpointTemplate(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if idSegment.MatchString(p) {
+			parts[i] = ":id"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// RedisHook counts failed redis commands. A missing key is not a failure.
+type RedisHook struct{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcess(_ context.Context, cmd redis.Cmder) error {
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		redisErrors.WithLabelValues(cmd.Name()).Inc()
+	}
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		h.AfterProcess(ctx, cmd)
+	}
+	return nil
+}
+
+// Router registers httprouter routes with their requests measured under the
+// route path, e.g. /api/v1/notifs/:walletAddr.
+type Router struct {
+	*httprouter.Router
+}
+
+func (r Router) GET(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodGet, path, handle)
+}
+
+func (r Router) POST(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodPost, path, handle)
+}
+
+func (r Router) PUT(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodPut, path, handle)
+}
+
+func (r Router) DELETE(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodDelete, path, handle)
+}
+
+func (r Router) OPTIONS(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodOptions, path, handle)
+}
+
+func (r Router) Handle(method, path string, handle httprouter.Handle) {
+	r.Router.Handle(method, path, instrumentHandle(method, path, handle))
+}
+
+func instrumentHandle(method, route string, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		handle(rec, req, params)
+
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets websocket upgrades through, the status of an upgraded request
+// is recorded as 101.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
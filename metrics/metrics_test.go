@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointTemplate(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/info", "/info"},
+		{"/utxo/byIdBinary/2b1d9b3aa6c3b1cd0d4f6c6a2bf5bcbd8c5ba9a2c9e5c3e1e1f2a3b4c5d6e7f8", "/utxo/byIdBinary/:id"},
+		{"/api/v1/boxes/unspent/byErgoTree/0008cd02a1b2c3d4e5f60718293a4b5c6d7e8f901a2b3c4d5e6f", "/api/v1/boxes/unspent/byErgoTree/:id"},
+		{"/api/v1/addresses/9fRAWhdxEsTcdb8PhGNrZfwqa65zfkuYHAMmkQLcic1gdLSV5vA/balance/total", "/api/v1/addresses/:id/balance/total"},
+		{"/blocks/at/812345", "/blocks/at/:id"},
+		{"/transactions/unconfirmed", "/transactions/unconfirmed"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, endpointTemplate(tt.path), tt.path)
+	}
+}
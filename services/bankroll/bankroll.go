@@ -0,0 +1,461 @@
+package bankroll
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	stateRedisKey    = "bankroll:state"
+	exposureRedisKey = "bankroll:exposure"
+	// the pause flags are fields of a single hash so that they are read
+	// together in cluster mode
+	pauseRedisKey = "bankroll:pause"
+
+	// ErgTokenId is the key used for the nanoErg balance of the house
+	ErgTokenId = "ERG"
+)
+
+var (
+	log *zap.Logger
+
+	ErrMaxSinglePayout = errors.New("payout exceeds the max single payout")
+	ErrExposureLimit   = errors.New("exposure exceeds the bankroll limits")
+
+	// addExposureScript adds to the exposure of a token unless it would
+	// exceed ARGV[3], a negative ARGV[3] means there is no limit. It returns
+	// the new exposure, or the exposure left unchanged negated minus one.
+	addExposureScript = redis.NewScript(`
+local exposure = redis.call("HINCRBY", KEYS[1], ARGV[1], ARGV[2])
+local max = tonumber(ARGV[3])
+if max >= 0 and exposure > max then
+	exposure = redis.call("HINCRBY", KEYS[1], ARGV[1], -tonumber(ARGV[2]))
+	return -exposure - 1
+end
+return exposure
+`)
+)
+
+// Limits are the risk limits of a single token. A limit of 0 is disabled.
+type Limits struct {
+	TokenId          string `mapstructure:"token_id"           json:"tokenId"`
+	MaxSinglePayout  int    `mapstructure:"max_single_payout"  json:"maxSinglePayout"`
+	MaxRoundExposure int    `mapstructure:"max_round_exposure" json:"maxRoundExposure"`
+	ReserveFloor     int    `mapstructure:"reserve_floor"      json:"reserveFloor"`
+}
+
+// State is the latest view of the house bankroll, stored in redis so that it
+// can be served by the admin API.
+type State struct {
+	UpdatedAt    int64             `json:"updatedAt"`
+	HouseAddress string            `json:"houseAddress"`
+	Balances     map[string]int    `json:"balances"`
+	Exposure     map[string]int    `json:"exposure"`
+	Limits       map[string]Limits `json:"limits"`
+	AcceptPaused bool              `json:"acceptPaused"`
+	SettlePaused bool              `json:"settlePaused"`
+	ManualAccept bool              `json:"manualAcceptPause"`
+	ManualSettle bool              `json:"manualSettlePause"`
+	Reasons      []string          `json:"reasons"`
+}
+
+func (st State) MarshalBinary() ([]byte, error) {
+	return json.Marshal(st)
+}
+
+// Service tracks the house balances and the worst-case exposure of pending
+// bets and pauses accepting or settling bets once a limit is hit.
+type Service struct {
+	ctx          context.Context
+	component    string
+	ergExplorer  *erg.Explorer
+	houseAddress string
+	limits       map[string]Limits
+	interval     time.Duration
+	rdb          redis.UniversalClient
+	mu           sync.RWMutex
+	state        State
+	stop         chan bool
+	done         chan bool
+	wg           *sync.WaitGroup
+}
+
+func NewService(rdb redis.UniversalClient, retryClient *retryablehttp.Client, houseAddress string, wg *sync.WaitGroup) (service *Service, err error) {
+	ctx := context.Background()
+	log = zap.L()
+
+	ergExplorerClient, err := erg.NewExplorer(retryClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erg explorer client - %s", err.Error())
+	}
+
+	conf := config.Current()
+
+	limits, err := loadLimits(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := 60 * time.Second
+	if value := conf.Bankroll.RefreshInterval; value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	service = &Service{
+		ctx:          ctx,
+		component:    "bankroll",
+		ergExplorer:  ergExplorerClient,
+		houseAddress: houseAddress,
+		limits:       limits,
+		interval:     interval,
+		rdb:          rdb,
+		stop:         make(chan bool),
+		done:         make(chan bool),
+		wg:           wg,
+	}
+
+	config.OnReload("bankroll limits", func(conf *config.Config) (func(), error) {
+		limits, err := loadLimits(conf)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			service.mu.Lock()
+			service.limits = limits
+			service.mu.Unlock()
+		}, nil
+	})
+
+	return service, nil
+}
+
+// loadLimits reads the risk limits of every token from bankroll.limits of
+// conf.
+func loadLimits(conf *config.Config) (map[string]Limits, error) {
+	limits := make(map[string]Limits, len(conf.Bankroll.Limits))
+	for _, l := range conf.Bankroll.Limits {
+		if l.TokenId == "" {
+			return nil, fmt.Errorf("config bankroll.limits has an entry without token_id")
+		}
+		limits[l.TokenId] = Limits(l)
+	}
+
+	return limits, nil
+}
+
+func wait(sleepTime time.Duration, c chan bool) {
+	time.Sleep(sleepTime)
+	c <- true
+}
+
+func (s *Service) trackBankroll(stop chan bool) {
+	refresh := make(chan bool, 1)
+
+	refresh <- true
+
+loop:
+	for {
+		select {
+		case <-stop:
+			log.Info("stopping trackBankroll() loop...")
+			s.wg.Done()
+			break loop
+		case <-refresh:
+			start := time.Now()
+			err := s.Refresh()
+			if err != nil {
+				log.Error("failed to refresh bankroll", zap.Error(err), zap.Int64("durationMs", time.Since(start).Milliseconds()))
+			} else {
+				log.Debug("refreshed bankroll", zap.Int64("durationMs", time.Since(start).Milliseconds()))
+			}
+
+			go wait(s.interval, refresh)
+		}
+	}
+}
+
+// Refresh reloads the house balances and pending exposure and re-evaluates
+// the limits.
+func (s *Service) Refresh() error {
+	balance, err := s.ergExplorer.GetConfirmedBalance(s.houseAddress)
+	if err != nil {
+		return fmt.Errorf("failed to get house balance - %s", err.Error())
+	}
+
+	balances := map[string]int{ErgTokenId: balance.NanoErgs}
+	for _, t := range balance.Tokens {
+		balances[t.TokenId] += t.Amount
+	}
+
+	exposure, err := s.exposure()
+	if err != nil {
+		return err
+	}
+
+	manualAccept, manualSettle, err := LoadPause(s.ctx, s.rdb)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	limits := s.limits
+	s.mu.RUnlock()
+
+	st := evaluate(balances, exposure, limits)
+	st.UpdatedAt = time.Now().Unix()
+	st.HouseAddress = s.houseAddress
+	st.ManualAccept = manualAccept
+	st.ManualSettle = manualSettle
+	st.AcceptPaused = st.AcceptPaused || manualAccept
+	st.SettlePaused = st.SettlePaused || manualSettle
+
+	s.mu.Lock()
+	prev := s.state
+	s.state = st
+	s.mu.Unlock()
+
+	if st.AcceptPaused != prev.AcceptPaused || st.SettlePaused != prev.SettlePaused {
+		log.Warn("bankroll pause state changed",
+			zap.Bool("accept_paused", st.AcceptPaused),
+			zap.Bool("settle_paused", st.SettlePaused),
+			zap.Strings("reasons", st.Reasons),
+		)
+	}
+
+	err = s.rdb.Set(s.ctx, state.Key(stateRedisKey), st, 0).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set key '%s' in redis db - %s", stateRedisKey, err.Error())
+	}
+
+	return nil
+}
+
+// evaluate applies the limits of every token to its balance and exposure.
+func evaluate(balances, exposure map[string]int, limits map[string]Limits) State {
+	st := State{
+		Balances: balances,
+		Exposure: exposure,
+		Limits:   limits,
+		Reasons:  []string{},
+	}
+
+	tokenIds := make([]string, 0, len(limits))
+	for id := range limits {
+		tokenIds = append(tokenIds, id)
+	}
+	sort.Strings(tokenIds)
+
+	for _, id := range tokenIds {
+		l := limits[id]
+		if l.MaxRoundExposure > 0 && exposure[id] > l.MaxRoundExposure {
+			st.AcceptPaused = true
+			st.Reasons = append(st.Reasons, fmt.Sprintf("exposure %d of %s exceeds max round exposure %d", exposure[id], id, l.MaxRoundExposure))
+		}
+		if l.ReserveFloor > 0 && balances[id]-exposure[id] < l.ReserveFloor {
+			st.AcceptPaused = true
+			st.SettlePaused = true
+			st.Reasons = append(st.Reasons, fmt.Sprintf("balance %d of %s minus exposure %d is below reserve floor %d", balances[id], id, exposure[id], l.ReserveFloor))
+		}
+	}
+
+	return st
+}
+
+func (s *Service) exposure() (map[string]int, error) {
+	vals, err := s.rdb.HGetAll(s.ctx, state.Key(exposureRedisKey)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key '%s' from redis db - %s", exposureRedisKey, err.Error())
+	}
+
+	exposure := make(map[string]int, len(vals))
+	for id, v := range vals {
+		exposure[id], _ = strconv.Atoi(v)
+	}
+
+	return exposure, nil
+}
+
+// AddExposure adds the worst-case payout of a newly pending bet. It fails with
+// ErrExposureLimit and leaves the exposure unchanged when the bet would take
+// it past the max round exposure or the balance past the reserve floor, as
+// the pause flags only catch up on the next refresh.
+func (s *Service) AddExposure(tokenId string, amount int) error {
+	max, err := s.maxExposure(tokenId)
+	if err != nil {
+		return err
+	}
+
+	exposure, err := addExposureScript.Run(s.ctx, s.rdb, []string{state.Key(exposureRedisKey)}, tokenId, amount, max).Int()
+	if err != nil {
+		return fmt.Errorf("failed to increment exposure in redis db - %s", err.Error())
+	}
+	if exposure < 0 {
+		return fmt.Errorf("exposure %d of %s plus %d above %d - %w", -exposure-1, tokenId, amount, max, ErrExposureLimit)
+	}
+
+	return nil
+}
+
+// maxExposure returns the most exposure the limits of a token allow, -1 if
+// they allow any.
+func (s *Service) maxExposure(tokenId string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l := s.limits[tokenId]
+	if l.MaxRoundExposure <= 0 && l.ReserveFloor <= 0 {
+		return -1, nil
+	}
+
+	max := l.MaxRoundExposure
+	if l.ReserveFloor > 0 {
+		if s.state.UpdatedAt == 0 {
+			return 0, fmt.Errorf("balance of %s is not known yet - %w", tokenId, ErrExposureLimit)
+		}
+		if free := s.state.Balances[tokenId] - l.ReserveFloor; l.MaxRoundExposure <= 0 || free < max {
+			max = free
+		}
+	}
+	if max < 0 {
+		max = 0
+	}
+
+	return max, nil
+}
+
+// HoldExposure adds the worst-case payout of a bet which was accepted before,
+// e.g. one queued again after its tx was rejected. It is not checked against
+// the limits a second time.
+func (s *Service) HoldExposure(tokenId string, amount int) error {
+	err := s.rdb.HIncrBy(s.ctx, state.Key(exposureRedisKey), tokenId, int64(amount)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to increment exposure in redis db - %s", err.Error())
+	}
+	return nil
+}
+
+// RemoveExposure releases the worst-case payout of a settled or refunded bet.
+func (s *Service) RemoveExposure(tokenId string, amount int) error {
+	return s.HoldExposure(tokenId, -amount)
+}
+
+// SettlingAllowed reports whether bets may currently be settled.
+func (s *Service) SettlingAllowed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.state.SettlePaused
+}
+
+// AcceptingAllowed reports whether new bets should currently be accepted.
+func (s *Service) AcceptingAllowed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.state.AcceptPaused
+}
+
+// CheckPayout verifies that paying amount of tokenId to a player is within the
+// max single payout. It is checked when a bet is accepted, with the worst-case
+// payout of the bet.
+func (s *Service) CheckPayout(tokenId string, amount int) error {
+	s.mu.RLock()
+	l, ok := s.limits[tokenId]
+	s.mu.RUnlock()
+
+	if ok && l.MaxSinglePayout > 0 && amount > l.MaxSinglePayout {
+		return fmt.Errorf("payout of %d %s above %d - %w", amount, tokenId, l.MaxSinglePayout, ErrMaxSinglePayout)
+	}
+
+	return nil
+}
+
+func (s *Service) Start() {
+
+	stopTracking := make(chan bool)
+	s.wg.Add(1)
+	go s.trackBankroll(stopTracking)
+
+	// Wait for a "stop" message in the background to stop the service.
+	go func(stopTracking chan bool) {
+		go func() {
+			<-s.stop
+			stopTracking <- true
+			s.done <- true
+		}()
+	}(stopTracking)
+}
+
+func (s *Service) Stop() {
+	s.stop <- true
+}
+
+func (s *Service) Wait(wg *sync.WaitGroup) {
+	defer wg.Done()
+	<-s.done
+}
+
+// LoadState returns the bankroll state last stored by the payout service.
+func LoadState(ctx context.Context, rdb redis.UniversalClient) (State, error) {
+	var st State
+
+	val, err := rdb.Get(ctx, state.Key(stateRedisKey)).Result()
+	switch {
+	case err == redis.Nil:
+		return st, nil
+	case err != nil:
+		return st, fmt.Errorf("failed to get key '%s' from redis db - %s", stateRedisKey, err.Error())
+	}
+
+	err = json.Unmarshal([]byte(val), &st)
+	if err != nil {
+		return st, fmt.Errorf("failed to unmarshal bankroll state - %s", err.Error())
+	}
+
+	return st, nil
+}
+
+// LoadPause returns the pause flags set by an operator.
+func LoadPause(ctx context.Context, rdb redis.UniversalClient) (accept, settle bool, err error) {
+	vals, err := rdb.HMGet(ctx, state.Key(pauseRedisKey), "accept", "settle").Result()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to get bankroll pause flags from redis db - %s", err.Error())
+	}
+
+	accept = vals[0] == "true"
+	settle = vals[1] == "true"
+
+	return accept, settle, nil
+}
+
+// SetPause updates the pause flags set by an operator. Nil values are left
+// unchanged. They take effect on the next bankroll refresh.
+func SetPause(ctx context.Context, rdb redis.UniversalClient, accept, settle *bool) error {
+	flags := make(map[string]interface{})
+	if accept != nil {
+		flags["accept"] = strconv.FormatBool(*accept)
+	}
+	if settle != nil {
+		flags["settle"] = strconv.FormatBool(*settle)
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+
+	if err := rdb.HSet(ctx, state.Key(pauseRedisKey), flags).Err(); err != nil {
+		return fmt.Errorf("failed to set key '%s' in redis db - %s", pauseRedisKey, err.Error())
+	}
+
+	return nil
+}
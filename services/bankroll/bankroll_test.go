@@ -0,0 +1,167 @@
+package bankroll
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	const owl = "owl"
+
+	tests := []struct {
+		name         string
+		balance      int
+		exposure     int
+		limits       Limits
+		acceptPaused bool
+		settlePaused bool
+		reasons      int
+	}{
+		{
+			name:     "no limits",
+			balance:  100,
+			exposure: 1000,
+			limits:   Limits{TokenId: owl},
+		},
+		{
+			name:     "within limits",
+			balance:  1000,
+			exposure: 500,
+			limits:   Limits{TokenId: owl, MaxRoundExposure: 500, ReserveFloor: 500},
+		},
+		{
+			name:         "above max round exposure",
+			balance:      10000,
+			exposure:     501,
+			limits:       Limits{TokenId: owl, MaxRoundExposure: 500},
+			acceptPaused: true,
+			reasons:      1,
+		},
+		{
+			name:         "below reserve floor",
+			balance:      1000,
+			exposure:     501,
+			limits:       Limits{TokenId: owl, ReserveFloor: 500},
+			acceptPaused: true,
+			settlePaused: true,
+			reasons:      1,
+		},
+		{
+			name:         "both",
+			balance:      1000,
+			exposure:     900,
+			limits:       Limits{TokenId: owl, MaxRoundExposure: 500, ReserveFloor: 500},
+			acceptPaused: true,
+			settlePaused: true,
+			reasons:      2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := evaluate(
+				map[string]int{owl: tt.balance},
+				map[string]int{owl: tt.exposure},
+				map[string]Limits{owl: tt.limits},
+			)
+			assert.Equal(t, tt.acceptPaused, st.AcceptPaused)
+			assert.Equal(t, tt.settlePaused, st.SettlePaused)
+			assert.Len(t, st.Reasons, tt.reasons)
+		})
+	}
+}
+
+func TestCheckPayout(t *testing.T) {
+	s := &Service{limits: map[string]Limits{
+		"owl": {TokenId: "owl", MaxSinglePayout: 3600},
+		"erg": {TokenId: "erg"},
+	}}
+
+	tests := []struct {
+		name    string
+		tokenId string
+		amount  int
+		err     bool
+	}{
+		{name: "below limit", tokenId: "owl", amount: 3599},
+		{name: "at limit", tokenId: "owl", amount: 3600},
+		{name: "above limit", tokenId: "owl", amount: 3601, err: true},
+		{name: "limit disabled", tokenId: "erg", amount: 1000000},
+		{name: "token without limits", tokenId: "sigusd", amount: 1000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CheckPayout(tt.tokenId, tt.amount)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrMaxSinglePayout)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAddExposure(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	s := &Service{ctx: context.Background(), rdb: rdb, limits: map[string]Limits{
+		"owl": {TokenId: "owl", MaxRoundExposure: 100},
+		"erg": {TokenId: "erg", ReserveFloor: 150},
+	}}
+	exposure := func(tokenId string) string {
+		return mr.HGet(state.Key(exposureRedisKey), tokenId)
+	}
+
+	// bets are checked against the limits as they are accepted, not on the
+	// next refresh
+	require.NoError(t, s.AddExposure("owl", 60))
+	assert.ErrorIs(t, s.AddExposure("owl", 50), ErrExposureLimit)
+	assert.Equal(t, "60", exposure("owl"))
+	require.NoError(t, s.AddExposure("owl", 40))
+
+	// bets accepted before are held again whatever the limits
+	require.NoError(t, s.HoldExposure("owl", 50))
+	assert.Equal(t, "150", exposure("owl"))
+	require.NoError(t, s.RemoveExposure("owl", 50))
+
+	// the reserve floor needs the balance
+	assert.ErrorIs(t, s.AddExposure("erg", 10), ErrExposureLimit)
+	s.state = State{UpdatedAt: 1, Balances: map[string]int{"erg": 200}}
+	require.NoError(t, s.AddExposure("erg", 50))
+	assert.ErrorIs(t, s.AddExposure("erg", 1), ErrExposureLimit)
+	assert.Equal(t, "50", exposure("erg"))
+
+	// tokens without limits take any exposure
+	require.NoError(t, s.AddExposure("sigusd", 1000000))
+}
+
+func TestPause(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	accept, settle, err := LoadPause(ctx, rdb)
+	require.NoError(t, err)
+	assert.False(t, accept)
+	assert.False(t, settle)
+
+	yes, no := true, false
+	require.NoError(t, SetPause(ctx, rdb, &yes, nil))
+	require.NoError(t, SetPause(ctx, rdb, nil, &yes))
+	require.NoError(t, SetPause(ctx, rdb, &no, nil))
+
+	accept, settle, err = LoadPause(ctx, rdb)
+	require.NoError(t, err)
+	assert.False(t, accept)
+	assert.True(t, settle)
+
+	// both flags live in one key, so cluster mode can read them together
+	assert.Equal(t, []string{state.Key(pauseRedisKey)}, mr.Keys())
+}
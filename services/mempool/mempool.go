@@ -0,0 +1,272 @@
+package mempool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/metrics"
+	"github.com/nightowlcasino/nightowl/services/notif"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	betReceivedNotifType = "bet"
+	pageSize             = 50
+	// boxes leave the mempool once mined, after which they no longer need to
+	// be remembered
+	seenTTL = time.Hour
+	// bets whose tx never confirms are forgotten after this long, the payout
+	// service keeps the ones it picks up
+	detectedTTL = 24 * time.Hour
+)
+
+var (
+	log *zap.Logger
+)
+
+// Service polls the mempool of the node for new bet boxes of every game and
+// lets players know their bet was received long before the oracle picks it up.
+type Service struct {
+	ctx       context.Context
+	component string
+	ergNode   *erg.ErgNode
+	contracts *contracts.Registry
+	interval  time.Duration
+	seen      map[string]time.Time
+	players   *state.PlayerIndex
+	nats      *nats.Conn
+	rdb       redis.UniversalClient
+	stop      chan bool
+	done      chan bool
+	wg        *sync.WaitGroup
+}
+
+func NewService(nats *nats.Conn, rdb redis.UniversalClient, retryClient *retryablehttp.Client, reg *contracts.Registry, wg *sync.WaitGroup) (service *Service, err error) {
+
+	ctx := context.Background()
+	log = zap.L()
+
+	ergNodeClient, err := erg.NewErgNode(retryClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erg node client - %s", err.Error())
+	}
+
+	interval := 5 * time.Second
+	if value := config.Current().Mempool.Interval; value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	service = &Service{
+		ctx:       ctx,
+		component: "mempool",
+		ergNode:   ergNodeClient,
+		contracts: reg,
+		interval:  interval,
+		seen:      make(map[string]time.Time),
+		players:   state.NewPlayerIndex(ctx, rdb),
+		nats:      nats,
+		rdb:       rdb,
+		stop:      make(chan bool),
+		done:      make(chan bool),
+		wg:        wg,
+	}
+
+	return service, nil
+}
+
+func wait(sleepTime time.Duration, c chan bool) {
+	time.Sleep(sleepTime)
+	c <- true
+}
+
+func (s *Service) watchMempool(stop chan bool) {
+	poll := make(chan bool, 1)
+
+	poll <- true
+
+loop:
+	for {
+		select {
+		case <-stop:
+			log.Info("stopping watchMempool() loop...")
+			s.wg.Done()
+			break loop
+		case <-poll:
+			start := time.Now()
+			for game, g := range s.contracts.Games {
+				count, err := s.detectBets(game, g.ErgoTree)
+				if err != nil {
+					log.Error("failed to detect bets in mempool", zap.Error(err), zap.String("game", game))
+					continue
+				}
+				if count > 0 {
+					log.Debug("detected bets in mempool",
+						zap.String("game", game),
+						zap.Int("new_bets", count),
+						zap.Int64("durationMs", time.Since(start).Milliseconds()),
+					)
+				}
+			}
+
+			for boxId, at := range s.seen {
+				if time.Since(at) > seenTTL {
+					delete(s.seen, boxId)
+				}
+			}
+
+			go wait(s.interval, poll)
+		}
+	}
+}
+
+// detectBets walks the unconfirmed outputs locked by a game contract and
+// records every bet not seen before. It returns the number of new bets.
+func (s *Service) detectBets(game, ergoTree string) (int, error) {
+	var count int
+
+	for offset := 0; ; offset += pageSize {
+		outputs, err := s.ergNode.GetUnconfirmedOutputsByErgoTree(ergoTree, pageSize, offset)
+		if err != nil {
+			return count, err
+		}
+
+		for _, box := range outputs {
+			if _, ok := s.seen[box.BoxId]; ok {
+				continue
+			}
+			if s.detectBet(game, box) {
+				count++
+			}
+		}
+
+		if len(outputs) < pageSize {
+			return count, nil
+		}
+	}
+}
+
+// detectBet records a bet box found in the mempool as detected and notifies
+// the player. It returns true if the bet was new.
+func (s *Service) detectBet(game string, box erg.ErgTxOutputNode) bool {
+	// only well formed bets carry the player in R6
+	if len(box.Assets) == 0 || len(box.AdditionalRegisters.R6) <= 4 {
+		s.seen[box.BoxId] = time.Now()
+		return false
+	}
+
+	plyrAddr, err := s.ergNode.ErgoTreeToAddress(box.AdditionalRegisters.R6[4:])
+	if err != nil {
+		log.Error("failed to get player address", zap.Error(err), zap.String("erg_utxo_box_id", box.BoxId))
+		return false
+	}
+	s.seen[box.BoxId] = time.Now()
+
+	betKey := state.Key(fmt.Sprintf("%s:%s:%s", game, box.BoxId, plyrAddr))
+
+	// the payout service may have picked the bet up already
+	exists, err := s.rdb.Exists(s.ctx, betKey).Result()
+	if err != nil {
+		log.Error("failed to check key in redis db", zap.Error(err), zap.String("redis_key", betKey))
+		return false
+	}
+	if exists > 0 {
+		return false
+	}
+
+	detectedAt := time.Now().Unix()
+	bet := map[string]interface{}{
+		"status":     state.BetStatusDetected,
+		"settled":    "false",
+		"confirmed":  "false",
+		"stake":      strconv.Itoa(box.Assets[0].Amount),
+		"tokenId":    box.Assets[0].TokenId,
+		"tokenName":  s.contracts.TokenName(box.Assets[0].TokenId),
+		"playerAddr": plyrAddr,
+		"subgame":    box.AdditionalRegisters.R4,
+		"number":     box.AdditionalRegisters.R5,
+		"betTxId":    box.TxId,
+		"detectedAt": strconv.FormatInt(detectedAt, 10),
+	}
+	_, err = s.rdb.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(s.ctx, betKey, bet)
+		pipe.Expire(s.ctx, betKey, detectedTTL)
+		return nil
+	})
+	if err != nil {
+		log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", betKey))
+		return false
+	}
+	metrics.BetDetected(game, "mempool")
+
+	err = s.players.Add(plyrAddr, betKey, detectedAt)
+	if err != nil {
+		log.Error("failed to index bet of player", zap.Error(err), zap.String("redis_key", betKey))
+	}
+
+	n := notif.Notif{
+		Type:       betReceivedNotifType,
+		WalletAddr: plyrAddr,
+		Amount:     strconv.Itoa(box.Assets[0].Amount),
+		TokenName:  s.contracts.TokenName(box.Assets[0].TokenId),
+		TxID:       box.TxId,
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		log.Error("failed to marshal notif struct", zap.Error(err), zap.Any("notif", n))
+		return true
+	}
+
+	subj := broker.Subject(fmt.Sprintf("notif.%s", plyrAddr))
+	err = s.nats.Publish(subj, data)
+	if err != nil {
+		metrics.NATSError("publish")
+		log.Error("failed to publish bet received notification", zap.Error(err), zap.String("subject", subj))
+		return true
+	}
+
+	log.Info("bet detected in mempool",
+		zap.String("game", game),
+		zap.String("erg_utxo_box_id", box.BoxId),
+		zap.String("wallet_addr", plyrAddr),
+		zap.String("tx_id", box.TxId),
+	)
+
+	return true
+}
+
+func (s *Service) Start() {
+
+	stopWatch := make(chan bool)
+	s.wg.Add(1)
+	go s.watchMempool(stopWatch)
+
+	// Wait for a "stop" message in the background to stop the service.
+	go func(stopWatch chan bool) {
+		go func() {
+			<-s.stop
+			stopWatch <- true
+			s.done <- true
+		}()
+	}(stopWatch)
+}
+
+func (s *Service) Stop() {
+	s.stop <- true
+}
+
+func (s *Service) Wait(wg *sync.WaitGroup) {
+	defer wg.Done()
+	<-s.done
+}
@@ -0,0 +1,131 @@
+package mempool
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/devnet"
+	"github.com/nightowlcasino/nightowl/services/notif"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestService(t *testing.T) (*Service, *devnet.Chain, *miniredis.Miniredis, *nats.Conn) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	log = zap.NewNop()
+
+	reg, err := contracts.Load()
+	require.NoError(t, err)
+
+	chain, err := devnet.NewChain(reg, nil, nil)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(chain.Handler())
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	viper.Set("ergo_node.scheme", "http")
+	viper.Set("ergo_node.fqdn", u.Hostname())
+	viper.Set("ergo_node.port", port)
+
+	ns, err := devnet.StartNATS(0)
+	require.NoError(t, err)
+	t.Cleanup(ns.Close)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	client.RetryMax = 0
+
+	s, err := NewService(nc, rdb, client, reg, nil)
+	require.NoError(t, err)
+
+	return s, chain, mr, nc
+}
+
+func TestDetectBets(t *testing.T) {
+	s, chain, mr, nc := newTestService(t)
+	gameTree := s.contracts.GameErgoTree(contracts.Roulette)
+
+	player := chain.RandomAddress()
+	sub, err := nc.SubscribeSync("notif." + player)
+	require.NoError(t, err)
+	require.NoError(t, nc.Flush())
+
+	boxId, err := chain.PlaceBet(player, 0, 17, 100)
+	require.NoError(t, err)
+
+	count, err := s.detectBets(contracts.Roulette, gameTree)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	betKey := state.Key("roulette:" + boxId + ":" + player)
+	bet, err := s.rdb.HGetAll(context.Background(), betKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, state.BetStatusDetected, bet["status"])
+	assert.Equal(t, "100", bet["stake"])
+
+	// the player is told the bet was received
+	msg, err := sub.NextMsg(time.Second)
+	require.NoError(t, err)
+	var n notif.Notif
+	require.NoError(t, json.Unmarshal(msg.Data, &n))
+	assert.Equal(t, betReceivedNotifType, n.Type)
+	assert.Equal(t, "100", n.Amount)
+
+	bets, _, err := s.players.Bets(player, state.PlayerBetQuery{})
+	require.NoError(t, err)
+	require.Len(t, bets, 1)
+	assert.Equal(t, boxId, bets[0].BoxId)
+
+	// bets are only detected once
+	count, err = s.detectBets(contracts.Roulette, gameTree)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// a bet whose tx never confirms expires
+	assert.Equal(t, detectedTTL, mr.TTL(betKey))
+	mr.FastForward(detectedTTL)
+	assert.False(t, mr.Exists(betKey))
+	bets, _, err = s.players.Bets(player, state.PlayerBetQuery{})
+	require.NoError(t, err)
+	assert.Empty(t, bets)
+}
+
+func TestDetectBetKnown(t *testing.T) {
+	s, chain, mr, _ := newTestService(t)
+
+	// bets the payout service picked up already are left alone
+	player := chain.RandomAddress()
+	boxId, err := chain.PlaceBet(player, 0, 17, 100)
+	require.NoError(t, err)
+	betKey := state.Key("roulette:" + boxId + ":" + player)
+	mr.HSet(betKey, "status", state.BetStatusPending)
+
+	count, err := s.detectBets(contracts.Roulette, s.contracts.GameErgoTree(contracts.Roulette))
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, state.BetStatusPending, mr.HGet(betKey, "status"))
+	assert.Zero(t, mr.TTL(betKey))
+}
@@ -0,0 +1,130 @@
+package notif
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/tracing"
+	"go.uber.org/zap"
+)
+
+// JetStreamEnabled reports whether notifications go into a durable JetStream
+// stream instead of being sent with core nats and stored in redis until acked.
+func JetStreamEnabled() bool {
+	return config.Current().NATS.JetStream.Enabled
+}
+
+// StreamSubject returns the subject of the stream notifications for a wallet
+// address are published on.
+func StreamSubject(walletAddr string) string {
+	return broker.Subject(fmt.Sprintf("%s.%s", config.Current().NATS.JetStream.SubjectPrefix, walletAddr))
+}
+
+// ConsumerName returns the name of the durable consumer of a wallet address.
+func ConsumerName(walletAddr string) string {
+	return fmt.Sprintf("notif-%s", walletAddr)
+}
+
+// SetupStream creates the notification stream, or updates it if its config
+// changed since it was created.
+func SetupStream(js nats.JetStreamContext) error {
+	conf := config.Current().NATS.JetStream
+	name := conf.Stream
+	cfg := &nats.StreamConfig{
+		Name:     name,
+		Subjects: []string{broker.Subject(conf.SubjectPrefix + ".>")},
+		Storage:  nats.FileStorage,
+		MaxAge:   time.Duration(conf.MaxAge) * time.Hour,
+		// a notification published twice within the window is only stored once
+		Duplicates: 2 * time.Minute,
+	}
+
+	_, err := js.StreamInfo(name)
+	switch {
+	case err == nats.ErrStreamNotFound:
+		if _, err = js.AddStream(cfg); err != nil {
+			return fmt.Errorf("failed to create stream '%s' - %s", name, err.Error())
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get stream '%s' - %s", name, err.Error())
+	default:
+		if _, err = js.UpdateStream(cfg); err != nil {
+			return fmt.Errorf("failed to update stream '%s' - %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// restoreStream recreates the notification stream after a reconnect in case
+// the server came back without it.
+func (s *Service) restoreStream(_ *nats.Conn) {
+	if err := SetupStream(s.js); err != nil {
+		log.Error("failed to restore notification stream after reconnect", zap.Error(err))
+	}
+}
+
+// EnsureConsumer returns the durable consumer of a wallet address, creating it
+// if it does not exist yet. Notifications stay in the stream until the player
+// acks them and are redelivered once the ack wait expires.
+func EnsureConsumer(js nats.JetStreamContext, walletAddr string) (*nats.ConsumerInfo, error) {
+	conf := config.Current().NATS.JetStream
+	stream := conf.Stream
+	name := ConsumerName(walletAddr)
+
+	info, err := js.ConsumerInfo(stream, name)
+	switch {
+	case err == nil:
+		return info, nil
+	case err != nats.ErrConsumerNotFound:
+		return nil, fmt.Errorf("failed to get consumer '%s' - %s", name, err.Error())
+	}
+
+	info, err = js.AddConsumer(stream, &nats.ConsumerConfig{
+		Durable:       name,
+		FilterSubject: StreamSubject(walletAddr),
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       time.Duration(conf.AckWait) * time.Second,
+		MaxDeliver:    conf.MaxDeliver,
+		// consumers of players who never come back are removed by the server
+		InactiveThreshold: time.Duration(conf.MaxAge) * time.Hour,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer '%s' - %s", name, err.Error())
+	}
+
+	return info, nil
+}
+
+// publishStream stores a notification in the stream. The broker keeps it
+// until the player acks it, so nothing needs to be kept in redis.
+func (s *Service) publishStream(ctx context.Context, notif Notif, data []byte) error {
+	subj := StreamSubject(notif.WalletAddr)
+	msgId := fmt.Sprintf("%s:%s:%s", notif.Type, notif.WalletAddr, notif.TxID)
+
+	msg := &nats.Msg{
+		Subject: subj,
+		Data:    data,
+	}
+	tracing.InjectNATS(ctx, msg)
+
+	_, err := s.js.PublishMsg(msg, nats.MsgId(msgId))
+	if err != nil {
+		return fmt.Errorf("failed to publish notification to stream subject '%s' - %s", subj, err.Error())
+	}
+
+	log.Debug("stored notification in stream",
+		zap.String("type", notif.Type),
+		zap.String("wallet_addr", notif.WalletAddr),
+		zap.String("amount", notif.Amount),
+		zap.String("token_name", notif.TokenName),
+		zap.String("tx_id", notif.TxID),
+	)
+
+	return nil
+}
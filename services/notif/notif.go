@@ -4,21 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v9"
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/config"
 	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/metrics"
 	"github.com/nightowlcasino/nightowl/state"
-	"github.com/spf13/viper"
+	"github.com/nightowlcasino/nightowl/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
 const (
 	notConfirmedRedisKey = "confirmed:false"
+	refundNotifType      = "refund"
 )
 
 var (
@@ -30,8 +34,9 @@ type Service struct {
 	component string
 	ergNode   *erg.ErgNode
 	nats      *nats.Conn
+	js        nats.JetStreamContext
 	ns        *state.NotifState
-	rdb       *redis.Client
+	rdb       redis.UniversalClient
 	stop      chan bool
 	done      chan bool
 	wg        *sync.WaitGroup
@@ -49,7 +54,7 @@ func (n Notif) MarshalBinary() ([]byte, error) {
     return json.Marshal(n)
 }
 
-func NewService(nats *nats.Conn, rdb *redis.Client, retryClient *retryablehttp.Client, ns *state.NotifState, wg *sync.WaitGroup) (service *Service, err error) {
+func NewService(nats *nats.Conn, rdb redis.UniversalClient, retryClient *retryablehttp.Client, ns *state.NotifState, wg *sync.WaitGroup) (service *Service, err error) {
 
 	ctx := context.Background()
 	log = zap.L()
@@ -71,10 +76,23 @@ func NewService(nats *nats.Conn, rdb *redis.Client, retryClient *retryablehttp.C
 		wg:        wg,
 	}
 
-	if _, err = nats.Subscribe(viper.Get("nats.notif_payouts_subj").(string), service.handleNATSMessages); err != nil {
+	if JetStreamEnabled() {
+		service.js, err = nats.JetStream()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create jetstream context - %s", err.Error())
+		}
+		if err = SetupStream(service.js); err != nil {
+			return nil, err
+		}
+		broker.OnReconnect(service.restoreStream)
+		log.Info("notifications are stored in jetstream", zap.String("stream", config.Current().NATS.JetStream.Stream))
+	}
+
+	subj := broker.Subject(config.Current().NATS.NotifPayoutsSubj)
+	if _, err = nats.Subscribe(subj, service.handleNATSMessages); err != nil {
 		return nil, err
 	}
-	log.Info("successfully subscribed to " + viper.Get("nats.notif_payouts_subj").(string))
+	log.Info("successfully subscribed to " + subj)
 
 	return service, nil
 }
@@ -99,10 +117,9 @@ loop:
 		case <-checkPayouts:
 			// loop through and check if box id(s) are spent or not
 			for notConf := range s.ns.NotConfirmed {
-				firstColon := strings.Index(notConf, ":")
-				lastColon := strings.LastIndex(notConf, ":")
-				boxId := notConf[firstColon+1:lastColon]
-				betType := notConf[:firstColon]
+				// keys may carry a prefix, so they are read from the end
+				boxId := state.BetBoxId(notConf)
+				betType := state.BetGame(notConf)
 				// check if box id is spent
 				log.Debug("checking boxId", zap.String("box_id", boxId))
 				utxo, err := s.ergNode.GetErgUtxoBox(boxId)
@@ -122,11 +139,19 @@ loop:
 						log.Error("failed to get key from redis db", zap.Error(err), zap.String("redis_key", notConf))
 						continue
 					default:
+						// refunded bets notify the player of the returned stake
+						if bet["status"] == state.BetStatusRefunded {
+							betType = refundNotifType
+						}
+						tokenName := bet["tokenName"]
+						if tokenName == "" {
+							tokenName = "OWL"
+						}
 						notif := Notif{
 							Type: 		betType,
 							WalletAddr: bet["playerAddr"],
 							Amount: 	bet["winnerAmt"],
-							TokenName: 	"OWL",
+							TokenName: 	tokenName,
 							TxID: 		bet["txId"],
 						}
 						notifMar, err := json.Marshal(notif)
@@ -134,12 +159,25 @@ loop:
 							log.Error("failed to marshal notif struct", zap.Error(err), zap.Any("notif", notif))
 							continue
 						}
-						err = s.nats.Publish(viper.Get("nats.notif_payouts_subj").(string), notifMar)
+
+						// continue the trace of the bet started by the payout service
+						ctx, span := tracing.Start(tracing.FromTraceparent(s.ctx, bet["traceparent"]), "notif.publish",
+							attribute.String("erg_utxo_box_id", boxId),
+							attribute.String("type", notif.Type),
+						)
+						natsMsg := &nats.Msg{
+							Subject: broker.Subject(config.Current().NATS.NotifPayoutsSubj),
+							Data:    notifMar,
+						}
+						tracing.InjectNATS(ctx, natsMsg)
+						err = s.nats.PublishMsg(natsMsg)
+						tracing.End(span, err)
 						if err != nil {
+							metrics.NATSError("publish")
 							log.Error("failed to publish notif struct to notif payouts subject",
 								zap.Error(err),
 								zap.Any("notif", notif),
-								zap.String("nats_subject", viper.Get("nats.notif_payouts_subj").(string)),
+								zap.String("nats_subject", natsMsg.Subject),
 							)
 							continue
 						}
@@ -166,7 +204,7 @@ loop:
 			}
 		}
 
-		go wait(30 * time.Second, checkPayouts)
+		go wait(time.Duration(config.Current().Payout.NotifInterval)*time.Second, checkPayouts)
 	}
 }
 
@@ -198,12 +236,32 @@ func (s *Service) Wait(wg *sync.WaitGroup) {
 // handleNATSMessages is called on receipt of a new NATS message.
 func (s *Service) handleNATSMessages(msg *nats.Msg) {
 	var notif Notif
+
+	ctx, span := tracing.Start(tracing.ExtractNATS(s.ctx, msg), "notif.notify_player")
+	defer span.End()
+
 	err := json.Unmarshal(msg.Data, &notif)
 	if err != nil {
+		tracing.Fail(span, err)
 		log.Error("failed to unmarshal Notif", zap.Error(err))
 	} else {
+		span.SetAttributes(
+			attribute.String("type", notif.Type),
+			attribute.String("wallet_addr", notif.WalletAddr),
+			attribute.String("tx_id", notif.TxID),
+		)
+
+		if s.js != nil {
+			err = s.publishStream(ctx, notif, msg.Data)
+			if err == nil {
+				return
+			}
+			// keep the notification in redis rather than losing it
+			log.Error("failed to store notification in stream", zap.Error(err))
+		}
+
 		// attempt to send notification(s) to wallet address
-		subj := fmt.Sprintf("notif.%s", notif.WalletAddr)
+		subj := broker.Subject(fmt.Sprintf("notif.%s", notif.WalletAddr))
 		inbox := nats.NewInbox()
 		reply, err := s.nats.SubscribeSync(inbox)
 		if err != nil {
@@ -212,8 +270,16 @@ func (s *Service) handleNATSMessages(msg *nats.Msg) {
 		}
 		reply.AutoUnsubscribe(1)
 
-		err = s.nats.PublishRequest(subj, inbox, msg.Data)
+		playerMsg := &nats.Msg{
+			Subject: subj,
+			Reply:   inbox,
+			Data:    msg.Data,
+		}
+		tracing.InjectNATS(ctx, playerMsg)
+		err = s.nats.PublishMsg(playerMsg)
 		if err != nil {
+			tracing.Fail(span, err)
+			metrics.NATSError("publish")
 			log.Error("failed to publish notification to subject", zap.Error(err), zap.String("subject", subj))
 			return
 		}
@@ -226,6 +292,7 @@ func (s *Service) handleNATSMessages(msg *nats.Msg) {
 			zap.String("tx_id", notif.TxID),
 		)
 		_, err = reply.NextMsg(10 * time.Second)
+		span.SetAttributes(attribute.Bool("acked", err == nil))
 		if err != nil {
 			// if no ack received then we add it to redis db until player reconnects
 			log.Debug("notification ack not received",
@@ -236,7 +303,7 @@ func (s *Service) handleNATSMessages(msg *nats.Msg) {
 				zap.String("token_name", notif.TokenName),
 				zap.String("tx_id", notif.TxID),
 			)
-			key := fmt.Sprintf("notif:%s:%s:%s", notif.Type, notif.WalletAddr, notif.TxID)
+			key := state.Key(fmt.Sprintf("notif:%s:%s:%s", notif.Type, notif.WalletAddr, notif.TxID))
 			result, err := s.rdb.Get(s.ctx, key).Result()
 			switch {
 			case err == redis.Nil || result == "":
@@ -251,7 +318,7 @@ func (s *Service) handleNATSMessages(msg *nats.Msg) {
 				log.Error("failed to get key from redis db", zap.Error(err), zap.String("redis_key", key))
 			}
 		} else {
-			key := fmt.Sprintf("notif:%s:%s:%s", notif.Type, notif.WalletAddr, notif.TxID)
+			key := state.Key(fmt.Sprintf("notif:%s:%s:%s", notif.Type, notif.WalletAddr, notif.TxID))
 			log.Debug("notification ack received, removing notification from redis db", zap.String("redis_key", key))
 			_, err := s.rdb.Del(s.ctx, key).Result()
 			if err != nil {
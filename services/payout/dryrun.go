@@ -0,0 +1,122 @@
+package payout
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// DryRunNamespace prefixes every redis key written by a payout service
+	// running in dry-run mode.
+	DryRunNamespace       = "dryrun"
+	dryRunResultsRedisKey = "payout:results"
+)
+
+// DryRunResult is the outcome of a bet computed by a payout service in
+// dry-run mode, along with the unsigned tx it would have sent.
+type DryRunResult struct {
+	BoxId      string          `json:"boxId"`
+	Game       string          `json:"game"`
+	Kind       string          `json:"kind"`
+	PlayerAddr string          `json:"playerAddr"`
+	WinnerAddr string          `json:"winnerAddr"`
+	Subgame    int             `json:"subgame,omitempty"`
+	Chipspot   int             `json:"chipspot,omitempty"`
+	RandomNum  int             `json:"randomNum,omitempty"`
+	TokenId    string          `json:"tokenId,omitempty"`
+	Amount     int             `json:"amount"`
+	TxId       string          `json:"txId"`
+	TxUnsigned json.RawMessage `json:"txUnsigned"`
+	Time       int64           `json:"time"`
+}
+
+func (r DryRunResult) MarshalBinary() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// Recorder stores the results of a dry run.
+type Recorder interface {
+	Record(r DryRunResult) error
+}
+
+// dryRunSigner stands in for the real signer in dry-run mode. Txs are never
+// signed or submitted, the returned tx id is derived from the unsigned tx.
+type dryRunSigner struct{}
+
+func (dryRunSigner) SendTx(_ context.Context, payload []byte) ([]byte, error) {
+	hash := blake2b.Sum256(payload)
+	return []byte("dryrun-" + hex.EncodeToString(hash[:])), nil
+}
+
+// redisRecorder keeps the results in a hash keyed by the bet box id, inside
+// the dry-run namespace.
+type redisRecorder struct {
+	ctx context.Context
+	rdb redis.UniversalClient
+}
+
+func (r *redisRecorder) Record(res DryRunResult) error {
+	key := state.Key(dryRunResultsRedisKey)
+
+	err := r.rdb.HSet(r.ctx, key, res.BoxId, res).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set key '%s' in redis db - %s", key, err.Error())
+	}
+
+	return nil
+}
+
+// fileRecorder appends the results to a JSONL file.
+type fileRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileRecorder(path string) (*fileRecorder, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dry-run results file - %s", err.Error())
+	}
+
+	return &fileRecorder{file: f}, nil
+}
+
+func (r *fileRecorder) Record(res DryRunResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dry-run result - %s", err.Error())
+	}
+
+	_, err = r.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write dry-run result - %s", err.Error())
+	}
+
+	return nil
+}
+
+// record stores the result of a bet when running in dry-run mode.
+func (s *Service) record(res DryRunResult) {
+	if s.recorder == nil {
+		return
+	}
+
+	res.Time = time.Now().Unix()
+	err := s.recorder.Record(res)
+	if err != nil {
+		log.Error("failed to record dry-run result", zap.Error(err), zap.String("erg_utxo_box_id", res.BoxId))
+	}
+}
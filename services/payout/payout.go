@@ -2,24 +2,37 @@ package payout
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v9"
 	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/contracts"
 	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/metrics"
+	"github.com/nightowlcasino/nightowl/services/bankroll"
+	"github.com/nightowlcasino/nightowl/services/stats"
 	"github.com/nightowlcasino/nightowl/state"
+	"github.com/nightowlcasino/nightowl/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 const (
-	rouletteErgoTree    = "101b0400040004000402054a0e20473041c7e13b5f5947640f79f00d3c5df22fad4841191260350bb8c526f9851f040004000514052605380504050404020400040205040404050f05120406050604080509050c040a0e200ef2e4e25f93775412ac620a1da495943c55ea98e72f3e95d1a18d7ace2f676cd809d601b2a5730000d602b2db63087201730100d603b2db6501fe730200d604e4c672010404d605e4c6a70404d6069e7cb2e4c67203041a9a72047303007304d607e4c6a70504d6087e720705d6099972087206d1ed96830301938c7202017305938c7202028cb2db6308a77306000293b2b2e4c67203050c1a720400e4c67201050400c5a79597830601ed937205730795ec9072067308ed9272067309907206730a939e7206730b7208ed949e7206730c7208ec937207730d937207730eed937205730f939e720673107208eded937205731192720973129072097313ed9372057314939e720673157208eded937205731692720973179072097318ed9372057319937208720693c27201e4c6a7060e93cbc27201731a"
-	houseAddress        = "ofgUTY7c693MfaVxfuZ1YhG7RQuQCLqa7mqFHkkZcpo9r5oPmmXaemS3raHAzfP4MXXc7DiueGDFsrZ5Hp3ZK"
-	minerFee            = 1000000 // 0.0010 ERG
 	minBoxValue         = 1000000 // 0.0010 ERG
+	retryBackoff        = 2 * time.Minute
+	pendingBatchSize    = 500
+	invalidBetsRedisKey = "payout:invalid"
+	lastHeightRedisKey  = "oracle:lastBetHeight"
 )
 
 var (
@@ -31,14 +44,29 @@ type Service struct {
 	component   string
 	ergNode     *erg.ErgNode
 	ergExplorer *erg.Explorer
+	signer      erg.Signer
+	recorder    Recorder
+	contracts   *contracts.Registry
+	refundAfter int
+	maxAttempts int
+	queue       *state.BetQueue
+	txs         *state.TxTracker
+	players     *state.PlayerIndex
+	mu          sync.RWMutex
+	tokens      map[string]map[string]TokenLimits
+	bankroll    *bankroll.Service
+	nats        *nats.Conn
 	ns          *state.NotifState
-	rdb         *redis.Client
+	rdb         redis.UniversalClient
 	stop        chan bool
 	done        chan bool
 	wg          *sync.WaitGroup
+
+	// unix nano time the payout loop last made progress
+	heartbeat int64
 }
 
-func NewService(rdb *redis.Client, retryClient *retryablehttp.Client, ns *state.NotifState, wg *sync.WaitGroup) (service *Service, err error) {
+func NewService(nats *nats.Conn, rdb redis.UniversalClient, retryClient *retryablehttp.Client, reg *contracts.Registry, br *bankroll.Service, ns *state.NotifState, wg *sync.WaitGroup) (service *Service, err error) {
 
 	ctx := context.Background()
 	log = zap.L()
@@ -53,11 +81,56 @@ func NewService(rdb *redis.Client, retryClient *retryablehttp.Client, ns *state.
 		return nil, fmt.Errorf("failed to create erg node client - %s", err.Error())
 	}
 
+	var signer erg.Signer
+	var recorder Recorder
+
+	conf := config.Current()
+
+	// in dry-run mode txs are only built and recorded, never signed or sent
+	if conf.Payout.DryRun {
+		signer = dryRunSigner{}
+		if file := conf.Payout.DryRunFile; file != "" {
+			recorder, err = newFileRecorder(file)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			recorder = &redisRecorder{ctx: ctx, rdb: rdb}
+		}
+	} else {
+		// bet boxes are spent by the game contracts, not by a key. Only the
+		// refund path of a refundable contract goes without the oracle box.
+		scripts := make(map[string]bool)
+		for _, g := range reg.Games {
+			scripts[g.ErgoTree] = !g.Refundable
+		}
+		signer, err = erg.NewSigner(ergNodeClient, ergExplorerClient, scripts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create erg tx signer - %s", err.Error())
+		}
+	}
+
+	rouletteTokens, err := loadGameTokens(conf, contracts.Roulette, reg.TokenId("OWL"))
+	if err != nil {
+		return nil, err
+	}
+
 	service = &Service{
 		ctx:         ctx,
 		component:   "payout",
 		ergNode:     ergNodeClient,
 		ergExplorer: ergExplorerClient,
+		signer:      signer,
+		recorder:    recorder,
+		contracts:   reg,
+		refundAfter: conf.Payout.RefundExpiryBlocks,
+		maxAttempts: conf.Payout.MaxBetAttempts,
+		queue:       state.NewBetQueue(ctx, rdb),
+		txs:         state.NewTxTracker(ctx, rdb),
+		players:     state.NewPlayerIndex(ctx, rdb),
+		tokens:      map[string]map[string]TokenLimits{"roulette": rouletteTokens},
+		bankroll:    br,
+		nats:        nats,
 		ns:          ns,
 		rdb:         rdb,
 		stop:        make(chan bool),
@@ -65,9 +138,34 @@ func NewService(rdb *redis.Client, retryClient *retryablehttp.Client, ns *state.
 		wg:          wg,
 	}
 
+	config.OnReload("payout games", func(conf *config.Config) (func(), error) {
+		tokens, err := loadGameTokens(conf, contracts.Roulette, reg.TokenId("OWL"))
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			service.mu.Lock()
+			service.tokens = map[string]map[string]TokenLimits{"roulette": tokens}
+			service.mu.Unlock()
+		}, nil
+	})
+
 	return service, nil
 }
 
+// gameTokens returns the tokens accepted by a game.
+func (s *Service) gameTokens(game string) map[string]TokenLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.tokens[game]
+}
+
+// scanInterval is the time between two scans for new bets.
+func (s *Service) scanInterval() time.Duration {
+	return time.Duration(config.Current().Payout.ScanInterval) * time.Second
+}
+
 func wait(sleepTime time.Duration, c chan bool) {
 	time.Sleep(sleepTime)
 	c <- true
@@ -78,16 +176,16 @@ func (s *Service) payoutBets(stop chan bool) {
 	checkbets := make(chan bool, 1)
 
 	// get last known height stored in the redis db
-	lastBetHeight, err := s.rdb.Get(s.ctx, "oracle:lastBetHeight").Result()
+	lastBetHeight, err := s.rdb.Get(s.ctx, state.Key(lastHeightRedisKey)).Result()
 	switch {
 	case err == redis.Nil || lastBetHeight == "":
 		lastHeight = 0
-		err := s.rdb.Set(s.ctx, "oracle:lastBetHeight", lastHeight, 0).Err()
+		err := s.rdb.Set(s.ctx, state.Key(lastHeightRedisKey), lastHeight, 0).Err()
 		if err != nil {
-			log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", "oracle:lastBetHeight"))
+			log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", state.Key(lastHeightRedisKey)))
 		}
 	case err != nil:
-		log.Error("failed to get key from redis db", zap.Error(err), zap.String("redis_key", "oracle:lastBetHeight"))
+		log.Error("failed to get key from redis db", zap.Error(err), zap.String("redis_key", state.Key(lastHeightRedisKey)))
 	default:
 		lastHeight, _ = strconv.Atoi(lastBetHeight)
 	}
@@ -102,201 +200,461 @@ loop:
 			s.wg.Done()
 			break loop
 		case <-checkbets:
-			// clear structs
-			var ergTxs = erg.ErgBoxIds{}
-			var ergTxsBuff = erg.ErgBoxIds{}
-			var ergUtxo = erg.ErgTxOutputNode{}
-			var isSettled, allSettled bool
-			var txHeight int
-			limit := 50
-			offset := 0
-			// Need to keep retrying if this fails
+			// bets are not settled while their results can not be recorded
+			if err := s.rdb.Ping(s.ctx).Err(); err != nil {
+				log.Warn("redis db is unreachable, not settling bets", zap.Error(err))
+				go wait(s.scanInterval(), checkbets)
+				continue
+			}
+
+			s.beat()
+
 			currHeight, err := s.ergNode.GetCurrenHeight()
 			if err != nil {
 				log.Error("failed to get current erg height", zap.Error(err))
+				go wait(s.scanInterval(), checkbets)
+				continue
 			}
 
-			// continuously call GetOracleTxs() until we get all txs
-			start := time.Now()
-			for {
-				start1 := time.Now()
-				ergTxsBuff, err = s.ergExplorer.GetOracleTxs(lastHeight, currHeight, limit, offset)
+			// the scan cursor only depends on having queued every bet, not on settling them
+			txHeight, err := s.scanOracleTxs(lastHeight, currHeight)
+			if err != nil {
+				log.Error("failed to queue bets from oracle txs", zap.Error(err), zap.Int("last_height", lastHeight))
+			} else if txHeight > lastHeight {
+				err = s.rdb.Set(s.ctx, state.Key(lastHeightRedisKey), txHeight, 0).Err()
 				if err != nil {
-					log.Error("failed to get oracle txs",
-						zap.Error(err),
-						zap.Int64("durationMs",time.Since(start).Milliseconds()),
-						zap.Int("last_height", lastHeight),
-						zap.Int("curr_height", currHeight),
-						zap.Int("limit", limit),
-						zap.Int("offset", offset),
-					)
-					continue
+					log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", state.Key(lastHeightRedisKey)))
+				} else {
+					lastHeight = txHeight
 				}
-				log.Debug("received erg txs",
-					zap.Int("tx_count", len(ergTxsBuff.Items)),
-					zap.Int64("durationMs", time.Since(start1).Milliseconds()),
-					zap.Int("last_height", lastHeight),
-					zap.Int("curr_height", currHeight),
-					zap.Int("limit", limit),
-					zap.Int("offset", offset),
-				)
+			}
 
-				if len(ergTxsBuff.Items) == 0 {
-					break
-				}
+			if stopped := s.resolvePendingBets(stop, currHeight); stopped {
+				log.Info("stopping payoutBets() loop...")
+				s.wg.Done()
+				break loop
+			}
+
+			// start timer in separate go routine
+			go wait(s.scanInterval(), checkbets)
+		}
+	}
+}
+
+func (s *Service) beat() {
+	atomic.StoreInt64(&s.heartbeat, time.Now().UnixNano())
+}
+
+// Heartbeat returns when the payout loop last made progress, the zero time if
+// it has not run yet.
+func (s *Service) Heartbeat() time.Time {
+	last := atomic.LoadInt64(&s.heartbeat)
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+// scanOracleTxs fetches every oracle tx between lastHeight and currHeight and
+// adds the bets they reference to the pending queue. It returns the highest
+// oracle tx height seen.
+func (s *Service) scanOracleTxs(lastHeight, currHeight int) (txHeight int, err error) {
+	ctx, span := tracing.Start(s.ctx, "payout.scan",
+		attribute.Int("last_height", lastHeight),
+		attribute.Int("curr_height", currHeight),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	ergTxs := s.fetchOracleTxs(ctx, lastHeight, currHeight)
+
+	for _, ergTx := range ergTxs.Items {
+		if ergTx.Height > txHeight {
+			txHeight = ergTx.Height
+		}
 
-				offset += limit
-				ergTxs.Items = append(ergTxs.Items, ergTxsBuff.Items...)
+		for _, pb := range oracleTxBets(ergTx) {
+			// the bet is resolved in later spans of the scan trace
+			_, betSpan := tracing.Start(ctx, "payout.queue_bet", attribute.String("erg_utxo_box_id", pb.BoxId))
+			pb.TraceParent = tracing.Traceparent(trace.ContextWithSpan(ctx, betSpan))
+			err := s.queue.Enqueue(pb)
+			tracing.End(betSpan, err)
+			if err != nil {
+				return 0, err
 			}
-			log.Info("finished getting all oracle txs",
-				zap.Int("total_txs", len(ergTxs.Items)),
-				zap.Int64("durationMs", time.Since(start).Milliseconds()),
+		}
+	}
+
+	return txHeight, nil
+}
+
+// fetchOracleTxs returns every oracle tx between lastHeight and currHeight.
+func (s *Service) fetchOracleTxs(ctx context.Context, lastHeight, currHeight int) erg.ErgBoxIds {
+	var ergTxs = erg.ErgBoxIds{}
+	var ergTxsBuff = erg.ErgBoxIds{}
+	var err error
+	limit := 50
+	offset := 0
+
+	// continuously call GetOracleTxs() until we get all txs
+	start := time.Now()
+	for {
+		start1 := time.Now()
+		ergTxsBuff, err = s.ergExplorer.WithContext(ctx).GetOracleTxs(s.contracts.OracleAddress, lastHeight, currHeight, limit, offset)
+		if err != nil {
+			log.Error("failed to get oracle txs",
+				zap.Error(err),
+				zap.Int64("durationMs",time.Since(start).Milliseconds()),
+				zap.Int("last_height", lastHeight),
+				zap.Int("curr_height", currHeight),
+				zap.Int("limit", limit),
+				zap.Int("offset", offset),
 			)
+			continue
+		}
+		log.Debug("received erg txs",
+			zap.Int("tx_count", len(ergTxsBuff.Items)),
+			zap.Int64("durationMs", time.Since(start1).Milliseconds()),
+			zap.Int("last_height", lastHeight),
+			zap.Int("curr_height", currHeight),
+			zap.Int("limit", limit),
+			zap.Int("offset", offset),
+		)
 
-			for _, ergTx := range ergTxs.Items {
-				// assume all bets are settled until proven otherwise
-				allSettled = true
+		if len(ergTxsBuff.Items) == 0 {
+			break
+		}
 
-				if ergTx.Height > txHeight {
-					txHeight = ergTx.Height
-				}
-				// convert R4 rendered value to []string
-				r4 := ergTx.Outputs[0].AdditionalRegisters.R4.Value
-				// remove surrounding brackets [ and ]
-				r4 = strings.TrimPrefix(r4, "[")
-				r4 = strings.TrimSuffix(r4, "]")
-				randNumbers := strings.Split(r4, ",")
-
-				// convert R5 rendered value to [][]string
-				r5 := ergTx.Outputs[0].AdditionalRegisters.R5.Value
-				// remove surrounding brackets [ and ]
-				r5 = strings.TrimPrefix(r5, "[")
-				r5 = strings.TrimSuffix(r5, "]")
-				// add , to the back of string to help for the split
-				r5 = r5 + ","
-				ergBoxIdsSlices := strings.Split(r5, "],")
-				// remove last element because it's empty
-				ergBoxIdsSlices = ergBoxIdsSlices[:len(ergBoxIdsSlices)-1]
-
-				for i, ergBoxIdsSlice := range ergBoxIdsSlices {
-
-					// remove leading [
-					ergBoxIdsClean := strings.TrimPrefix(ergBoxIdsSlice, "[")
-					ergBoxIds := strings.Split(ergBoxIdsClean, ",")
-
-					if len(ergBoxIds) > 0 && ergBoxIds[0] != "" {
-						for j, boxId := range ergBoxIds {
-							// check if stop signal was triggered or we are stuck in this loop
-							select {
-							case <-stop:
-								log.Info("stopping payoutBets() loop...")
-								break loop
-							default:
-								start := time.Now()
-								ergUtxo, err = s.ergNode.GetErgUtxoBox(boxId)
-								if err != nil {
-									log.Error("failed to get erg utxo box",
-										zap.Int64("durationMs", time.Since(start).Milliseconds()),
-										zap.String("erg_utxo_box_id", boxId),
-									)
-								} else {
-									log.Debug("successfully got erg utxo box",
-										zap.Int64("durationMs", time.Since(start).Milliseconds()),
-										zap.String("erg_utxo_box_id", boxId),
-									)
-								}
-
-								// check that bet ergoTree is the roulette house contract
-								if ergUtxo.ErgoTree == rouletteErgoTree {
-									startBet := time.Now()
-
-									plyrAddr, _ := s.ergNode.ErgoTreeToAddress(ergUtxo.AdditionalRegisters.R6[4:])
-
-									// check if bet exists in redis db
-									bet, err := s.rdb.HGetAll(s.ctx, "roulette:"+ergUtxo.BoxId+":"+plyrAddr).Result()
-									switch {
-									case err == redis.Nil || len(bet) == 0:
-										isSettled = false
-										var randNum string
-										if i+1 <= len(randNumbers)-1 {
-											randNum = randNumbers[i+1]
-										}
-
-										b := make(map[string]string)
-										b["settled"]    = "false"
-										b["confirmed"]  = "false"
-										b["winnerAmt"]  = strconv.Itoa(ergUtxo.Assets[0].Amount)
-										b["winnerAddr"] = ""
-										b["subgame"]    = ergUtxo.AdditionalRegisters.R4
-										b["number"]     = ergUtxo.AdditionalRegisters.R5
-										b["randomNum"]  = randNum
-
-										// add bet to redis db
-										err := s.rdb.HSet(s.ctx, "roulette:"+ergUtxo.BoxId+":"+plyrAddr, b).Err()
-										if err != nil {
-											log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", "roulette:"+ergUtxo.BoxId+":"+plyrAddr))
-										}
-
-										if randNum != "" {
-											err := s.processBet(b, ergUtxo, ergTx, plyrAddr, i, j)
-											if err != nil {
-												log.Error("failed to process bet", zap.Error(err))
-											} else {
-												isSettled = true
-											}
-										}
-
-									case err != nil:
-										log.Error("failed to get key from redis db", zap.Error(err), zap.String("redis_key", "roulette:"+ergUtxo.BoxId+":"+plyrAddr))
-									default:
-										if bet["randomNum"] == "" {
-											if i+1 <= len(randNumbers)-1 {
-												bet["randomNum"] = randNumbers[i+1]
-												err := s.rdb.HSet(s.ctx, "roulette:"+ergUtxo.BoxId+":"+plyrAddr, "randomNum", randNumbers[i+1]).Err()
-												if err != nil {
-													log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", "roulette:"+ergUtxo.BoxId+":"+plyrAddr))
-												}
-											}
-										}
-
-										// check if settled already
-										isSettled, _ = strconv.ParseBool(bet["settled"])
-										if !isSettled && bet["randomNum"] != "" {
-											err := s.processBet(bet, ergUtxo, ergTx, plyrAddr, i, j)
-											if err != nil {
-												log.Error("failed to process bet", zap.Error(err))
-											} else {
-												isSettled = true
-											}
-										}
-									}
-
-									log.Info("finished processing roulette bet", zap.Int64("durationMs", time.Since(startBet).Milliseconds()), zap.String("erg_utxo_box_id", ergUtxo.BoxId))
-								}
-							}
-						}
-					}
-					if !isSettled {
-						allSettled = false
-					}
-				}
-				if allSettled {
-					// change lastBetHeight if we know we have successfully settled every bet which has
-					// a height less than lastBetHeight
-					if txHeight > lastHeight {
-						err = s.rdb.Set(s.ctx, "oracle:lastBetHeight", txHeight, 0).Err()
-						if err != nil {
-							log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", "oracle:lastBetHeight"))
-						}
-						lastHeight = txHeight
-					}
-				}
+		offset += limit
+		ergTxs.Items = append(ergTxs.Items, ergTxsBuff.Items...)
+	}
+	log.Info("finished getting all oracle txs",
+		zap.Int("total_txs", len(ergTxs.Items)),
+		zap.Int64("durationMs", time.Since(start).Milliseconds()),
+	)
+
+	return ergTxs
+}
+
+// oracleTxBets decodes the bet box ids held in R5 of an oracle tx along with
+// the random number from R4 each of them is resolved with.
+func oracleTxBets(ergTx erg.ErgTx) []state.PendingBet {
+	var bets []state.PendingBet
+
+	// convert R4 rendered value to []string
+	r4 := ergTx.Outputs[0].AdditionalRegisters.R4.Value
+	// remove surrounding brackets [ and ]
+	r4 = strings.TrimPrefix(r4, "[")
+	r4 = strings.TrimSuffix(r4, "]")
+	randNumbers := strings.Split(r4, ",")
+
+	// convert R5 rendered value to [][]string
+	r5 := ergTx.Outputs[0].AdditionalRegisters.R5.Value
+	// remove surrounding brackets [ and ]
+	r5 = strings.TrimPrefix(r5, "[")
+	r5 = strings.TrimSuffix(r5, "]")
+	// add , to the back of string to help for the split
+	r5 = r5 + ","
+	ergBoxIdsSlices := strings.Split(r5, "],")
+	// remove last element because it's empty
+	ergBoxIdsSlices = ergBoxIdsSlices[:len(ergBoxIdsSlices)-1]
+
+	for i, ergBoxIdsSlice := range ergBoxIdsSlices {
+		// remove leading [
+		ergBoxIdsClean := strings.TrimPrefix(ergBoxIdsSlice, "[")
+		ergBoxIds := strings.Split(ergBoxIdsClean, ",")
+
+		if len(ergBoxIds) == 0 || ergBoxIds[0] == "" {
+			continue
+		}
+
+		// the random number of a slot is the hash following it
+		var randNum string
+		if i+1 <= len(randNumbers)-1 {
+			randNum = randNumbers[i+1]
+		}
+
+		for j, boxId := range ergBoxIds {
+			bets = append(bets, state.PendingBet{
+				BoxId:       boxId,
+				OracleTxId:  ergTx.Id,
+				OracleBoxId: ergTx.Outputs[0].BoxId,
+				Height:      ergTx.Height,
+				PosX:        i,
+				PosY:        j,
+				RandNum:     randNum,
+			})
+		}
+	}
+
+	return bets
+}
+
+// resolvePendingBets works through every bet in the pending queue which is due
+// for an attempt. It returns true if a stop signal was received.
+func (s *Service) resolvePendingBets(stop chan bool, currHeight int) bool {
+	start := time.Now()
+
+	due, err := s.queue.Due(start, pendingBatchSize)
+	if err != nil {
+		log.Error("failed to get pending bets", zap.Error(err))
+		return false
+	}
+
+	for _, pb := range due {
+		// check if stop signal was triggered or we are stuck in this loop
+		select {
+		case <-stop:
+			return true
+		default:
+		}
+
+		s.beat()
+
+		ctx, span := tracing.Start(tracing.FromTraceparent(s.ctx, pb.TraceParent), "payout.resolve_bet",
+			attribute.String("erg_utxo_box_id", pb.BoxId),
+			attribute.Int("attempt", pb.Attempts+1),
+		)
+		resolved, err := s.resolveBet(ctx, pb, currHeight)
+		span.SetAttributes(attribute.Bool("resolved", resolved))
+		tracing.End(span, err)
+		switch {
+		case err != nil:
+			dead, qerr := s.queue.Fail(pb, err, s.maxAttempts, retryBackoff)
+			if qerr != nil {
+				log.Error("failed to record failed bet attempt", zap.Error(qerr), zap.String("erg_utxo_box_id", pb.BoxId))
 			}
-			
-			// start timer in separate go routine
-			go wait(2 * time.Minute, checkbets)
+			metrics.BetFailed(contracts.Roulette)
+			if dead {
+				metrics.BetDeadLettered(contracts.Roulette)
+				log.Error("bet moved to dead letter set",
+					zap.Error(err),
+					zap.String("erg_utxo_box_id", pb.BoxId),
+					zap.Int("attempts", pb.Attempts+1),
+				)
+			} else {
+				log.Error("failed to resolve bet", zap.Error(err), zap.String("erg_utxo_box_id", pb.BoxId), zap.Int("attempts", pb.Attempts+1))
+			}
+		case resolved:
+			err = s.queue.Remove(pb.BoxId)
+			if err != nil {
+				log.Error("failed to remove resolved bet from queue", zap.Error(err), zap.String("erg_utxo_box_id", pb.BoxId))
+			}
+		default:
+			// still waiting on a random number, which comes with a later block
+			err = s.queue.Defer(pb.BoxId, time.Now().Add(retryBackoff))
+			if err != nil {
+				log.Error("failed to defer pending bet", zap.Error(err), zap.String("erg_utxo_box_id", pb.BoxId))
+			}
+		}
+	}
+
+	log.Info("finished resolving pending bets",
+		zap.Int("total_bets", len(due)),
+		zap.Int64("durationMs", time.Since(start).Milliseconds()),
+	)
+
+	return false
+}
+
+// resolveBet settles or refunds a single pending bet. It returns true once the
+// bet needs no further attention and false if it is still waiting on its
+// random number.
+func (s *Service) resolveBet(ctx context.Context, pb state.PendingBet, currHeight int) (bool, error) {
+	ergNode := s.ergNode.WithContext(ctx)
+
+	start := time.Now()
+	fetchCtx, span := tracing.Start(ctx, "payout.fetch_box", attribute.String("erg_utxo_box_id", pb.BoxId))
+	ergUtxo, err := s.ergNode.WithContext(fetchCtx).GetErgUtxoBox(pb.BoxId)
+	tracing.End(span, err)
+	if err != nil {
+		log.Error("failed to get erg utxo box",
+			zap.Int64("durationMs", time.Since(start).Milliseconds()),
+			zap.String("erg_utxo_box_id", pb.BoxId),
+		)
+		return false, fmt.Errorf("failed to get erg utxo box - %s", err.Error())
+	}
+	log.Debug("successfully got erg utxo box",
+		zap.Int64("durationMs", time.Since(start).Milliseconds()),
+		zap.String("erg_utxo_box_id", pb.BoxId),
+	)
+
+	// spent boxes and bets of other games are nothing for us to do
+	if ergUtxo.ErgoTree != s.contracts.GameErgoTree(contracts.Roulette) {
+		return true, nil
+	}
+
+	// bets of a disabled game stay queued until it is enabled again, an
+	// operator is alerted of the ones expiring meanwhile
+	if !config.Current().GameEnabled(contracts.Roulette) {
+		if !s.betExpired(ergUtxo, currHeight) {
+			log.Debug("roulette is disabled, deferring bet", zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+			return false, nil
+		}
+		log.Warn("roulette is disabled, deferring expired bet", zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+		s.alertOnce(Alert{
+			Type:   gameDisabledAlert,
+			BoxId:  ergUtxo.BoxId,
+			Reason: "bet expired while roulette is disabled",
+		})
+		return false, nil
+	}
+
+	limits, reason := validateBet(ergUtxo, s.gameTokens("roulette"))
+	if reason != "" {
+		log.Warn("skipping invalid roulette bet", zap.String("erg_utxo_box_id", ergUtxo.BoxId), zap.String("reason", reason))
+		err := s.rdb.HSet(s.ctx, state.Key(invalidBetsRedisKey), ergUtxo.BoxId, reason).Err()
+		if err != nil {
+			log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", state.Key(invalidBetsRedisKey)))
 		}
+		return true, nil
 	}
+
+	startBet := time.Now()
+	defer func() {
+		log.Info("finished processing roulette bet", zap.Int64("durationMs", time.Since(startBet).Milliseconds()), zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+	}()
+
+	plyrAddr, err := ergNode.ErgoTreeToAddress(ergUtxo.AdditionalRegisters.R6[4:])
+	if err != nil {
+		return false, fmt.Errorf("failed to get player address - %s", err.Error())
+	}
+	betKey := state.Key("roulette:" + ergUtxo.BoxId + ":" + plyrAddr)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("wallet_addr", plyrAddr))
+
+	exposure := betExposure(ergUtxo)
+
+	// check if bet exists in redis db
+	bet, err := s.rdb.HGetAll(s.ctx, betKey).Result()
+	switch {
+	// bets detected in the mempool only hold what was known before they were mined
+	case err == redis.Nil || len(bet) == 0 || bet["status"] == state.BetStatusDetected:
+		// new bets are held back while the bankroll can not take on more exposure
+		if !s.bankroll.AcceptingAllowed() {
+			log.Warn("accepting bets is paused, deferring new bet", zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+			return false, nil
+		}
+
+		// bets which could win more than the max single payout are not taken
+		// on, an operator decides what happens to them
+		if err := s.bankroll.CheckPayout(limits.Id, exposure); err != nil {
+			log.Warn("bet exceeds the max single payout, deferring", zap.Error(err), zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+			s.alertOnce(Alert{
+				Type:   betOverLimitAlert,
+				BoxId:  ergUtxo.BoxId,
+				BetKey: betKey,
+				Reason: err.Error(),
+			})
+			return false, nil
+		}
+
+		err = s.bankroll.AddExposure(limits.Id, exposure)
+		switch {
+		case errors.Is(err, bankroll.ErrExposureLimit):
+			log.Warn("bet exceeds the bankroll limits, deferring new bet", zap.Error(err), zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+
+		// bets detected in the mempool are listed from the time they were seen
+		createdAt, _ := strconv.ParseInt(bet["detectedAt"], 10, 64)
+		if createdAt == 0 {
+			createdAt = time.Now().Unix()
+		}
+		if len(bet) == 0 {
+			metrics.BetDetected(contracts.Roulette, "oracle")
+		}
+
+		bet = make(map[string]string)
+		bet["status"]     = state.BetStatusPending
+		bet["settled"]    = "false"
+		bet["confirmed"]  = "false"
+		bet["winnerAmt"]  = strconv.Itoa(ergUtxo.Assets[0].Amount)
+		bet["stake"]      = strconv.Itoa(ergUtxo.Assets[0].Amount)
+		bet["tokenId"]    = limits.Id
+		bet["tokenName"]  = limits.Name
+		bet["winnerAddr"] = ""
+		bet["playerAddr"] = plyrAddr
+		bet["subgame"]    = ergUtxo.AdditionalRegisters.R4
+		bet["number"]     = ergUtxo.AdditionalRegisters.R5
+		bet["randomNum"]  = pb.RandNum
+		bet["exposure"]   = strconv.Itoa(exposure)
+		bet["createdAt"]  = strconv.FormatInt(createdAt, 10)
+
+		// add bet to redis db, a retry would add the exposure again. Bets
+		// detected in the mempool expire unless they are picked up here.
+		_, err := s.rdb.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(s.ctx, betKey, bet)
+			pipe.Persist(s.ctx, betKey)
+			return nil
+		})
+		if err != nil {
+			if rerr := s.bankroll.RemoveExposure(limits.Id, exposure); rerr != nil {
+				log.Error("failed to release bet exposure", zap.Error(rerr), zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+			}
+			return false, fmt.Errorf("failed to set key '%s' in redis db - %s", betKey, err.Error())
+		}
+
+		err = s.players.Add(plyrAddr, betKey, createdAt)
+		if err != nil {
+			log.Error("failed to index bet of player", zap.Error(err), zap.String("redis_key", betKey))
+		}
+	case err != nil:
+		return false, fmt.Errorf("failed to get key '%s' from redis db - %s", betKey, err.Error())
+	default:
+		if bet["randomNum"] == "" && pb.RandNum != "" {
+			bet["randomNum"] = pb.RandNum
+			err := s.rdb.HSet(s.ctx, betKey, "randomNum", pb.RandNum).Err()
+			if err != nil {
+				log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", betKey))
+			}
+		}
+	}
+
+	// check if settled already
+	if isSettled, _ := strconv.ParseBool(bet["settled"]); isSettled {
+		return true, nil
+	}
+
+	if !s.bankroll.SettlingAllowed() {
+		log.Warn("settling bets is paused, deferring bet", zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+		return false, nil
+	}
+
+	switch {
+	case bet["randomNum"] != "":
+		err := s.processBet(ctx, bet, ergUtxo, pb, plyrAddr)
+		if err != nil {
+			return false, fmt.Errorf("failed to process bet - %s", err.Error())
+		}
+	case s.betExpired(ergUtxo, currHeight):
+		// the tx would never be accepted, an operator has to step in
+		if !s.contracts.GameRefundable(contracts.Roulette) {
+			log.Warn("bet expired but the roulette contract has no refund path", zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+			s.alertOnce(Alert{
+				Type:   betExpiredAlert,
+				BoxId:  ergUtxo.BoxId,
+				BetKey: betKey,
+				Reason: "bet expired without a random number and the roulette contract can not refund it",
+			})
+			return false, nil
+		}
+		err := s.refundBet(ctx, pb, ergUtxo, plyrAddr)
+		if err != nil {
+			return false, fmt.Errorf("failed to refund bet - %s", err.Error())
+		}
+	default:
+		return false, nil
+	}
+
+	// the bet can no longer be paid out, release its exposure
+	exposure, _ = strconv.Atoi(bet["exposure"])
+	err = s.bankroll.RemoveExposure(bet["tokenId"], exposure)
+	if err != nil {
+		log.Error("failed to release bet exposure", zap.Error(err), zap.String("erg_utxo_box_id", ergUtxo.BoxId))
+	}
+
+	return true, nil
 }
 
 func (s *Service) Start() {
@@ -305,14 +663,19 @@ func (s *Service) Start() {
 	s.wg.Add(1)
 	go s.payoutBets(stopPayout)
 
+	stopWatch := make(chan bool)
+	s.wg.Add(1)
+	go s.watchTxs(stopWatch)
+
 	// Wait for a "stop" message in the background to stop the service.
-	go func(stopPayout chan bool) {
+	go func(stopPayout, stopWatch chan bool) {
 		go func() {
 			<-s.stop
 			stopPayout <- true
+			stopWatch <- true
 			s.done <- true
 		}()
-	}(stopPayout)
+	}(stopPayout, stopWatch)
 }
 
 func (s *Service) Stop() {
@@ -324,46 +687,61 @@ func (s *Service) Wait(wg *sync.WaitGroup) {
 	<-s.done
 }
 
-func (s *Service) processBet(bet map[string]string, box erg.ErgTxOutputNode, tx erg.ErgTx, plyrAddr string, boxPosX, boxPosY int) error {
+func (s *Service) processBet(ctx context.Context, bet map[string]string, box erg.ErgTxOutputNode, pb state.PendingBet, plyrAddr string) error {
 	var winnerAddr, betKey string
 
-	betKey = fmt.Sprintf("roulette:%s:%s", box.BoxId, plyrAddr)
+	betKey = state.Key(fmt.Sprintf("roulette:%s:%s", box.BoxId, plyrAddr))
+	minerFee := config.Current().Payout.MinerFee
 
 	// figure out winner and create tx to send to result contract address
 	randNum, err := getRandNum(bet["randomNum"])
 	if err != nil {
 		return fmt.Errorf("failed to parse random number from key '%s' - %s", betKey, err)
 	} else {
-		serializedBetBox, err := s.ergNode.SerializeErgBox(box.BoxId)
+		buildCtx, span := tracing.Start(ctx, "payout.build_tx", attribute.String("kind", state.BetStatusSettled))
+		ergNode := s.ergNode.WithContext(buildCtx)
+		serializedBetBox, err := ergNode.SerializeErgBox(box.BoxId)
 		if err != nil {
+			tracing.End(span, err)
 			return fmt.Errorf("call to SerializeErgBox with serializedBetBox failed - %s", err.Error())
 		}
-		serializedOracleBox, _ := s.ergNode.SerializeErgBox(tx.Outputs[0].BoxId)
+		serializedOracleBox, err := ergNode.SerializeErgBox(pb.OracleBoxId)
 		if err != nil {
+			tracing.End(span, err)
 			return fmt.Errorf("call to SerializeErgBox with serializedOracleBox failed - %s", err.Error())
 		}
 
-		subgame, _ := strconv.Atoi(bet["subgame"][2:])
-		chipspot, _ := strconv.Atoi(bet["number"][2:])
-		sg := decodeZigZag64(uint64(subgame))
-		cs := decodeZigZag64(uint64(chipspot))
+		sg, err := decodeIntRegister(bet["subgame"])
+		if err != nil {
+			span.End()
+			return fmt.Errorf("failed to decode subgame of key '%s' - %s", betKey, err.Error())
+		}
+		cs, err := decodeIntRegister(bet["number"])
+		if err != nil {
+			span.End()
+			return fmt.Errorf("failed to decode chipspot of key '%s' - %s", betKey, err.Error())
+		}
 
-		winner := winner(int(sg), int(cs), randNum)
+		winner := winner(sg, cs, randNum)
 		if winner {
 			winnerAddr = plyrAddr
 		} else {
-			winnerAddr = houseAddress
+			winnerAddr = s.contracts.HouseAddress
 		}
 		
 		start := time.Now()
-		txUnsigned, _ := buildResultSmartContractTx(box, encodeZigZag64(uint64(boxPosX)), encodeZigZag64(uint64(boxPosY)), winnerAddr, serializedBetBox, serializedOracleBox)
+		txUnsigned, _ := buildResultSmartContractTx(box, encodeZigZag64(uint64(pb.PosX)), encodeZigZag64(uint64(pb.PosY)), winnerAddr, serializedBetBox, serializedOracleBox, minerFee)
 		log.Debug("unsigned erg tx created",
 			zap.Int64("durationMs", time.Since(start).Milliseconds()),
 			zap.String("txUnsigned", string(txUnsigned)),
 		)
+		span.SetAttributes(attribute.Bool("winner", winner), attribute.Int("random_number", randNum))
+		span.End()
 		
 		start = time.Now()
-		txSigned, err := s.ergNode.PostErgOracleTx(txUnsigned)
+		sendCtx, span := tracing.Start(ctx, "payout.send_tx", attribute.String("kind", state.BetStatusSettled))
+		txSigned, err := s.signer.SendTx(sendCtx, txUnsigned)
+		tracing.End(span, err)
 		if err != nil {
 			log.Error("post erg tx failed", zap.Error(err), zap.Int64("durationMs", time.Since(start).Milliseconds()))
 			return fmt.Errorf("call to PostErgOracleTx failed - %s", err.Error())
@@ -375,15 +753,36 @@ func (s *Service) processBet(bet map[string]string, box erg.ErgTxOutputNode, tx
 			zap.String("winner_addr", winnerAddr),
 			zap.Int("winner_amount", box.Assets[0].Amount),
 			zap.Int("random_number", randNum),
-			zap.Int("subgame", int(sg)),
-			zap.Int("chipspot", int(cs)),
+			zap.Int("subgame", sg),
+			zap.Int("chipspot", cs),
 		)
 
+		settlement := rouletteSettlement(box, bet["tokenName"], plyrAddr, sg, cs, randNum)
+		s.trackTx(pb, betKey, state.BetStatusSettled, txSigned, txUnsigned, minerFee, settlement)
+
+		s.record(DryRunResult{
+			BoxId:      box.BoxId,
+			Game:       contracts.Roulette,
+			Kind:       state.BetStatusSettled,
+			PlayerAddr: plyrAddr,
+			WinnerAddr: winnerAddr,
+			Subgame:    sg,
+			Chipspot:   cs,
+			RandomNum:  randNum,
+			TokenId:    box.Assets[0].TokenId,
+			Amount:     box.Assets[0].Amount,
+			TxId:       string(txSigned),
+			TxUnsigned: txUnsigned,
+		})
+
 		// add tx id and winner address to the payout entry in redis
 		addons := make(map[string]interface{})
 		addons["txId"] = string(txSigned)
 		addons["winnerAddr"] = string(winnerAddr)
 		addons["settled"] = "true"
+		addons["status"] = state.BetStatusSettled
+		// the notif service continues the trace of the bet from here
+		addons["traceparent"] = tracing.Traceparent(ctx)
 
 		err = s.rdb.HSet(s.ctx, betKey, addons).Err()
 		if err != nil {
@@ -391,15 +790,144 @@ func (s *Service) processBet(bet map[string]string, box erg.ErgTxOutputNode, tx
 		}
 
 		// update NotifState with bet redis key if winner is not the house
-		if winnerAddr != houseAddress {
+		if winnerAddr != s.contracts.HouseAddress {
 			s.ns.AddNotConfirmed(betKey)
 		}
+
 	}
 
 	return nil
 }
 
-func buildResultSmartContractTx(betUtxo erg.ErgTxOutputNode, r4, r5 uint64, winnerAddress, betDataInput, oracleDataInput string) ([]byte, error) {
+// rouletteSettlement returns the stats of a settled roulette bet. A winner is
+// paid what the result tx moves, the tokens of the bet box.
+func rouletteSettlement(box erg.ErgTxOutputNode, tokenName, plyrAddr string, subgame, chipspot, randNum int) stats.Settlement {
+	stake := box.Assets[0].Amount
+	settlement := stats.Settlement{
+		Game:           contracts.Roulette,
+		TokenName:      tokenName,
+		PlayerAddr:     plyrAddr,
+		Stake:          stake,
+		ExpectedPayout: expectedPayout(subgame, chipspot, stake),
+		Subgame:        subgame,
+		Chipspot:       chipspot,
+		RandomNum:      randNum,
+		Time:           time.Now(),
+	}
+	if winner(subgame, chipspot, randNum) {
+		settlement.Payout = box.Assets[0].Amount
+	}
+
+	return settlement
+}
+
+// betExpired reports whether a bet which never received a random number is
+// old enough to be refunded to the player, if its contract allows it.
+func (s *Service) betExpired(box erg.ErgTxOutputNode, currHeight int) bool {
+	return s.refundAfter > 0 && box.CreationHeight > 0 && currHeight-box.CreationHeight >= s.refundAfter
+}
+
+func (s *Service) refundBet(ctx context.Context, pb state.PendingBet, box erg.ErgTxOutputNode, plyrAddr string) error {
+	betKey := state.Key(fmt.Sprintf("roulette:%s:%s", box.BoxId, plyrAddr))
+	minerFee := config.Current().Payout.MinerFee
+
+	buildCtx, span := tracing.Start(ctx, "payout.build_tx", attribute.String("kind", state.BetStatusRefunded))
+	serializedBetBox, err := s.ergNode.WithContext(buildCtx).SerializeErgBox(box.BoxId)
+	if err != nil {
+		tracing.End(span, err)
+		return fmt.Errorf("call to SerializeErgBox with serializedBetBox failed - %s", err.Error())
+	}
+
+	start := time.Now()
+	txUnsigned, _ := buildRefundTx(box, plyrAddr, serializedBetBox, minerFee)
+	log.Debug("unsigned erg refund tx created",
+		zap.Int64("durationMs", time.Since(start).Milliseconds()),
+		zap.String("txUnsigned", string(txUnsigned)),
+	)
+	span.End()
+
+	start = time.Now()
+	sendCtx, span := tracing.Start(ctx, "payout.send_tx", attribute.String("kind", state.BetStatusRefunded))
+	txSigned, err := s.signer.SendTx(sendCtx, txUnsigned)
+	tracing.End(span, err)
+	if err != nil {
+		log.Error("post erg refund tx failed", zap.Error(err), zap.Int64("durationMs", time.Since(start).Milliseconds()))
+		return fmt.Errorf("call to SendTx failed - %s", err.Error())
+	}
+	log.Info("successfully sent refund tx",
+		zap.Int64("durationMs", time.Since(start).Milliseconds()),
+		zap.String("tx_id", string(txSigned)),
+		zap.String("erg_utxo_box_id", box.BoxId),
+		zap.String("player_addr", plyrAddr),
+	)
+
+	settlement := stats.Settlement{Game: contracts.Roulette, PlayerAddr: plyrAddr, Time: time.Now()}
+	if len(box.Assets) > 0 {
+		settlement.TokenName = s.contracts.TokenName(box.Assets[0].TokenId)
+		settlement.Stake = box.Assets[0].Amount
+	}
+	s.trackTx(pb, betKey, state.BetStatusRefunded, txSigned, txUnsigned, minerFee, settlement)
+
+	res := DryRunResult{
+		BoxId:      box.BoxId,
+		Game:       contracts.Roulette,
+		Kind:       state.BetStatusRefunded,
+		PlayerAddr: plyrAddr,
+		WinnerAddr: plyrAddr,
+		TxId:       string(txSigned),
+		TxUnsigned: txUnsigned,
+	}
+	if len(box.Assets) > 0 {
+		res.TokenId = box.Assets[0].TokenId
+		res.Amount = box.Assets[0].Amount
+	}
+	s.record(res)
+
+	addons := make(map[string]interface{})
+	addons["txId"] = string(txSigned)
+	addons["winnerAddr"] = plyrAddr
+	addons["settled"] = "true"
+	addons["status"] = state.BetStatusRefunded
+	addons["traceparent"] = tracing.Traceparent(ctx)
+
+	err = s.rdb.HSet(s.ctx, betKey, addons).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set txId for key '%s' to redis db - %s", betKey, err)
+	}
+
+	// the notif service sends the refund notification once the bet box is spent
+	s.ns.AddNotConfirmed(betKey)
+
+	return nil
+}
+
+// buildRefundTx returns the stake of a bet box to the player who placed it.
+func buildRefundTx(betUtxo erg.ErgTxOutputNode, plyrAddr, betDataInput string, fee int) ([]byte, error) {
+	var assets string = "[]"
+
+	if len(betUtxo.Assets) > 0 {
+		assets = fmt.Sprintf(`[{"tokenId": "%s", "amount": %d}]`, betUtxo.Assets[0].TokenId, betUtxo.Assets[0].Amount)
+	}
+
+	txToSign := []byte(fmt.Sprintf(`{
+		"requests": [
+			{
+				"address": "%s",
+				"value": %d,
+				"assets": %s
+			}
+		],
+		"fee": %d,
+		"inputsRaw": [
+			"%s"
+		],
+		"dataInputsRaw": []
+	}`, plyrAddr, minBoxValue, assets, fee, betDataInput))
+
+	return txToSign, nil
+}
+
+func buildResultSmartContractTx(betUtxo erg.ErgTxOutputNode, r4, r5 uint64, winnerAddress, betDataInput, oracleDataInput string, fee int) ([]byte, error) {
 	// Build Erg Tx for node to sign
 	var assets string
 
@@ -427,11 +955,39 @@ func buildResultSmartContractTx(betUtxo erg.ErgTxOutputNode, r4, r5 uint64, winn
     	"dataInputsRaw": [
 			"%s"
     	]
-	}`, winnerAddress, minBoxValue, assets, r4, r5, minerFee, betDataInput, oracleDataInput))
+	}`, winnerAddress, minBoxValue, assets, r4, r5, fee, betDataInput, oracleDataInput))
 
 	return txToSign, nil
 }
 
+// betExposure is the most the house pays out if the bet wins. The contract
+// pays the tokens of the bet box to the winner, whatever the subgame.
+func betExposure(box erg.ErgTxOutputNode) int {
+	return box.Assets[0].Amount
+}
+
+// decodeIntRegister decodes a register holding an Int constant, the 04 type
+// byte followed by the zigzag and vlq encoded value.
+func decodeIntRegister(reg string) (int, error) {
+	b, err := hex.DecodeString(reg)
+	if err != nil || len(b) < 2 || b[0] != 0x04 {
+		return 0, fmt.Errorf("register '%s' is not an Int", reg)
+	}
+
+	var n uint64
+	for i, c := range b[1:] {
+		n |= uint64(c&0x7f) << (7 * i)
+		if c&0x80 == 0 {
+			if i != len(b)-2 {
+				return 0, fmt.Errorf("register '%s' has trailing bytes", reg)
+			}
+			return int(decodeZigZag64(n)), nil
+		}
+	}
+
+	return 0, fmt.Errorf("register '%s' is truncated", reg)
+}
+
 func encodeZigZag64(n uint64) uint64 {
 	return (n << 1) ^ (n >> 63)
 }
@@ -0,0 +1,255 @@
+package payout
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nats-io/nats.go"
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/devnet"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/services/bankroll"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeIntRegister(t *testing.T) {
+	tests := []struct {
+		reg        string
+		subgame    int
+		multiplier int
+	}{
+		{"0400", RED_BLACK, 2},
+		{"0402", ODD_EVEN, 2},
+		{"0404", LOW_UPPER_HALF, 2},
+		{"0406", COLUMNS, 3},
+		{"0408", LOWER_MID_UPPER_3RD, 3},
+		{"040a", EXACT, 36},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reg, func(t *testing.T) {
+			subgame, err := decodeIntRegister(tt.reg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.subgame, subgame)
+			assert.Equal(t, tt.multiplier, payoutMultiplier(subgame))
+		})
+	}
+
+	// values above 63 take two bytes once zigzag and vlq encoded
+	n, err := decodeIntRegister("048001")
+	require.NoError(t, err)
+	assert.Equal(t, 64, n)
+
+	for _, reg := range []string{"", "04", "0e0a", "04zz", "0480", "04800101"} {
+		_, err := decodeIntRegister(reg)
+		assert.Error(t, err, reg)
+	}
+}
+
+func TestRouletteSettlement(t *testing.T) {
+	box := erg.ErgTxOutputNode{Assets: []erg.Tokens{{TokenId: "owl", Amount: 100}}}
+
+	// a winner is paid the tokens of the bet box, as the result tx does
+	won := rouletteSettlement(box, "OWL", "player", EXACT, 17, 17)
+	assert.Equal(t, 100, won.Payout)
+	assert.Equal(t, 100, won.Stake)
+
+	lost := rouletteSettlement(box, "OWL", "player", EXACT, 17, 18)
+	assert.Zero(t, lost.Payout)
+	assert.Equal(t, won.ExpectedPayout, lost.ExpectedPayout)
+}
+
+// startAlerts connects the service to a nats server and returns a
+// subscription to its alerts.
+func startAlerts(t *testing.T, s *Service) *nats.Subscription {
+	ns, err := devnet.StartNATS(0)
+	require.NoError(t, err)
+	t.Cleanup(ns.Close)
+	s.nats, err = nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(s.nats.Close)
+
+	viper.Set("nats.alerts_subj", "alerts")
+	alerts, err := s.nats.SubscribeSync("alerts")
+	require.NoError(t, err)
+	return alerts
+}
+
+func nextAlert(t *testing.T, alerts *nats.Subscription) Alert {
+	msg, err := alerts.NextMsg(time.Second)
+	require.NoError(t, err)
+	var a Alert
+	require.NoError(t, json.Unmarshal(msg.Data, &a))
+	return a
+}
+
+func TestResolveBetOverLimit(t *testing.T) {
+	s, chain, _ := newTestService(t)
+	alerts := startAlerts(t, s)
+
+	viper.Set("bankroll.limits", []map[string]interface{}{
+		{"token_id": s.contracts.TokenId("OWL"), "max_single_payout": 99, "max_round_exposure": 150},
+	})
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	br, err := bankroll.NewService(s.rdb, client, s.contracts.HouseAddress, &sync.WaitGroup{})
+	require.NoError(t, err)
+	s.bankroll = br
+
+	// the bet box pays out 100 whatever the subgame, too much for one bet
+	player := chain.RandomAddress()
+	boxId, err := chain.PlaceBet(player, RED_BLACK, 0, 100)
+	require.NoError(t, err)
+	chain.Mine()
+
+	done, err := s.resolveBet(s.ctx, state.PendingBet{BoxId: boxId, RandNum: "ab"}, 0)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Empty(t, s.signer.(*testSigner).payloads)
+	assert.Equal(t, betOverLimitAlert, nextAlert(t, alerts).Type)
+	exists, err := s.rdb.Exists(s.ctx, state.Key("roulette:"+boxId+":"+player)).Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+
+	// bets within the single payout limit are held back once they would take
+	// the exposure past the round limit
+	var boxIds []string
+	for i := 0; i < 2; i++ {
+		boxId, err := chain.PlaceBet(chain.RandomAddress(), EXACT, 17, 90)
+		require.NoError(t, err)
+		boxIds = append(boxIds, boxId)
+	}
+	chain.Mine()
+
+	done, err = s.resolveBet(s.ctx, state.PendingBet{BoxId: boxIds[0]}, 0)
+	require.NoError(t, err)
+	assert.False(t, done, "waiting on its random number")
+	done, err = s.resolveBet(s.ctx, state.PendingBet{BoxId: boxIds[1]}, 0)
+	require.NoError(t, err)
+	assert.False(t, done)
+
+	exposure, err := s.rdb.HGet(s.ctx, state.Key("bankroll:exposure"), s.contracts.TokenId("OWL")).Int()
+	require.NoError(t, err)
+	assert.Equal(t, 90, exposure)
+}
+
+func TestResolveBetDisabledGame(t *testing.T) {
+	s, chain, _ := newTestService(t)
+	viper.Set("payout.games.roulette.enabled", false)
+	s.refundAfter = 10
+	alerts := startAlerts(t, s)
+
+	player := chain.RandomAddress()
+	boxId, err := chain.PlaceBet(player, 0, 17, 100)
+	require.NoError(t, err)
+	chain.Mine()
+	box, err := s.ergNode.GetErgUtxoBox(boxId)
+	require.NoError(t, err)
+
+	// the bet waits for the game to be enabled again
+	pb := state.PendingBet{BoxId: boxId, RandNum: "ab"}
+	done, err := s.resolveBet(s.ctx, pb, box.CreationHeight+1)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Empty(t, s.signer.(*testSigner).payloads)
+
+	// even once it expired, an operator is alerted instead
+	done, err = s.resolveBet(s.ctx, pb, box.CreationHeight+10)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Empty(t, s.signer.(*testSigner).payloads)
+
+	a := nextAlert(t, alerts)
+	assert.Equal(t, gameDisabledAlert, a.Type)
+	assert.Equal(t, boxId, a.BoxId)
+
+	exists, err := s.rdb.Exists(s.ctx, state.Key("roulette:"+boxId+":"+player)).Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+}
+
+// resultPathAccepts mirrors the spending conditions of the mainnet roulette
+// contract: the oracle box is the first data input and the first output holds
+// the chosen number in R4 and R5 and the tokens of the bet box.
+func resultPathAccepts(box erg.ErgTxOutputNode, req erg.TxRequest) bool {
+	if len(req.DataInputsRaw) == 0 || len(req.Requests) == 0 {
+		return false
+	}
+	out := req.Requests[0]
+	if out.Registers["R4"] == "" || out.Registers["R5"] == "" {
+		return false
+	}
+	return len(out.Assets) == 1 && out.Assets[0] == box.Assets[0]
+}
+
+// refundPathAccepts mirrors the refund path of a refundable contract: the
+// first output returns the tokens of the bet box to the player in R6.
+func refundPathAccepts(box erg.ErgTxOutputNode, req erg.TxRequest) bool {
+	if len(req.Requests) == 0 {
+		return false
+	}
+	out := req.Requests[0]
+	tree, err := erg.AddressToErgoTree(out.Address)
+	if err != nil || tree != box.AdditionalRegisters.R6[4:] {
+		return false
+	}
+	return len(out.Assets) == 1 && out.Assets[0] == box.Assets[0]
+}
+
+func TestResolveBetExpired(t *testing.T) {
+	s, chain, _ := newTestService(t)
+	s.refundAfter = 10
+
+	alerts := startAlerts(t, s)
+
+	player := chain.RandomAddress()
+	boxId, err := chain.PlaceBet(player, 0, 17, 100)
+	require.NoError(t, err)
+	chain.Mine()
+	box, err := s.ergNode.GetErgUtxoBox(boxId)
+	require.NoError(t, err)
+
+	raw, err := s.ergNode.SerializeErgBox(boxId)
+	require.NoError(t, err)
+	var refund erg.TxRequest
+	data, _ := buildRefundTx(box, player, raw, minBoxValue)
+	require.NoError(t, json.Unmarshal(data, &refund))
+	var result erg.TxRequest
+	data, _ = buildResultSmartContractTx(box, 0, 0, player, raw, raw, minBoxValue)
+	require.NoError(t, json.Unmarshal(data, &result))
+
+	// the mainnet contract only accepts result txs
+	assert.True(t, resultPathAccepts(box, result))
+	assert.False(t, resultPathAccepts(box, refund))
+	assert.True(t, refundPathAccepts(box, refund))
+
+	// so its expired bets stay pending and an operator is alerted once
+	pb := state.PendingBet{BoxId: boxId}
+	for i := 0; i < 2; i++ {
+		done, err := s.resolveBet(s.ctx, pb, box.CreationHeight+10)
+		require.NoError(t, err)
+		assert.False(t, done)
+	}
+	assert.Empty(t, s.signer.(*testSigner).payloads)
+
+	a := nextAlert(t, alerts)
+	assert.Equal(t, betExpiredAlert, a.Type)
+	assert.Equal(t, boxId, a.BoxId)
+	_, err = alerts.NextMsg(100 * time.Millisecond)
+	assert.ErrorIs(t, err, nats.ErrTimeout)
+
+	// contracts with a refund path get the refund tx
+	s.contracts.Games[contracts.Roulette] = contracts.Game{ErgoTree: box.ErgoTree, Refundable: true}
+	done, err := s.resolveBet(s.ctx, pb, box.CreationHeight+10)
+	require.NoError(t, err)
+	assert.True(t, done)
+	require.Len(t, s.signer.(*testSigner).payloads, 1)
+	require.NoError(t, json.Unmarshal(s.signer.(*testSigner).payloads[0], &refund))
+	assert.True(t, refundPathAccepts(box, refund))
+}
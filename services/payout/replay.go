@@ -0,0 +1,294 @@
+package payout
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	ReplaySettled    = "settled"
+	ReplayRefunded   = "refunded"
+	ReplayMissing    = "missing"
+	ReplayMismatched = "mismatched"
+	ReplayPending    = "pending"
+	ReplaySpent      = "spent"
+	ReplayInvalid    = "invalid"
+	ReplayError      = "error"
+)
+
+// ReplayResult is the status of a single bet found while replaying a range of
+// oracle txs.
+type ReplayResult struct {
+	BoxId      string `json:"boxId"`
+	OracleTxId string `json:"oracleTxId"`
+	Height     int    `json:"height"`
+	Status     string `json:"status"`
+	TxId       string `json:"txId,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// Replay re-scans the oracle txs between fromHeight and toHeight and reports
+// the status of every bet of the game they reference. With settle set, bets
+// which are missing a settlement are resolved through the same path as the
+// running service.
+func (s *Service) Replay(fromHeight, toHeight int, game string, settle bool) ([]ReplayResult, error) {
+	if game != contracts.Roulette {
+		return nil, fmt.Errorf("game '%s' is not settled by the payout service", game)
+	}
+
+	currHeight, err := s.ergNode.GetCurrenHeight()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current erg height - %s", err.Error())
+	}
+
+	// an oracle tx may reference a bet before its random number is known, keep
+	// the most recent entry with a random number
+	bets := make(map[string]state.PendingBet)
+	for _, ergTx := range s.fetchOracleTxs(s.ctx, fromHeight, toHeight).Items {
+		for _, pb := range oracleTxBets(ergTx) {
+			old, ok := bets[pb.BoxId]
+			if ok && (pb.RandNum == "" || (old.RandNum != "" && old.Height >= pb.Height)) {
+				continue
+			}
+			bets[pb.BoxId] = pb
+		}
+	}
+
+	results := make([]ReplayResult, 0, len(bets))
+	for _, pb := range bets {
+		res, ok := s.replayBet(pb, game, currHeight, settle)
+		if ok {
+			results = append(results, res)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Height != results[j].Height {
+			return results[i].Height < results[j].Height
+		}
+		return results[i].BoxId < results[j].BoxId
+	})
+
+	return results, nil
+}
+
+// replayBet returns the status of a single bet, false if the bet belongs to
+// another game.
+func (s *Service) replayBet(pb state.PendingBet, game string, currHeight int, settle bool) (ReplayResult, bool) {
+	res := ReplayResult{
+		BoxId:      pb.BoxId,
+		OracleTxId: pb.OracleTxId,
+		Height:     pb.Height,
+	}
+
+	box, err := s.ergNode.GetErgUtxoBox(pb.BoxId)
+	if err != nil {
+		res.Status = ReplayError
+		res.Detail = fmt.Sprintf("failed to get erg utxo box - %s", err.Error())
+		return res, true
+	}
+
+	// unspent boxes of other games are not reported, spent ones only when we
+	// know about the bet
+	if box.BoxId != "" && box.ErgoTree != s.contracts.GameErgoTree(game) {
+		return res, false
+	}
+
+	plyrAddr, err := s.betPlayer(box, pb.BoxId, game)
+	if err != nil {
+		res.Status = ReplayError
+		res.Detail = err.Error()
+		return res, true
+	}
+
+	bet, err := s.findBetRecord(game, pb.BoxId, plyrAddr)
+	if err != nil {
+		res.Status = ReplayError
+		res.Detail = err.Error()
+		return res, true
+	}
+
+	if box.BoxId == "" {
+		if bet == nil {
+			res.Status = ReplaySpent
+			res.Detail = "bet box is spent and has no bet record"
+			return res, true
+		}
+		compareBetRecord(&res, bet, pb, s.contracts.HouseAddress)
+		return res, true
+	}
+
+	if _, reason := validateBet(box, s.gameTokens(game)); reason != "" {
+		res.Status = ReplayInvalid
+		res.Detail = reason
+		return res, true
+	}
+
+	if bet != nil && bet["settled"] == "true" {
+		compareBetRecord(&res, bet, pb, s.contracts.HouseAddress)
+		if res.Status != ReplayMismatched {
+			res.Detail = "settlement tx is not confirmed yet"
+		}
+		return res, true
+	}
+
+	if pb.RandNum == "" && !s.betExpired(box, currHeight) {
+		res.Status = ReplayPending
+		res.Detail = "waiting on a random number"
+		return res, true
+	}
+
+	res.Status = ReplayMissing
+	if !settle {
+		return res, true
+	}
+
+	// settle through the queue so a failure is retried by the running service
+	err = s.queue.Enqueue(pb)
+	if err != nil {
+		res.Status = ReplayError
+		res.Detail = err.Error()
+		return res, true
+	}
+
+	resolved, err := s.resolveBet(s.ctx, pb, currHeight)
+	switch {
+	case err != nil:
+		res.Status = ReplayError
+		res.Detail = fmt.Sprintf("failed to settle bet - %s", err.Error())
+		return res, true
+	case !resolved:
+		res.Detail = "bet could not be settled yet, left in the pending queue"
+		return res, true
+	}
+
+	err = s.queue.Remove(pb.BoxId)
+	if err != nil {
+		log.Error("failed to remove resolved bet from queue", zap.Error(err), zap.String("erg_utxo_box_id", pb.BoxId))
+	}
+
+	bet, err = s.findBetRecord(game, pb.BoxId, plyrAddr)
+	if err != nil || bet == nil {
+		res.Detail = "settled by replay"
+		return res, true
+	}
+	compareBetRecord(&res, bet, pb, s.contracts.HouseAddress)
+	res.Detail = "settled by replay"
+
+	return res, true
+}
+
+// betPlayer returns the address of the player who placed a bet of game, empty
+// if the bet box is not known. Spent bet boxes are only known by the explorer.
+func (s *Service) betPlayer(box erg.ErgTxOutputNode, boxId, game string) (string, error) {
+	var ergoTree string
+
+	if box.BoxId != "" {
+		if len(box.AdditionalRegisters.R6) <= 4 {
+			return "", nil
+		}
+		ergoTree = box.AdditionalRegisters.R6[4:]
+	} else {
+		spent, err := s.ergExplorer.GetBox(boxId)
+		switch {
+		case errors.Is(err, erg.ErrBoxNotFound):
+			return "", nil
+		case err != nil:
+			return "", fmt.Errorf("failed to get spent bet box - %s", err.Error())
+		case spent.ErgoTree != s.contracts.GameErgoTree(game):
+			return "", nil
+		}
+		// the explorer renders the register without its type and length
+		ergoTree = spent.AdditionalRegisters.R6.Value
+	}
+	if ergoTree == "" {
+		return "", nil
+	}
+
+	plyrAddr, err := s.ergNode.ErgoTreeToAddress(ergoTree)
+	if err != nil {
+		return "", fmt.Errorf("failed to get player address - %s", err.Error())
+	}
+
+	return plyrAddr, nil
+}
+
+// findBetRecord returns the redis record of a bet, nil if there is none.
+func (s *Service) findBetRecord(game, boxId, plyrAddr string) (map[string]string, error) {
+	if plyrAddr == "" {
+		return nil, nil
+	}
+
+	betKey := state.Key(fmt.Sprintf("%s:%s:%s", game, boxId, plyrAddr))
+	bet, err := s.rdb.HGetAll(s.ctx, betKey).Result()
+	switch {
+	case err == redis.Nil:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get key '%s' from redis db - %s", betKey, err.Error())
+	case len(bet) == 0:
+		return nil, nil
+	}
+
+	return bet, nil
+}
+
+// compareBetRecord sets the status of a settled bet, flagging it as
+// mismatched when the record disagrees with the oracle tx.
+func compareBetRecord(res *ReplayResult, bet map[string]string, pb state.PendingBet, houseAddr string) {
+	res.TxId = bet["txId"]
+
+	switch {
+	case bet["status"] == state.BetStatusRefunded:
+		res.Status = ReplayRefunded
+	case bet["settled"] == "true":
+		res.Status = ReplaySettled
+	default:
+		res.Status = ReplayMissing
+		return
+	}
+
+	if pb.RandNum == "" {
+		return
+	}
+
+	if bet["randomNum"] != "" && bet["randomNum"] != pb.RandNum {
+		res.Status = ReplayMismatched
+		res.Detail = fmt.Sprintf("random number %s differs from oracle random number %s", bet["randomNum"], pb.RandNum)
+		return
+	}
+
+	if res.Status != ReplaySettled || len(bet["subgame"]) <= 2 || len(bet["number"]) <= 2 {
+		return
+	}
+
+	randNum, err := getRandNum(pb.RandNum)
+	if err != nil {
+		return
+	}
+	subgame, err := decodeIntRegister(bet["subgame"])
+	if err != nil {
+		return
+	}
+	chipspot, err := decodeIntRegister(bet["number"])
+	if err != nil {
+		return
+	}
+
+	expected := houseAddr
+	if winner(subgame, chipspot, randNum) {
+		expected = bet["playerAddr"]
+	}
+
+	if bet["winnerAddr"] != expected {
+		res.Status = ReplayMismatched
+		res.Detail = fmt.Sprintf("paid to %s but the winner is %s", bet["winnerAddr"], expected)
+	}
+}
@@ -0,0 +1,62 @@
+package payout
+
+import (
+	"testing"
+
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayBet(t *testing.T) {
+	s, chain, extra := newTestService(t)
+
+	// bets are looked up by their key, which carries the prefix
+	state.SetPrefix("{test}")
+	defer state.SetPrefix("")
+
+	player := chain.RandomAddress()
+	playerTree, err := erg.AddressToErgoTree(player)
+	require.NoError(t, err)
+
+	// the fake explorer does not serve single boxes
+	spentBoxId := "ab" + playerTree[:62]
+	extra["/api/v1/boxes/"+spentBoxId] = map[string]interface{}{
+		"boxId":               spentBoxId,
+		"ergoTree":            s.contracts.GameErgoTree(contracts.Roulette),
+		"additionalRegisters": map[string]interface{}{"R6": map[string]string{"renderedValue": playerTree}},
+	}
+
+	boxId, err := chain.PlaceBet(player, 0, 17, 100)
+	require.NoError(t, err)
+	chain.Mine()
+
+	// without a record or a random number the bet is still pending
+	res, ok := s.replayBet(state.PendingBet{BoxId: boxId}, contracts.Roulette, 1, false)
+	require.True(t, ok)
+	assert.Equal(t, ReplayPending, res.Status)
+
+	settled := map[string]interface{}{"settled": "true", "status": state.BetStatusSettled, "txId": "tx1"}
+	require.NoError(t, s.rdb.HSet(s.ctx, state.Key("roulette:"+boxId+":"+player), settled).Err())
+	res, ok = s.replayBet(state.PendingBet{BoxId: boxId}, contracts.Roulette, 1, false)
+	require.True(t, ok)
+	assert.Equal(t, ReplaySettled, res.Status)
+	assert.Equal(t, "tx1", res.TxId)
+
+	// spent bet boxes are found through the explorer
+	res, ok = s.replayBet(state.PendingBet{BoxId: spentBoxId}, contracts.Roulette, 1, false)
+	require.True(t, ok)
+	assert.Equal(t, ReplaySpent, res.Status)
+
+	require.NoError(t, s.rdb.HSet(s.ctx, state.Key("roulette:"+spentBoxId+":"+player), settled).Err())
+	res, ok = s.replayBet(state.PendingBet{BoxId: spentBoxId}, contracts.Roulette, 1, false)
+	require.True(t, ok)
+	assert.Equal(t, ReplaySettled, res.Status)
+
+	// boxes the explorer does not know either have no record
+	res, ok = s.replayBet(state.PendingBet{BoxId: "cd" + playerTree[:62]}, contracts.Roulette, 1, false)
+	require.True(t, ok)
+	assert.Equal(t, ReplaySpent, res.Status)
+}
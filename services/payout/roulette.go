@@ -15,6 +15,9 @@ const (
 	EXACT               = 5
 )
 
+// rouletteNumbers is how many numbers the wheel has, 0 to 36
+const rouletteNumbers = 37
+
 func getRandNum(hash string) (int, error) {
 	var num int64
 	var err error
@@ -29,7 +32,7 @@ func getRandNum(hash string) (int, error) {
 		return -1, fmt.Errorf("hash is missing - %s", err.Error())
 	}
 	
-	rand = int(num % 37)
+	rand = int(num % rouletteNumbers)
 	return rand, nil
 }
 
@@ -160,4 +163,39 @@ func winner(subgame, chipspot, randNum int) bool {
 	}
 	
 	return false
-}
\ No newline at end of file
+}
+
+// payoutMultiplier returns the amount a winning bet of the subgame pays out
+// as a multiple of its stake.
+func payoutMultiplier(subgame int) int {
+	switch subgame {
+	case RED_BLACK, ODD_EVEN, LOW_UPPER_HALF:
+		return 2
+	case COLUMNS, LOWER_MID_UPPER_3RD:
+		return 3
+	case EXACT:
+		return 36
+	default:
+		return 0
+	}
+}
+
+// winningNumbers returns how many of the possible random numbers make a bet on
+// the chip spot of the subgame win.
+func winningNumbers(subgame, chipspot int) int {
+	var count int
+	for n := 0; n < rouletteNumbers; n++ {
+		if winner(subgame, chipspot, n) {
+			count++
+		}
+	}
+	return count
+}
+
+// expectedPayout returns what a bet of the stake on the chip spot of the
+// subgame pays out on average. What the payout multiplier falls short of the
+// odds of the bet is the house edge.
+func expectedPayout(subgame, chipspot, stake int) float64 {
+	odds := float64(winningNumbers(subgame, chipspot)) / rouletteNumbers
+	return float64(stake*payoutMultiplier(subgame)) * odds
+}
@@ -0,0 +1,38 @@
+package payout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWinningNumbers(t *testing.T) {
+	tests := []struct {
+		name     string
+		subgame  int
+		chipspot int
+		want     int
+	}{
+		{"red", RED_BLACK, 0, 18},
+		{"black", RED_BLACK, 1, 18},
+		{"odd", ODD_EVEN, 1, 18},
+		{"lower half", LOW_UPPER_HALF, 10, 18},
+		{"first column", COLUMNS, 1, 12},
+		{"middle third", LOWER_MID_UPPER_3RD, 18, 12},
+		{"exact", EXACT, 17, 1},
+		{"zero", EXACT, 0, 1},
+		{"unknown chip spot", COLUMNS, 4, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := winningNumbers(tt.subgame, tt.chipspot)
+			assert.Equal(t, tt.want, n)
+			// every valid bet carries the same single zero house edge
+			if n > 0 {
+				assert.Equal(t, 36, n*payoutMultiplier(tt.subgame))
+				assert.InDelta(t, 1-1.0/rouletteNumbers, expectedPayout(tt.subgame, tt.chipspot, 1), 1e-9)
+			}
+		})
+	}
+}
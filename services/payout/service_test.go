@@ -0,0 +1,103 @@
+package payout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/devnet"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/services/bankroll"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testSigner records the payloads it is given and answers the way the node
+// does.
+type testSigner struct {
+	payloads [][]byte
+}
+
+func (s *testSigner) SendTx(_ context.Context, payload []byte) ([]byte, error) {
+	s.payloads = append(s.payloads, payload)
+	return []byte("\"tx" + strconv.Itoa(len(s.payloads)) + "\"\n"), nil
+}
+
+// newTestService returns a service talking to a fake ergo chain and an
+// in-memory redis db. Paths the chain does not serve are answered with the
+// json in extra, which may be filled in after the service is created.
+func newTestService(t *testing.T) (*Service, *devnet.Chain, map[string]interface{}) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	log = zap.NewNop()
+
+	reg, err := contracts.Load()
+	require.NoError(t, err)
+
+	chain, err := devnet.NewChain(reg, nil, nil)
+	require.NoError(t, err)
+
+	extra := make(map[string]interface{})
+	chainHandler := chain.Handler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v, ok := extra[r.URL.Path]; ok {
+			json.NewEncoder(w).Encode(v)
+			return
+		}
+		chainHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	for _, prefix := range []string{"ergo_node", "explorer_node"} {
+		viper.Set(prefix+".scheme", "http")
+		viper.Set(prefix+".fqdn", u.Hostname())
+		viper.Set(prefix+".port", port)
+	}
+
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	client.RetryMax = 0
+	node, _ := erg.NewErgNode(client)
+	explorer, _ := erg.NewExplorer(client)
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	tokens, err := loadGameTokens(config.Current(), contracts.Roulette, reg.TokenId("OWL"))
+	require.NoError(t, err)
+
+	br, err := bankroll.NewService(rdb, client, reg.HouseAddress, &sync.WaitGroup{})
+	require.NoError(t, err)
+
+	s := &Service{
+		ctx:         ctx,
+		ergNode:     node,
+		ergExplorer: explorer,
+		signer:      &testSigner{},
+		contracts:   reg,
+		queue:       state.NewBetQueue(ctx, rdb),
+		txs:         state.NewTxTracker(ctx, rdb),
+		players:     state.NewPlayerIndex(ctx, rdb),
+		tokens:      map[string]map[string]TokenLimits{contracts.Roulette: tokens},
+		bankroll:    br,
+		ns:          state.NewNotifState(ctx, rdb),
+		rdb:         rdb,
+	}
+
+	return s, chain, extra
+}
@@ -0,0 +1,416 @@
+package payout
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nightowlcasino/nightowl/broker"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/metrics"
+	"github.com/nightowlcasino/nightowl/services/stats"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	txRejectedAlert   = "tx_rejected"
+	txRetriedAlert    = "tx_retried"
+	betExpiredAlert   = "bet_expired"
+	betOverLimitAlert = "bet_over_limit"
+	gameDisabledAlert = "game_disabled"
+
+	// alerts about bets which are found again on every scan are repeated at
+	// most this often
+	alertRepeat = 24 * time.Hour
+)
+
+// Alert is published on nats.alerts_subj when a problem needs an operator.
+type Alert struct {
+	Type   string   `json:"type"`
+	BoxId  string   `json:"boxId"`
+	BetKey string   `json:"betKey"`
+	TxIds  []string `json:"txIds"`
+	Reason string   `json:"reason"`
+	Time   int64    `json:"time"`
+}
+
+// trackTx hands a submitted tx over to the tx watcher. The settlement is
+// added to the stats once the tx is confirmed.
+func (s *Service) trackTx(pb state.PendingBet, betKey, kind string, resp, request []byte, fee int, settlement stats.Settlement) {
+	// txs of a dry run never reach the network
+	if s.recorder != nil {
+		return
+	}
+
+	data, err := json.Marshal(settlement)
+	if err != nil {
+		log.Error("failed to marshal bet settlement", zap.Error(err), zap.String("erg_utxo_box_id", pb.BoxId))
+	}
+
+	err = s.txs.Track(state.TrackedTx{
+		BoxId:       pb.BoxId,
+		BetKey:      betKey,
+		Kind:        kind,
+		TxId:        txIdFromResponse(resp),
+		Request:     request,
+		Fee:         fee,
+		SubmittedAt: time.Now().Unix(),
+		Bet:         pb,
+		Settlement:  data,
+	})
+	if err != nil {
+		log.Error("failed to track submitted tx", zap.Error(err), zap.String("erg_utxo_box_id", pb.BoxId))
+	}
+}
+
+// txIdFromResponse strips the quotes the node puts around the tx id.
+func txIdFromResponse(resp []byte) string {
+	return strings.Trim(strings.TrimSpace(string(resp)), "\"")
+}
+
+func (s *Service) watchTxs(stop chan bool) {
+	check := make(chan bool, 1)
+
+	check <- true
+
+loop:
+	for {
+		select {
+		case <-stop:
+			log.Info("stopping watchTxs() loop...")
+			s.wg.Done()
+			break loop
+		case <-check:
+			start := time.Now()
+
+			txs, err := s.txs.All()
+			if err != nil {
+				log.Error("failed to get tracked txs", zap.Error(err))
+			}
+			for _, tx := range txs {
+				s.checkTx(tx)
+			}
+
+			log.Debug("finished checking submitted txs",
+				zap.Int("total_txs", len(txs)),
+				zap.Int64("durationMs", time.Since(start).Milliseconds()),
+			)
+
+			go wait(time.Duration(config.Current().Payout.TxWatch.Interval)*time.Second, check)
+		}
+	}
+}
+
+// checkTx follows a submitted tx until one of its versions is mined. Txs which
+// dropped out of the mempool are rebroadcast, txs stuck in the mempool are
+// replaced with a higher fee and txs whose bet box was spent by someone else
+// are rejected.
+func (s *Service) checkTx(tx state.TrackedTx) {
+	now := time.Now().Unix()
+	watch := config.Current().Payout.TxWatch
+
+	for _, id := range tx.TxIds() {
+		_, err := s.ergExplorer.GetErgTx(id)
+		switch {
+		case err == erg.ErrTxNotFound:
+			continue
+		case err != nil:
+			log.Error("failed to get submitted tx", zap.Error(err), zap.String("tx_id", id))
+			return
+		}
+
+		log.Info("submitted tx confirmed", zap.String("tx_id", id), zap.String("erg_utxo_box_id", tx.BoxId))
+		if id != tx.TxId {
+			s.setBetTxId(tx.BetKey, id)
+		}
+		s.recordSettlement(tx)
+		if err := s.txs.Remove(tx.BoxId); err != nil {
+			log.Error("failed to stop tracking tx", zap.Error(err), zap.String("tx_id", id))
+		}
+		return
+	}
+
+	utx, err := s.ergNode.GetUnconfirmedTx(tx.TxId)
+	if err != nil {
+		log.Error("failed to get unconfirmed tx", zap.Error(err), zap.String("tx_id", tx.TxId))
+		return
+	}
+
+	switch {
+	case utx.Id != "":
+		tx.MissingSince = 0
+		if now-tx.SubmittedAt >= int64(watch.ReplaceAfter) {
+			s.replaceTx(&tx)
+		}
+	default:
+		box, err := s.ergNode.GetErgUtxoBox(tx.BoxId)
+		if err != nil {
+			log.Error("failed to get erg utxo box", zap.Error(err), zap.String("erg_utxo_box_id", tx.BoxId))
+			return
+		}
+
+		switch {
+		case box.BoxId != "":
+			// the bet box is still unspent, so the tx was dropped from the mempool
+			if tx.Rebroadcasts >= watch.MaxRebroadcasts {
+				s.retryBet(tx, fmt.Sprintf("tx was dropped %d times, last error: %s", tx.Rebroadcasts, tx.LastError))
+				return
+			}
+			tx.Rebroadcasts++
+			log.Warn("submitted tx dropped from mempool, rebroadcasting", zap.String("tx_id", tx.TxId), zap.Int("rebroadcasts", tx.Rebroadcasts))
+			s.resubmitTx(&tx, tx.Fee)
+		case tx.MissingSince == 0:
+			// give the explorer time to index a tx which was just mined
+			tx.MissingSince = now
+		case now-tx.MissingSince >= int64(watch.SpentGrace):
+			s.rejectTx(tx, "bet box was spent by a tx which is not ours")
+			return
+		}
+	}
+
+	if err := s.txs.Track(tx); err != nil {
+		log.Error("failed to update tracked tx", zap.Error(err), zap.String("tx_id", tx.TxId))
+	}
+}
+
+// replaceTx resubmits a tx stuck in the mempool with a higher fee.
+func (s *Service) replaceTx(tx *state.TrackedTx) {
+	watch := config.Current().Payout.TxWatch
+
+	fee := int(float64(tx.Fee) * watch.FeeMultiplier)
+	if maxFee := watch.MaxFee; fee > maxFee {
+		fee = maxFee
+	}
+	if fee <= tx.Fee {
+		log.Warn("submitted tx stuck in mempool at max fee", zap.String("tx_id", tx.TxId), zap.Int("fee", tx.Fee))
+		return
+	}
+
+	tx.Replacements++
+	log.Warn("submitted tx stuck in mempool, replacing with a higher fee",
+		zap.String("tx_id", tx.TxId),
+		zap.Int("old_fee", tx.Fee),
+		zap.Int("new_fee", fee),
+	)
+	s.resubmitTx(tx, fee)
+}
+
+// resubmitTx rebuilds the tx request with fresh serialized boxes and the given
+// fee and sends it again.
+func (s *Service) resubmitTx(tx *state.TrackedTx, fee int) {
+	var req erg.TxRequest
+
+	err := json.Unmarshal(tx.Request, &req)
+	if err != nil {
+		tx.LastError = fmt.Sprintf("failed to unmarshal tx request - %s", err.Error())
+		return
+	}
+
+	for _, raws := range [][]string{req.InputsRaw, req.DataInputsRaw} {
+		for i, raw := range raws {
+			boxId, err := erg.BoxIdFromBytes(raw)
+			if err != nil {
+				tx.LastError = err.Error()
+				return
+			}
+			raws[i], err = s.ergNode.SerializeErgBox(boxId)
+			if err != nil {
+				tx.LastError = fmt.Sprintf("failed to serialize box %s - %s", boxId, err.Error())
+				return
+			}
+		}
+	}
+	req.Fee = fee
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		tx.LastError = fmt.Sprintf("failed to marshal tx request - %s", err.Error())
+		return
+	}
+
+	resp, err := s.signer.SendTx(s.ctx, payload)
+	if err != nil {
+		tx.LastError = err.Error()
+		log.Error("failed to resubmit tx", zap.Error(err), zap.String("tx_id", tx.TxId))
+		return
+	}
+
+	if id := txIdFromResponse(resp); id != tx.TxId {
+		tx.PrevTxIds = append(tx.PrevTxIds, tx.TxId)
+		tx.TxId = id
+		s.setBetTxId(tx.BetKey, id)
+	}
+	tx.Request = payload
+	tx.Fee = fee
+	tx.SubmittedAt = time.Now().Unix()
+	tx.LastError = ""
+
+	log.Info("resubmitted tx", zap.String("tx_id", tx.TxId), zap.String("erg_utxo_box_id", tx.BoxId), zap.Int("fee", fee))
+}
+
+// rejectTx gives up on a tx whose bet box was spent by someone else, marks its
+// bet as rejected and alerts an operator.
+func (s *Service) rejectTx(tx state.TrackedTx, reason string) {
+	log.Error("submitted tx permanently rejected",
+		zap.String("tx_id", tx.TxId),
+		zap.String("erg_utxo_box_id", tx.BoxId),
+		zap.String("reason", reason),
+	)
+
+	err := s.rdb.HSet(s.ctx, tx.BetKey, "status", state.BetStatusRejected).Err()
+	if err != nil {
+		log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", tx.BetKey))
+	}
+
+	// nothing was paid, so there is nothing to notify the player about
+	if err := s.ns.RemoveNotConfirmed(tx.BetKey); err != nil {
+		log.Error("failed to remove bet from notif state", zap.Error(err), zap.String("redis_key", tx.BetKey))
+	}
+
+	if err := s.txs.Remove(tx.BoxId); err != nil {
+		log.Error("failed to stop tracking tx", zap.Error(err), zap.String("tx_id", tx.TxId))
+	}
+
+	s.alert(Alert{
+		Type:   txRejectedAlert,
+		BoxId:  tx.BoxId,
+		BetKey: tx.BetKey,
+		TxIds:  tx.TxIds(),
+		Reason: reason,
+	})
+}
+
+// retryBet gives up on a tx whose bet box is still unspent. The bet is queued
+// again so that it is settled by a new tx, its exposure is held until then.
+func (s *Service) retryBet(tx state.TrackedTx, reason string) {
+	log.Error("submitted tx permanently rejected, queueing bet again",
+		zap.String("tx_id", tx.TxId),
+		zap.String("erg_utxo_box_id", tx.BoxId),
+		zap.String("reason", reason),
+	)
+
+	bet, err := s.rdb.HGetAll(s.ctx, tx.BetKey).Result()
+	if err != nil {
+		log.Error("failed to get key from redis db", zap.Error(err), zap.String("redis_key", tx.BetKey))
+		return
+	}
+
+	// the tx stays tracked until the bet is queued, so nothing is lost if
+	// this fails
+	pb := tx.Bet
+	pb.BoxId = tx.BoxId
+	if err := s.queue.Enqueue(pb); err != nil {
+		log.Error("failed to queue bet again", zap.Error(err), zap.String("erg_utxo_box_id", tx.BoxId))
+		return
+	}
+
+	// the exposure was released when the tx was sent and is released again
+	// once the bet is resolved
+	exposure, _ := strconv.Atoi(bet["exposure"])
+	if err := s.bankroll.HoldExposure(bet["tokenId"], exposure); err != nil {
+		log.Error("failed to hold bet exposure", zap.Error(err), zap.String("erg_utxo_box_id", tx.BoxId))
+	}
+
+	err = s.rdb.HSet(s.ctx, tx.BetKey, map[string]interface{}{
+		"status":  state.BetStatusPending,
+		"settled": "false",
+		"txId":    "",
+	}).Err()
+	if err != nil {
+		log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", tx.BetKey))
+	}
+
+	if err := s.ns.RemoveNotConfirmed(tx.BetKey); err != nil {
+		log.Error("failed to remove bet from notif state", zap.Error(err), zap.String("redis_key", tx.BetKey))
+	}
+
+	if err := s.txs.Remove(tx.BoxId); err != nil {
+		log.Error("failed to stop tracking tx", zap.Error(err), zap.String("tx_id", tx.TxId))
+	}
+
+	s.alert(Alert{
+		Type:   txRetriedAlert,
+		BoxId:  tx.BoxId,
+		BetKey: tx.BetKey,
+		TxIds:  tx.TxIds(),
+		Reason: reason,
+	})
+}
+
+// recordSettlement adds the bet of a confirmed tx to the stats, leaderboards
+// and metrics of its game.
+func (s *Service) recordSettlement(tx state.TrackedTx) {
+	if len(tx.Settlement) == 0 {
+		return
+	}
+
+	var settlement stats.Settlement
+	if err := json.Unmarshal(tx.Settlement, &settlement); err != nil {
+		log.Error("failed to unmarshal bet settlement", zap.Error(err), zap.String("erg_utxo_box_id", tx.BoxId))
+		return
+	}
+
+	var err error
+	switch {
+	case tx.Kind == state.BetStatusRefunded:
+		metrics.BetSettled(settlement.Game, state.OutcomeRefunded)
+		// bet boxes without a token have no stake to count
+		if settlement.TokenName != "" {
+			err = stats.RecordRefund(s.ctx, s.rdb, settlement.Game, settlement.TokenName, settlement.Stake)
+		}
+	case settlement.Payout > 0:
+		metrics.BetSettled(settlement.Game, state.OutcomeWon)
+		err = stats.Record(s.ctx, s.rdb, settlement)
+	default:
+		metrics.BetSettled(settlement.Game, state.OutcomeLost)
+		err = stats.Record(s.ctx, s.rdb, settlement)
+	}
+	if err != nil {
+		log.Error("failed to record bet stats", zap.Error(err), zap.String("erg_utxo_box_id", tx.BoxId))
+	}
+}
+
+func (s *Service) setBetTxId(betKey, txId string) {
+	err := s.rdb.HSet(s.ctx, betKey, "txId", txId).Err()
+	if err != nil {
+		log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", betKey))
+	}
+}
+
+// alert publishes an alert for operators on nats.alerts_subj.
+// alertOnce publishes an alert about a bet unless the same alert was
+// published within alertRepeat.
+func (s *Service) alertOnce(a Alert) {
+	key := state.Key(fmt.Sprintf("alerts:%s:%s", a.Type, a.BoxId))
+	isNew, err := s.rdb.SetNX(s.ctx, key, "1", alertRepeat).Result()
+	if err != nil {
+		log.Error("failed to set key in redis db", zap.Error(err), zap.String("redis_key", key))
+	}
+	if isNew || err != nil {
+		s.alert(a)
+	}
+}
+
+func (s *Service) alert(a Alert) {
+	if s.nats == nil {
+		return
+	}
+
+	a.Time = time.Now().Unix()
+	data, err := json.Marshal(a)
+	if err != nil {
+		log.Error("failed to marshal alert", zap.Error(err), zap.Any("alert", a))
+		return
+	}
+
+	subj := broker.Subject(config.Current().NATS.AlertsSubj)
+	err = s.nats.Publish(subj, data)
+	if err != nil {
+		metrics.NATSError("publish")
+		log.Error("failed to publish alert", zap.Error(err), zap.String("subject", subj))
+	}
+}
@@ -0,0 +1,198 @@
+package payout
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nightowlcasino/nightowl/contracts"
+	"github.com/nightowlcasino/nightowl/devnet"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/services/stats"
+	"github.com/nightowlcasino/nightowl/state"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// placeTrackedBet places a mined bet and returns a tracked tx which spends
+// its box.
+func placeTrackedBet(t *testing.T, s *Service, chain *devnet.Chain) state.TrackedTx {
+	player := chain.RandomAddress()
+	boxId, err := chain.PlaceBet(player, 0, 17, 100)
+	require.NoError(t, err)
+	chain.Mine()
+
+	raw, err := s.ergNode.SerializeErgBox(boxId)
+	require.NoError(t, err)
+	request, err := json.Marshal(erg.TxRequest{
+		Requests:  []erg.PaymentRequest{{Address: player, Value: minBoxValue}},
+		Fee:       minBoxValue,
+		InputsRaw: []string{raw},
+	})
+	require.NoError(t, err)
+
+	settlement, err := json.Marshal(stats.Settlement{
+		Game:       contracts.Roulette,
+		TokenName:  "OWL",
+		PlayerAddr: player,
+		Stake:      100,
+		Payout:     100,
+		Subgame:    EXACT,
+		Chipspot:   17,
+		RandomNum:  17,
+		Time:       time.Now(),
+	})
+	require.NoError(t, err)
+
+	betKey := state.Key("roulette:" + boxId + ":" + player)
+	err = s.rdb.HSet(s.ctx, betKey, map[string]interface{}{
+		"status":   state.BetStatusSettled,
+		"settled":  "true",
+		"txId":     "\"unknown\"\n",
+		"tokenId":  s.contracts.TokenId("OWL"),
+		"exposure": "3600",
+	}).Err()
+	require.NoError(t, err)
+
+	return state.TrackedTx{
+		BoxId:       boxId,
+		BetKey:      betKey,
+		Kind:        state.BetStatusSettled,
+		TxId:        "unknown",
+		Request:     request,
+		Fee:         minBoxValue,
+		SubmittedAt: time.Now().Unix(),
+		Bet:         state.PendingBet{BoxId: boxId, OracleBoxId: "oracle", RandNum: "ab"},
+		Settlement:  settlement,
+	}
+}
+
+func trackedTx(t *testing.T, s *Service, boxId string) (state.TrackedTx, bool) {
+	txs, err := s.txs.All()
+	require.NoError(t, err)
+	for _, tx := range txs {
+		if tx.BoxId == boxId {
+			return tx, true
+		}
+	}
+	return state.TrackedTx{}, false
+}
+
+// betsRecorded returns how many bets were added to the roulette stats.
+func betsRecorded(t *testing.T, s *Service) int64 {
+	gs, err := stats.Load(s.ctx, s.rdb, contracts.Roulette)
+	require.NoError(t, err)
+	return gs.Tokens["OWL"].Bets
+}
+
+func TestCheckTxConfirmed(t *testing.T) {
+	s, chain, _ := newTestService(t)
+
+	tx := placeTrackedBet(t, s, chain)
+	resp, err := s.ergNode.PostErgOracleTx(tx.Request)
+	require.NoError(t, err)
+	tx.TxId = txIdFromResponse(resp)
+
+	// the bet is only counted once its tx is mined
+	s.checkTx(tx)
+	assert.Zero(t, betsRecorded(t, s))
+
+	chain.Mine()
+	s.checkTx(tx)
+	_, ok := trackedTx(t, s, tx.BoxId)
+	assert.False(t, ok)
+	assert.Equal(t, int64(1), betsRecorded(t, s))
+
+	gs, err := stats.Load(s.ctx, s.rdb, contracts.Roulette)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), gs.Tokens["OWL"].Wins)
+	assert.Equal(t, int64(100), gs.Tokens["OWL"].PaidOut)
+}
+
+func TestCheckTxRebroadcast(t *testing.T) {
+	s, chain, _ := newTestService(t)
+	viper.Set("payout.tx_watch.max_rebroadcasts", 1)
+
+	// the bet box is unspent and the tx is nowhere, it was dropped
+	tx := placeTrackedBet(t, s, chain)
+	s.checkTx(tx)
+
+	tracked, ok := trackedTx(t, s, tx.BoxId)
+	require.True(t, ok)
+	assert.Equal(t, 1, tracked.Rebroadcasts)
+	assert.Equal(t, "tx1", tracked.TxId)
+	assert.Equal(t, []string{"unknown"}, tracked.PrevTxIds)
+
+	// dropped too often, the bet is queued again to be settled by a new tx
+	s.checkTx(tracked)
+
+	_, ok = trackedTx(t, s, tx.BoxId)
+	assert.False(t, ok)
+	pb, err := s.queue.Get(tx.BoxId)
+	require.NoError(t, err)
+	assert.Equal(t, "oracle", pb.OracleBoxId)
+
+	bet, err := s.rdb.HGetAll(s.ctx, tx.BetKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, state.BetStatusPending, bet["status"])
+	assert.Equal(t, "false", bet["settled"])
+	assert.Empty(t, bet["txId"])
+
+	exposure, err := s.rdb.HGet(s.ctx, state.Key("bankroll:exposure"), s.contracts.TokenId("OWL")).Int()
+	require.NoError(t, err)
+	assert.Equal(t, 3600, exposure)
+	assert.Zero(t, betsRecorded(t, s))
+}
+
+func TestCheckTxReplace(t *testing.T) {
+	s, chain, _ := newTestService(t)
+	viper.Set("payout.tx_watch.replace_after", 60)
+
+	// the tx is stuck in the mempool
+	tx := placeTrackedBet(t, s, chain)
+	resp, err := s.ergNode.PostErgOracleTx(tx.Request)
+	require.NoError(t, err)
+	tx.TxId = txIdFromResponse(resp)
+
+	s.checkTx(tx)
+	tracked, ok := trackedTx(t, s, tx.BoxId)
+	require.True(t, ok)
+	assert.Equal(t, 0, tracked.Replacements, "not stuck for long enough")
+
+	tracked.SubmittedAt = time.Now().Add(-time.Minute).Unix()
+	s.checkTx(tracked)
+	tracked, ok = trackedTx(t, s, tx.BoxId)
+	require.True(t, ok)
+	assert.Equal(t, 1, tracked.Replacements)
+	assert.Equal(t, 2*minBoxValue, tracked.Fee)
+	assert.Equal(t, "tx1", tracked.TxId)
+}
+
+func TestCheckTxReject(t *testing.T) {
+	s, chain, _ := newTestService(t)
+	viper.Set("payout.tx_watch.spent_grace", 60)
+
+	// the bet box is spent by a tx which is not ours
+	tx := placeTrackedBet(t, s, chain)
+	_, err := s.ergNode.PostErgOracleTx(tx.Request)
+	require.NoError(t, err)
+	chain.Mine()
+
+	s.checkTx(tx)
+	tracked, ok := trackedTx(t, s, tx.BoxId)
+	require.True(t, ok)
+	assert.NotZero(t, tracked.MissingSince, "the explorer gets time to index the tx")
+
+	tracked.MissingSince = time.Now().Add(-time.Minute).Unix()
+	s.checkTx(tracked)
+	_, ok = trackedTx(t, s, tx.BoxId)
+	assert.False(t, ok)
+
+	bet, err := s.rdb.HGetAll(s.ctx, tx.BetKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, state.BetStatusRejected, bet["status"])
+	_, err = s.queue.Get(tx.BoxId)
+	assert.ErrorIs(t, err, state.ErrBetNotQueued)
+	assert.Zero(t, betsRecorded(t, s))
+}
@@ -0,0 +1,92 @@
+package payout
+
+import (
+	"fmt"
+
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/erg"
+)
+
+// TokenLimits are the stake bounds of a token accepted by a game. A MaxStake
+// of 0 means the stake is unbounded.
+type TokenLimits struct {
+	Id       string `mapstructure:"id"        json:"id"`
+	Name     string `mapstructure:"name"      json:"name"`
+	MinStake int    `mapstructure:"min_stake" json:"minStake"`
+	MaxStake int    `mapstructure:"max_stake" json:"maxStake"`
+}
+
+// loadGameTokens reads the allow-list of tokens for a game from
+// payout.games.<game>.tokens of conf, defaulting to the OWL token of the
+// contract registry with a minimum stake of 1.
+func loadGameTokens(conf *config.Config, game, owlTokenId string) (map[string]TokenLimits, error) {
+	list := []config.GameToken{{Id: owlTokenId, Name: "OWL", MinStake: 1}}
+	if g, ok := conf.Payout.Games[game]; ok && g.Tokens != nil {
+		list = g.Tokens
+	}
+
+	key := fmt.Sprintf("payout.games.%s.tokens", game)
+	tokens := make(map[string]TokenLimits, len(list))
+	for _, gt := range list {
+		t := TokenLimits(gt)
+		if len(t.Id) != 64 {
+			return nil, fmt.Errorf("config %s has invalid token id '%s'", key, t.Id)
+		}
+		if t.MaxStake > 0 && t.MaxStake < t.MinStake {
+			return nil, fmt.Errorf("config %s token %s has max_stake below min_stake", key, t.Id)
+		}
+		if t.Name == "" {
+			t.Name = t.Id[:8]
+		}
+		tokens[t.Id] = t
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("config %s does not accept any token", key)
+	}
+
+	return tokens, nil
+}
+
+// validateBet checks that a roulette bet box holds exactly one accepted token
+// with a stake inside the configured limits and carries the registers needed
+// to resolve it. It returns the matching token limits, or a reason the box
+// has to be skipped.
+func validateBet(box erg.ErgTxOutputNode, tokens map[string]TokenLimits) (TokenLimits, string) {
+	var limits TokenLimits
+
+	if len(box.Assets) == 0 {
+		return limits, "bet box holds no tokens"
+	}
+	if len(box.Assets) > 1 {
+		return limits, fmt.Sprintf("bet box holds %d tokens, expected 1", len(box.Assets))
+	}
+
+	stake := box.Assets[0]
+	limits, ok := tokens[stake.TokenId]
+	if !ok {
+		return limits, fmt.Sprintf("token %s is not accepted", stake.TokenId)
+	}
+	if stake.Amount < limits.MinStake {
+		return limits, fmt.Sprintf("stake %d is below the minimum of %d %s", stake.Amount, limits.MinStake, limits.Name)
+	}
+	if limits.MaxStake > 0 && stake.Amount > limits.MaxStake {
+		return limits, fmt.Sprintf("stake %d is above the maximum of %d %s", stake.Amount, limits.MaxStake, limits.Name)
+	}
+
+	regs := box.AdditionalRegisters
+	if len(regs.R4) <= 2 || len(regs.R5) <= 2 {
+		return limits, "bet box is missing the subgame or chipspot register"
+	}
+	if _, err := decodeIntRegister(regs.R4); err != nil {
+		return limits, fmt.Sprintf("bet box has an invalid subgame register - %s", err.Error())
+	}
+	if _, err := decodeIntRegister(regs.R5); err != nil {
+		return limits, fmt.Sprintf("bet box has an invalid chipspot register - %s", err.Error())
+	}
+	if len(regs.R6) <= 4 {
+		return limits, "bet box is missing the player address register"
+	}
+
+	return limits, ""
+}
@@ -0,0 +1,81 @@
+package payout
+
+import (
+	"testing"
+
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/stretchr/testify/assert"
+)
+
+const owlTokenId = "afd0d6cb61e86d15f2a0adc1e7e23df532ba3ff35f8ba88bed16729cae933032"
+
+func TestValidateBet(t *testing.T) {
+	otherToken := "0fdb7ff8b37479b6eb7aab38d45af2cfeefabbefdc7eebc0348d25dd65bc2c91"
+	tokens := map[string]TokenLimits{
+		owlTokenId: {Id: owlTokenId, Name: "OWL", MinStake: 10, MaxStake: 1000},
+		otherToken: {Id: otherToken, Name: "SigUSD", MinStake: 1},
+	}
+	regs := erg.RegistersNode{
+		R4: "0400",
+		R5: "0402",
+		R6: "0e240008cd03f41826ee2829c96330ade4635cf10a68cd2f362efa29ef6b0544e0f24bcf2d08",
+	}
+
+	testCases := []struct {
+		name  string
+		box   erg.ErgTxOutputNode
+		valid bool
+	}{
+		{
+			"TestValidOwlBet",
+			erg.ErgTxOutputNode{Assets: []erg.Tokens{{TokenId: owlTokenId, Amount: 20}}, AdditionalRegisters: regs},
+			true,
+		},
+		{
+			"TestUnboundedMaxStake",
+			erg.ErgTxOutputNode{Assets: []erg.Tokens{{TokenId: otherToken, Amount: 1000000}}, AdditionalRegisters: regs},
+			true,
+		},
+		{
+			"TestErgOnlyBox",
+			erg.ErgTxOutputNode{AdditionalRegisters: regs},
+			false,
+		},
+		{
+			"TestTooManyTokens",
+			erg.ErgTxOutputNode{Assets: []erg.Tokens{{TokenId: owlTokenId, Amount: 20}, {TokenId: otherToken, Amount: 1}}, AdditionalRegisters: regs},
+			false,
+		},
+		{
+			"TestUnknownToken",
+			erg.ErgTxOutputNode{Assets: []erg.Tokens{{TokenId: owlTokenId[1:] + "0", Amount: 20}}, AdditionalRegisters: regs},
+			false,
+		},
+		{
+			"TestStakeBelowMin",
+			erg.ErgTxOutputNode{Assets: []erg.Tokens{{TokenId: owlTokenId, Amount: 9}}, AdditionalRegisters: regs},
+			false,
+		},
+		{
+			"TestStakeAboveMax",
+			erg.ErgTxOutputNode{Assets: []erg.Tokens{{TokenId: owlTokenId, Amount: 1001}}, AdditionalRegisters: regs},
+			false,
+		},
+		{
+			"TestMissingPlayerRegister",
+			erg.ErgTxOutputNode{Assets: []erg.Tokens{{TokenId: owlTokenId, Amount: 20}}, AdditionalRegisters: erg.RegistersNode{R4: "0400", R5: "0402"}},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, reason := validateBet(tc.box, tokens)
+			if tc.valid {
+				assert.Empty(t, reason)
+			} else {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+}
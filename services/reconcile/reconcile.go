@@ -0,0 +1,328 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/nightowlcasino/nightowl/state"
+	"go.uber.org/zap"
+)
+
+const (
+	reportRedisKey = "reconcile:report"
+
+	// discrepancy kinds
+	MissingTxId   = "missing_tx_id"
+	TxNotFound    = "tx_not_found"
+	WinnerNotPaid = "winner_not_paid"
+	WrongAmount   = "wrong_amount"
+	CheckFailed   = "check_failed"
+)
+
+var (
+	log *zap.Logger
+)
+
+// Discrepancy is a settled bet whose redis record does not match the chain.
+type Discrepancy struct {
+	BetKey     string `json:"betKey"`
+	TxId       string `json:"txId"`
+	WinnerAddr string `json:"winnerAddr"`
+	Kind       string `json:"kind"`
+	Detail     string `json:"detail"`
+}
+
+// Report is the result of a reconciliation run.
+type Report struct {
+	StartedAt     int64         `json:"startedAt"`
+	DurationMs    int64         `json:"durationMs"`
+	Checked       int           `json:"checked"`
+	Confirmed     int           `json:"confirmed"`
+	Unconfirmed   int           `json:"unconfirmed"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+func (r Report) MarshalBinary() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// Service periodically walks the settled bets in redis and verifies that
+// their txs exist on chain and pay the recorded winner the recorded amount.
+type Service struct {
+	ctx         context.Context
+	component   string
+	ergNode     *erg.ErgNode
+	ergExplorer *erg.Explorer
+	interval    time.Duration
+	rdb         redis.UniversalClient
+	stop        chan bool
+	done        chan bool
+	wg          *sync.WaitGroup
+}
+
+func NewService(rdb redis.UniversalClient, retryClient *retryablehttp.Client, wg *sync.WaitGroup) (service *Service, err error) {
+
+	ctx := context.Background()
+	log = zap.L()
+
+	ergExplorerClient, err := erg.NewExplorer(retryClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erg explorer client - %s", err.Error())
+	}
+
+	ergNodeClient, err := erg.NewErgNode(retryClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erg node client - %s", err.Error())
+	}
+
+	interval := time.Hour
+	if value := config.Current().Reconcile.Interval; value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	service = &Service{
+		ctx:         ctx,
+		component:   "reconcile",
+		ergNode:     ergNodeClient,
+		ergExplorer: ergExplorerClient,
+		interval:    interval,
+		rdb:         rdb,
+		stop:        make(chan bool),
+		done:        make(chan bool),
+		wg:          wg,
+	}
+
+	return service, nil
+}
+
+func wait(sleepTime time.Duration, c chan bool) {
+	time.Sleep(sleepTime)
+	c <- true
+}
+
+func (s *Service) reconcileBets(stop chan bool) {
+	check := make(chan bool, 1)
+
+	check <- true
+
+loop:
+	for {
+		select {
+		case <-stop:
+			log.Info("stopping reconcileBets() loop...")
+			s.wg.Done()
+			break loop
+		case <-check:
+			report, err := s.Run()
+			if err != nil {
+				log.Error("failed to reconcile bets", zap.Error(err))
+			} else {
+				log.Info("finished reconciling bets",
+					zap.Int("checked", report.Checked),
+					zap.Int("discrepancies", len(report.Discrepancies)),
+					zap.Int64("durationMs", report.DurationMs),
+				)
+			}
+
+			go wait(s.interval, check)
+		}
+	}
+}
+
+// Run checks every settled bet once and stores the report in redis.
+func (s *Service) Run() (Report, error) {
+	start := time.Now()
+	report := Report{
+		StartedAt:     start.Unix(),
+		Discrepancies: []Discrepancy{},
+	}
+
+	err := state.ScanKeys(s.ctx, s.rdb, state.Key("roulette:*"), func(betKey string) error {
+		bet, err := s.rdb.HGetAll(s.ctx, betKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get key '%s' from redis db - %s", betKey, err.Error())
+		}
+		if bet["settled"] != "true" {
+			return nil
+		}
+
+		report.Checked++
+		confirmed, d := s.checkBet(betKey, bet)
+		switch {
+		case d != nil:
+			report.Discrepancies = append(report.Discrepancies, *d)
+		case confirmed:
+			report.Confirmed++
+		default:
+			report.Unconfirmed++
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		return report.Discrepancies[i].BetKey < report.Discrepancies[j].BetKey
+	})
+	report.DurationMs = time.Since(start).Milliseconds()
+
+	err = s.rdb.Set(s.ctx, state.Key(reportRedisKey), report, 0).Err()
+	if err != nil {
+		return report, fmt.Errorf("failed to set key '%s' in redis db - %s", state.Key(reportRedisKey), err.Error())
+	}
+
+	return report, nil
+}
+
+// checkBet looks up the tx of a settled bet, first on chain then in the
+// mempool, and verifies it pays the winner. It returns whether the tx is
+// confirmed, or the discrepancy found.
+func (s *Service) checkBet(betKey string, bet map[string]string) (bool, *Discrepancy) {
+	// the tx id is stored the way the node answered it, as a json string
+	d := &Discrepancy{
+		BetKey:     betKey,
+		TxId:       strings.Trim(strings.TrimSpace(bet["txId"]), "\""),
+		WinnerAddr: bet["winnerAddr"],
+	}
+
+	if d.TxId == "" {
+		d.Kind = MissingTxId
+		d.Detail = "bet is settled without a tx id"
+		return false, d
+	}
+
+	winnerTree, err := erg.AddressToErgoTree(d.WinnerAddr)
+	if err != nil {
+		d.Kind = CheckFailed
+		d.Detail = fmt.Sprintf("invalid winner address - %s", err.Error())
+		return false, d
+	}
+
+	amount, _ := strconv.Atoi(bet["winnerAmt"])
+
+	tx, err := s.ergExplorer.GetErgTx(d.TxId)
+	switch {
+	case err == erg.ErrTxNotFound:
+		utx, err := s.ergNode.GetUnconfirmedTx(d.TxId)
+		switch {
+		case err != nil:
+			d.Kind = CheckFailed
+			d.Detail = err.Error()
+			return false, d
+		case utx.Id == "":
+			d.Kind = TxNotFound
+			d.Detail = "tx is neither on chain nor in the mempool"
+			return false, d
+		}
+
+		var outputs []output
+		for _, o := range utx.Outputs {
+			outputs = append(outputs, output{ergoTree: o.ErgoTree, assets: o.Assets})
+		}
+		return false, verifyPayment(d, outputs, winnerTree, bet["tokenId"], amount)
+	case err != nil:
+		d.Kind = CheckFailed
+		d.Detail = err.Error()
+		return false, d
+	}
+
+	var outputs []output
+	for _, o := range tx.Outputs {
+		outputs = append(outputs, output{ergoTree: o.ErgoTree, assets: o.Assets})
+	}
+	return true, verifyPayment(d, outputs, winnerTree, bet["tokenId"], amount)
+}
+
+type output struct {
+	ergoTree string
+	assets   []erg.Tokens
+}
+
+// verifyPayment returns d filled in if no output pays amount of the token to
+// the winner, nil otherwise.
+func verifyPayment(d *Discrepancy, outputs []output, winnerTree, tokenId string, amount int) *Discrepancy {
+	paid := -1
+	for _, o := range outputs {
+		if o.ergoTree != winnerTree {
+			continue
+		}
+		if paid < 0 {
+			paid = 0
+		}
+		for _, t := range o.assets {
+			if tokenId == "" || t.TokenId == tokenId {
+				paid += t.Amount
+			}
+		}
+	}
+
+	switch {
+	case paid < 0:
+		d.Kind = WinnerNotPaid
+		d.Detail = "no output of the tx goes to the winner address"
+		return d
+	case paid != amount:
+		d.Kind = WrongAmount
+		d.Detail = fmt.Sprintf("winner received %d but the recorded amount is %d", paid, amount)
+		return d
+	}
+
+	return nil
+}
+
+func (s *Service) Start() {
+
+	stopReconcile := make(chan bool)
+	s.wg.Add(1)
+	go s.reconcileBets(stopReconcile)
+
+	// Wait for a "stop" message in the background to stop the service.
+	go func(stopReconcile chan bool) {
+		go func() {
+			<-s.stop
+			stopReconcile <- true
+			s.done <- true
+		}()
+	}(stopReconcile)
+}
+
+func (s *Service) Stop() {
+	s.stop <- true
+}
+
+func (s *Service) Wait(wg *sync.WaitGroup) {
+	defer wg.Done()
+	<-s.done
+}
+
+// LoadReport returns the report of the last reconciliation run, empty if
+// none ran yet.
+func LoadReport(ctx context.Context, rdb redis.UniversalClient) (Report, error) {
+	var report Report
+
+	val, err := rdb.Get(ctx, state.Key(reportRedisKey)).Result()
+	switch {
+	case err == redis.Nil:
+		return report, nil
+	case err != nil:
+		return report, fmt.Errorf("failed to get key '%s' from redis db - %s", state.Key(reportRedisKey), err.Error())
+	}
+
+	err = json.Unmarshal([]byte(val), &report)
+	if err != nil {
+		return report, fmt.Errorf("failed to unmarshal reconcile report - %s", err.Error())
+	}
+
+	return report, nil
+}
@@ -0,0 +1,97 @@
+package reconcile
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/nightowlcasino/nightowl/erg"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPayment(t *testing.T) {
+	token := "afd0d6cb61e86d15f2a0adc1e7e23df532ba3ff35f8ba88bed16729cae933032"
+	winner := "0008cd03f41826ee2829c96330ade4635cf10a68cd2f362efa29ef6b0544e0f24bcf2d08"
+	outputs := []output{
+		{ergoTree: winner, assets: []erg.Tokens{{TokenId: token, Amount: 20}}},
+		{ergoTree: "1005040004000e36100204a00b08cd", assets: nil},
+	}
+
+	testCases := []struct {
+		name     string
+		outputs  []output
+		amount   int
+		wantKind string
+	}{
+		{"TestPaid", outputs, 20, ""},
+		{"TestWrongAmount", outputs, 40, WrongAmount},
+		{"TestWinnerNotPaid", outputs[1:], 20, WinnerNotPaid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := verifyPayment(&Discrepancy{}, tc.outputs, winner, token, tc.amount)
+			if tc.wantKind == "" {
+				assert.Nil(t, d)
+				return
+			}
+			assert.NotNil(t, d)
+			assert.Equal(t, tc.wantKind, d.Kind)
+		})
+	}
+}
+
+func TestCheckBet(t *testing.T) {
+	token := "afd0d6cb61e86d15f2a0adc1e7e23df532ba3ff35f8ba88bed16729cae933032"
+	winnerTree := "0008cd03f41826ee2829c96330ade4635cf10a68cd2f362efa29ef6b0544e0f24bcf2d08"
+	pubKey, _ := hex.DecodeString(winnerTree[6:])
+	winner := erg.NewP2PKAddress(erg.MainnetPrefix, pubKey).String()
+	txId := "481c5b6e2c4a8d3f1e0b9a7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/transactions/"+txId {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(erg.ErgTx{
+			Id: txId,
+			Outputs: []erg.ErgTxOutput{
+				{ErgoTree: winnerTree, Assets: []erg.Tokens{{TokenId: token, Amount: 20}}},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	viper.Reset()
+	defer viper.Reset()
+	u, _ := url.Parse(srv.URL)
+	viper.Set("explorer_node.scheme", "http")
+	viper.Set("explorer_node.fqdn", u.Hostname())
+	port, _ := strconv.Atoi(u.Port())
+	viper.Set("explorer_node.port", port)
+	viper.Set("ergo_node.user", "")
+	viper.Set("ergo_node.password", "")
+
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	explorer, err := erg.NewExplorer(client)
+	require.NoError(t, err)
+	s := &Service{ergExplorer: explorer}
+
+	// processBet stores the response of the node, a json string and a newline
+	confirmed, d := s.checkBet("bet", map[string]string{
+		"txId":       "\"" + txId + "\"\n",
+		"winnerAddr": winner,
+		"winnerAmt":  "20",
+		"tokenId":    token,
+	})
+	assert.True(t, confirmed)
+	assert.Nil(t, d)
+}
@@ -2,9 +2,12 @@ package rng
 
 import (
 	"encoding/json"
+	"sync/atomic"
+	"time"
 
 	"github.com/nats-io/nats.go"
-	"github.com/spf13/viper"
+	"github.com/nightowlcasino/nightowl/config"
+	"github.com/nightowlcasino/nightowl/metrics"
 	"go.uber.org/zap"
 )
 
@@ -15,6 +18,9 @@ const (
 type Service struct {
 	component string
 	nats      *nats.Conn
+
+	// unix nano time of the last combined hash received
+	lastBeacon int64
 }
 
 type CombinedHashes struct {
@@ -37,10 +43,13 @@ func NewService(nats *nats.Conn) (service *Service, err error) {
 		nats:      nats,
 	}
 
-	if _, err = nats.Subscribe(viper.Get("nats.random_number_subj").(string), service.handleNATSMessages); err != nil {
+	// the drand hashes are published by an external service, so their subject
+	// does not get the subject prefix
+	subj := config.Current().NATS.RandomNumberSubj
+	if _, err = nats.Subscribe(subj, service.handleNATSMessages); err != nil {
 		return nil, err
 	}
-	log.Info("successfully subscribed to " + viper.Get("nats.random_number_subj").(string))
+	log.Info("successfully subscribed to " + subj)
 
 	return service, err
 }
@@ -52,6 +61,8 @@ func (s *Service) handleNATSMessages(msg *nats.Msg) {
 	if err != nil {
 		log.Error("failed to unmarshal CombinedHashes", zap.Error(err))
 	} else {
+		metrics.BeaconReceived()
+		atomic.StoreInt64(&s.lastBeacon, time.Now().UnixNano())
 		combinedHashes[index%SLICE_SIZE] = hash
 		// the drand random numbers are stored in a hash map and will be set to the next drand hash number
 		// from the initially associated one
@@ -72,4 +83,14 @@ func (s *Service) handleNATSMessages(msg *nats.Msg) {
 
 		index++
 	}
-}
\ No newline at end of file
+}
+
+// LastBeacon returns when the last combined drand hash was received, the zero
+// time if none was received yet.
+func (s *Service) LastBeacon() time.Time {
+	last := atomic.LoadInt64(&s.lastBeacon)
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
@@ -0,0 +1,251 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/nightowlcasino/nightowl/state"
+)
+
+const (
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+
+	// leaderboards are kept a little longer than their period so that the
+	// previous one can still be looked at
+	dayLeaderboardTTL  = 8 * 24 * time.Hour
+	weekLeaderboardTTL = 5 * 7 * 24 * time.Hour
+)
+
+// Settlement is a bet settled by the payout service, as counted in the stats.
+type Settlement struct {
+	Game       string
+	TokenName  string
+	PlayerAddr string
+	Stake      int
+	// Payout is what the player received, zero if the house won
+	Payout int
+	// ExpectedPayout is the payout the bet is worth on average given the odds
+	// of its subgame
+	ExpectedPayout float64
+	Subgame        int
+	Chipspot       int
+	RandomNum      int
+	Time           time.Time
+}
+
+// TokenStats are the totals of the bets of a game placed with one token.
+type TokenStats struct {
+	Bets            int64   `json:"bets"`
+	Wins            int64   `json:"wins"`
+	Wagered         int64   `json:"wagered"`
+	PaidOut         int64   `json:"paidOut"`
+	Refunds         int64   `json:"refunds"`
+	Refunded        int64   `json:"refunded"`
+	RealisedEdge    float64 `json:"realisedHouseEdge"`
+	TheoreticalEdge float64 `json:"theoreticalHouseEdge"`
+}
+
+// GameStats are the stats of one game.
+type GameStats struct {
+	Tokens map[string]TokenStats `json:"tokens"`
+	// bet counts keyed by "<subgame>:<chipspot>"
+	Bets map[string]int64 `json:"bets"`
+	// how often every random number came up, keyed by the number
+	Outcomes map[string]int64 `json:"outcomes"`
+}
+
+// LeaderboardEntry is a player and their net winnings over a period.
+type LeaderboardEntry struct {
+	Rank       int    `json:"rank"`
+	PlayerAddr string `json:"playerAddr"`
+	NetWin     int64  `json:"netWin"`
+}
+
+func tokensKey(game string) string {
+	return state.Key(fmt.Sprintf("stats:%s:tokens", game))
+}
+
+func tokenKey(game, token string) string {
+	return state.Key(fmt.Sprintf("stats:%s:token:%s", game, token))
+}
+
+func betsKey(game string) string {
+	return state.Key(fmt.Sprintf("stats:%s:bets", game))
+}
+
+func outcomesKey(game string) string {
+	return state.Key(fmt.Sprintf("stats:%s:outcomes", game))
+}
+
+// periodId returns the day (2022-08-05) or ISO week (2022-W31) t falls in.
+func periodId(period string, t time.Time) string {
+	t = t.UTC()
+	if period == PeriodWeek {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format("2006-01-02")
+}
+
+func leaderboardKey(game, token, period string, t time.Time) string {
+	return state.Key(fmt.Sprintf("leaderboard:%s:%s:%s:%s", game, token, period, periodId(period, t)))
+}
+
+// Record adds a settled bet to the stats and leaderboards of its game.
+func Record(ctx context.Context, rdb redis.UniversalClient, s Settlement) error {
+	tk := tokenKey(s.Game, s.TokenName)
+	dayKey := leaderboardKey(s.Game, s.TokenName, PeriodDay, s.Time)
+	weekKey := leaderboardKey(s.Game, s.TokenName, PeriodWeek, s.Time)
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, tokensKey(s.Game), s.TokenName)
+
+		pipe.HIncrBy(ctx, tk, "bets", 1)
+		pipe.HIncrBy(ctx, tk, "wagered", int64(s.Stake))
+		pipe.HIncrBy(ctx, tk, "paid_out", int64(s.Payout))
+		pipe.HIncrByFloat(ctx, tk, "expected_paid_out", s.ExpectedPayout)
+		if s.Payout > 0 {
+			pipe.HIncrBy(ctx, tk, "wins", 1)
+		}
+
+		pipe.HIncrBy(ctx, betsKey(s.Game), fmt.Sprintf("%d:%d", s.Subgame, s.Chipspot), 1)
+		pipe.HIncrBy(ctx, outcomesKey(s.Game), strconv.Itoa(s.RandomNum), 1)
+
+		net := float64(s.Payout - s.Stake)
+		pipe.ZIncrBy(ctx, dayKey, net, s.PlayerAddr)
+		pipe.Expire(ctx, dayKey, dayLeaderboardTTL)
+		pipe.ZIncrBy(ctx, weekKey, net, s.PlayerAddr)
+		pipe.Expire(ctx, weekKey, weekLeaderboardTTL)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record stats of %s bet - %s", s.Game, err.Error())
+	}
+
+	return nil
+}
+
+// RecordRefund adds a refunded bet to the stats of its game. Refunds are not
+// wagers, so they do not count towards the house edge.
+func RecordRefund(ctx context.Context, rdb redis.UniversalClient, game, token string, stake int) error {
+	tk := tokenKey(game, token)
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, tokensKey(game), token)
+		pipe.HIncrBy(ctx, tk, "refunds", 1)
+		pipe.HIncrBy(ctx, tk, "refunded", int64(stake))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record refund stats of %s bet - %s", game, err.Error())
+	}
+
+	return nil
+}
+
+// Load returns the stats of a game.
+func Load(ctx context.Context, rdb redis.UniversalClient, game string) (GameStats, error) {
+	gs := GameStats{
+		Tokens:   make(map[string]TokenStats),
+		Bets:     make(map[string]int64),
+		Outcomes: make(map[string]int64),
+	}
+
+	tokens, err := rdb.SMembers(ctx, tokensKey(game)).Result()
+	if err != nil {
+		return gs, fmt.Errorf("failed to get key '%s' from redis db - %s", tokensKey(game), err.Error())
+	}
+
+	for _, token := range tokens {
+		vals, err := rdb.HGetAll(ctx, tokenKey(game, token)).Result()
+		if err != nil {
+			return gs, fmt.Errorf("failed to get key '%s' from redis db - %s", tokenKey(game, token), err.Error())
+		}
+		gs.Tokens[token] = tokenStats(vals)
+	}
+
+	for key, m := range map[string]map[string]int64{betsKey(game): gs.Bets, outcomesKey(game): gs.Outcomes} {
+		vals, err := rdb.HGetAll(ctx, key).Result()
+		if err != nil {
+			return gs, fmt.Errorf("failed to get key '%s' from redis db - %s", key, err.Error())
+		}
+		for field, val := range vals {
+			m[field], _ = strconv.ParseInt(val, 10, 64)
+		}
+	}
+
+	return gs, nil
+}
+
+func tokenStats(vals map[string]string) TokenStats {
+	var ts TokenStats
+
+	for field, dst := range map[string]*int64{
+		"bets":     &ts.Bets,
+		"wins":     &ts.Wins,
+		"wagered":  &ts.Wagered,
+		"paid_out": &ts.PaidOut,
+		"refunds":  &ts.Refunds,
+		"refunded": &ts.Refunded,
+	} {
+		*dst, _ = strconv.ParseInt(vals[field], 10, 64)
+	}
+	expected, _ := strconv.ParseFloat(vals["expected_paid_out"], 64)
+
+	if ts.Wagered > 0 {
+		ts.RealisedEdge = 1 - float64(ts.PaidOut)/float64(ts.Wagered)
+		ts.TheoreticalEdge = 1 - expected/float64(ts.Wagered)
+	}
+
+	return ts
+}
+
+// Leaderboard returns the players with the highest net winnings with a token
+// in the day or week t falls in, only players who are ahead are listed.
+func Leaderboard(ctx context.Context, rdb redis.UniversalClient, game, token, period string, t time.Time, limit int) ([]LeaderboardEntry, error) {
+	key := leaderboardKey(game, token, period, t)
+
+	members, err := rdb.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min:   "(0",
+		Max:   "+inf",
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key '%s' from redis db - %s", key, err.Error())
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(members))
+	for i, m := range members {
+		entries = append(entries, LeaderboardEntry{
+			Rank:       i + 1,
+			PlayerAddr: m.Member.(string),
+			NetWin:     int64(m.Score),
+		})
+	}
+
+	return entries, nil
+}
+
+// Games returns the games with recorded stats.
+func Games(ctx context.Context, rdb redis.UniversalClient) ([]string, error) {
+	var games []string
+
+	err := state.ScanKeys(ctx, rdb, state.Key("stats:*:tokens"), func(key string) error {
+		parts := strings.Split(key, ":")
+		games = append(games, parts[len(parts)-2])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(games)
+
+	return games, nil
+}
@@ -0,0 +1,36 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodId(t *testing.T) {
+	at := time.Date(2022, 8, 5, 23, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, "2022-08-05", periodId(PeriodDay, at))
+	assert.Equal(t, "2022-W31", periodId(PeriodWeek, at))
+	// the first days of january may belong to the last week of the year before
+	assert.Equal(t, "2021-W52", periodId(PeriodWeek, time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestTokenStats(t *testing.T) {
+	ts := tokenStats(map[string]string{
+		"bets":              "4",
+		"wins":              "1",
+		"wagered":           "400",
+		"paid_out":          "200",
+		"expected_paid_out": "389.1891891891892",
+		"refunds":           "1",
+		"refunded":          "100",
+	})
+
+	assert.Equal(t, int64(4), ts.Bets)
+	assert.Equal(t, int64(100), ts.Refunded)
+	assert.InDelta(t, 0.5, ts.RealisedEdge, 1e-9)
+	assert.InDelta(t, 1.0/37, ts.TheoreticalEdge, 1e-9)
+
+	assert.Zero(t, tokenStats(map[string]string{}).RealisedEdge)
+}
@@ -0,0 +1,277 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+const (
+	pendingBetsRedisKey    = "payout:pending"
+	deadLetterBetsRedisKey = "payout:deadletter"
+	queuedBetsRedisKey     = "payout:bets"
+)
+
+var (
+	ErrBetNotQueued = errors.New("bet is not in the queue")
+)
+
+// PendingBet is a bet found in an oracle tx which has not been resolved yet,
+// along with everything needed to settle it without re-scanning the explorer.
+type PendingBet struct {
+	BoxId       string `json:"boxId"`
+	OracleTxId  string `json:"oracleTxId"`
+	OracleBoxId string `json:"oracleBoxId"`
+	Height      int    `json:"height"`
+	PosX        int    `json:"posX"`
+	PosY        int    `json:"posY"`
+	RandNum     string `json:"randomNum"`
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"lastError,omitempty"`
+	FirstSeen   int64  `json:"firstSeen"`
+	NextAttempt int64  `json:"nextAttempt"`
+	// trace context of the scan which found the bet
+	TraceParent string `json:"traceParent,omitempty"`
+}
+
+func (pb PendingBet) MarshalBinary() ([]byte, error) {
+	return json.Marshal(pb)
+}
+
+// BetQueue stores pending bets in redis. Bets due for a retry are kept in a
+// sorted set scored by their next attempt time, bets which failed too often
+// are moved to a dead letter set until an operator retries them.
+type BetQueue struct {
+	ctx context.Context
+	rdb redis.UniversalClient
+}
+
+func NewBetQueue(ctx context.Context, rdb redis.UniversalClient) *BetQueue {
+	return &BetQueue{
+		ctx: ctx,
+		rdb: rdb,
+	}
+}
+
+// Enqueue adds a bet to the pending queue. If the bet is already known the
+// entry is only replaced when the new one carries a random number from a
+// more recent oracle tx, keeping the attempt history intact.
+func (q *BetQueue) Enqueue(pb PendingBet) error {
+	old, err := q.Get(pb.BoxId)
+	switch {
+	case err == ErrBetNotQueued:
+		pb.FirstSeen = time.Now().Unix()
+	case err != nil:
+		return err
+	default:
+		if pb.RandNum == "" || (old.RandNum != "" && old.Height >= pb.Height) {
+			return nil
+		}
+		pb.Attempts = old.Attempts
+		pb.LastError = old.LastError
+		pb.FirstSeen = old.FirstSeen
+	}
+
+	// bets in the dead letter set stay there until retried by an operator
+	dead, err := q.isDeadLetter(pb.BoxId)
+	if err != nil {
+		return err
+	}
+
+	err = q.rdb.HSet(q.ctx, Key(queuedBetsRedisKey), pb.BoxId, pb).Err()
+	if err != nil {
+		return fmt.Errorf("failed to store pending bet %s in redis db - %s", pb.BoxId, err.Error())
+	}
+
+	if !dead {
+		err = q.rdb.ZAddNX(q.ctx, Key(pendingBetsRedisKey), redis.Z{Score: float64(time.Now().Unix()), Member: pb.BoxId}).Err()
+		if err != nil {
+			return fmt.Errorf("failed to add bet %s to redis db key - %s - %s", pb.BoxId, pendingBetsRedisKey, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Get returns the queued bet with the given box id.
+func (q *BetQueue) Get(boxId string) (PendingBet, error) {
+	var pb PendingBet
+
+	val, err := q.rdb.HGet(q.ctx, Key(queuedBetsRedisKey), boxId).Result()
+	switch {
+	case err == redis.Nil:
+		return pb, ErrBetNotQueued
+	case err != nil:
+		return pb, fmt.Errorf("failed to get queued bet %s from redis db - %s", boxId, err.Error())
+	}
+
+	err = json.Unmarshal([]byte(val), &pb)
+	if err != nil {
+		return pb, fmt.Errorf("failed to unmarshal queued bet %s - %s", boxId, err.Error())
+	}
+
+	return pb, nil
+}
+
+// Due returns up to limit pending bets whose next attempt time has passed.
+func (q *BetQueue) Due(now time.Time, limit int) ([]PendingBet, error) {
+	boxIds, err := q.rdb.ZRangeByScore(q.ctx, Key(pendingBetsRedisKey), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due bets from redis db key - %s - %s", pendingBetsRedisKey, err.Error())
+	}
+
+	return q.getAll(boxIds)
+}
+
+// Pending returns every bet in the pending queue.
+func (q *BetQueue) Pending() ([]PendingBet, error) {
+	return q.members(Key(pendingBetsRedisKey))
+}
+
+// DeadLetters returns every bet in the dead letter set.
+func (q *BetQueue) DeadLetters() ([]PendingBet, error) {
+	return q.members(Key(deadLetterBetsRedisKey))
+}
+
+// Remove drops a resolved bet from the queue.
+func (q *BetQueue) Remove(boxId string) error {
+	_, err := q.rdb.TxPipelined(q.ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(q.ctx, Key(pendingBetsRedisKey), boxId)
+		pipe.ZRem(q.ctx, Key(deadLetterBetsRedisKey), boxId)
+		pipe.HDel(q.ctx, Key(queuedBetsRedisKey), boxId)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove bet %s from redis db queue - %s", boxId, err.Error())
+	}
+
+	return nil
+}
+
+// Defer schedules the bet for another attempt without counting a failure,
+// used for bets which are still waiting on a random number.
+func (q *BetQueue) Defer(boxId string, next time.Time) error {
+	err := q.rdb.ZAddXX(q.ctx, Key(pendingBetsRedisKey), redis.Z{Score: float64(next.Unix()), Member: boxId}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to defer bet %s in redis db key - %s - %s", boxId, pendingBetsRedisKey, err.Error())
+	}
+
+	return nil
+}
+
+// Fail records a failed attempt. The bet is retried after backoff times the
+// number of attempts, or moved to the dead letter set once maxAttempts is
+// reached. It returns true when the bet was dead lettered.
+func (q *BetQueue) Fail(pb PendingBet, cause error, maxAttempts int, backoff time.Duration) (bool, error) {
+	pb.Attempts++
+	pb.LastError = cause.Error()
+	pb.NextAttempt = time.Now().Add(time.Duration(pb.Attempts) * backoff).Unix()
+	dead := maxAttempts > 0 && pb.Attempts >= maxAttempts
+
+	_, err := q.rdb.TxPipelined(q.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(q.ctx, Key(queuedBetsRedisKey), pb.BoxId, pb)
+		if dead {
+			pipe.ZRem(q.ctx, Key(pendingBetsRedisKey), pb.BoxId)
+			pipe.ZAdd(q.ctx, Key(deadLetterBetsRedisKey), redis.Z{Score: float64(time.Now().Unix()), Member: pb.BoxId})
+		} else {
+			pipe.ZAdd(q.ctx, Key(pendingBetsRedisKey), redis.Z{Score: float64(pb.NextAttempt), Member: pb.BoxId})
+		}
+		return nil
+	})
+	if err != nil {
+		return dead, fmt.Errorf("failed to record failed attempt of bet %s in redis db - %s", pb.BoxId, err.Error())
+	}
+
+	return dead, nil
+}
+
+// Retry moves a dead lettered bet back to the pending queue with a fresh
+// attempt count.
+func (q *BetQueue) Retry(boxId string) error {
+	dead, err := q.isDeadLetter(boxId)
+	if err != nil {
+		return err
+	}
+	if !dead {
+		return ErrBetNotQueued
+	}
+
+	pb, err := q.Get(boxId)
+	if err != nil {
+		return err
+	}
+	pb.Attempts = 0
+	pb.NextAttempt = 0
+
+	_, err = q.rdb.TxPipelined(q.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(q.ctx, Key(queuedBetsRedisKey), pb.BoxId, pb)
+		pipe.ZRem(q.ctx, Key(deadLetterBetsRedisKey), pb.BoxId)
+		pipe.ZAdd(q.ctx, Key(pendingBetsRedisKey), redis.Z{Score: float64(time.Now().Unix()), Member: pb.BoxId})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to retry bet %s in redis db - %s", boxId, err.Error())
+	}
+
+	return nil
+}
+
+func (q *BetQueue) isDeadLetter(boxId string) (bool, error) {
+	_, err := q.rdb.ZScore(q.ctx, Key(deadLetterBetsRedisKey), boxId).Result()
+	switch {
+	case err == redis.Nil:
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to check redis db key - %s - %s", deadLetterBetsRedisKey, err.Error())
+	}
+
+	return true, nil
+}
+
+func (q *BetQueue) members(key string) ([]PendingBet, error) {
+	boxIds, err := q.rdb.ZRange(q.ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of redis db key - %s - %s", key, err.Error())
+	}
+
+	return q.getAll(boxIds)
+}
+
+func (q *BetQueue) getAll(boxIds []string) ([]PendingBet, error) {
+	bets := make([]PendingBet, 0, len(boxIds))
+
+	if len(boxIds) == 0 {
+		return bets, nil
+	}
+
+	vals, err := q.rdb.HMGet(q.ctx, Key(queuedBetsRedisKey), boxIds...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queued bets from redis db - %s", err.Error())
+	}
+
+	for i, val := range vals {
+		var pb PendingBet
+
+		str, ok := val.(string)
+		if !ok {
+			// entry vanished between the two calls, skip it
+			continue
+		}
+		err = json.Unmarshal([]byte(str), &pb)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal queued bet %s - %s", boxIds[i], err.Error())
+		}
+		bets = append(bets, pb)
+	}
+
+	return bets, nil
+}
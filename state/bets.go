@@ -0,0 +1,12 @@
+package state
+
+const (
+	// bet status values stored in the status field of a bet record
+	// the bet box was seen in the mempool but not picked up by the payout service yet
+	BetStatusDetected = "detected"
+	BetStatusPending  = "pending"
+	BetStatusSettled  = "settled"
+	BetStatusRefunded = "refunded"
+	// the settlement tx of the bet was rejected by the network
+	BetStatusRejected = "rejected"
+)
@@ -0,0 +1,41 @@
+package state
+
+import "strings"
+
+// prefix is prepended to every redis key so that several deployments can
+// share a redis db. In cluster mode it is a hash tag such as {nightowl} which
+// keeps every key in the same slot.
+var prefix string
+
+// namespace is prepended to every redis key so that a shadow instance, e.g. a
+// payout service in dry-run mode, never touches the keys of the instance it
+// shadows.
+var namespace string
+
+// SetPrefix sets the redis.key_prefix of every redis key built with Key. It
+// has to be called before any service is created.
+func SetPrefix(p string) {
+	prefix = p
+}
+
+// SetNamespace sets the prefix of every redis key built with Key. It has to be
+// called before any service is created.
+func SetNamespace(ns string) {
+	namespace = ns
+}
+
+// Key returns the redis key with the configured prefix in the current
+// namespace.
+func Key(key string) string {
+	if prefix == "" && namespace == "" {
+		return key
+	}
+
+	parts := make([]string, 0, 3)
+	for _, p := range []string{prefix, namespace, key} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ":")
+}
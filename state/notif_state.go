@@ -16,11 +16,11 @@ type NotifState struct {
 	NotConfirmed map[string]bool
 
 	ctx context.Context
-	rdb *redis.Client
+	rdb redis.UniversalClient
 	mu sync.Mutex
 }
 
-func NewNotifState(ctx context.Context, rdb *redis.Client) *NotifState {
+func NewNotifState(ctx context.Context, rdb redis.UniversalClient) *NotifState {
 	return &NotifState{
 		NotConfirmed: make(map[string]bool),
 
@@ -36,7 +36,7 @@ func (ns *NotifState) DBSync() error {
 	var err error
 	var utxos []string
 
-	utxos, err = ns.rdb.SMembers(ns.ctx, notConfirmedRedisKey).Result()
+	utxos, err = ns.rdb.SMembers(ns.ctx, Key(notConfirmedRedisKey)).Result()
 	if err != nil {
 		return fmt.Errorf("failed to get not confirmed txs from redis db - %s", err.Error())
 	}
@@ -56,7 +56,7 @@ func (ns *NotifState) AddNotConfirmed(betKey string) error {
 
 	ns.NotConfirmed[betKey] = true
 
-	err = ns.rdb.SAdd(ns.ctx, notConfirmedRedisKey, betKey).Err()
+	err = ns.rdb.SAdd(ns.ctx, Key(notConfirmedRedisKey), betKey).Err()
 	if err != nil {
 		return fmt.Errorf("failed to add not confirmed tx to redis db key - %s - %s", notConfirmedRedisKey, err.Error())
 	}
@@ -72,7 +72,7 @@ func (ns *NotifState) RemoveNotConfirmed(betKey string) error {
 
 	delete(ns.NotConfirmed, betKey)
 
-	err = ns.rdb.SRem(ns.ctx, notConfirmedRedisKey, betKey).Err()
+	err = ns.rdb.SRem(ns.ctx, Key(notConfirmedRedisKey), betKey).Err()
 	if err != nil {
 		return fmt.Errorf("failed to remove not confirmed tx from redis db key - %s - %s", notConfirmedRedisKey, err.Error())
 	}
@@ -80,3 +80,11 @@ func (ns *NotifState) RemoveNotConfirmed(betKey string) error {
 	return nil
 }
 
+
+// Len returns the number of payouts whose players were not notified yet.
+func (ns *NotifState) Len() int {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	return len(ns.NotConfirmed)
+}
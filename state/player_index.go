@@ -0,0 +1,251 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+)
+
+const (
+	// bet outcomes as seen by the player
+	OutcomePending  = "pending"
+	OutcomeWon      = "won"
+	OutcomeLost     = "lost"
+	OutcomeRefunded = "refunded"
+	OutcomeRejected = "rejected"
+
+	playerBetsPageSize = 100
+)
+
+// PlayerBet is a bet as listed in the bet history of a player.
+type PlayerBet struct {
+	Game       string `json:"game"`
+	BoxId      string `json:"boxId"`
+	Status     string `json:"status"`
+	Outcome    string `json:"outcome"`
+	Stake      string `json:"stake"`
+	Payout     string `json:"payout"`
+	TokenId    string `json:"tokenId"`
+	TokenName  string `json:"tokenName"`
+	Subgame    string `json:"subgame"`
+	Number     string `json:"number"`
+	RandomNum  string `json:"randomNum"`
+	BetTxId    string `json:"betTxId,omitempty"`
+	ResultTxId string `json:"resultTxId"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// PlayerBetQuery filters and pages the bet history of a player. Bets are
+// listed newest first, zero values match everything.
+type PlayerBetQuery struct {
+	Game   string
+	Status string
+	From   int64
+	To     int64
+	Offset int
+	Limit  int
+}
+
+// PlayerIndex keeps a sorted set of bet keys per player, scored by the time
+// the bet was first seen, so that bets can be listed without scanning keys.
+type PlayerIndex struct {
+	ctx context.Context
+	rdb redis.UniversalClient
+}
+
+func NewPlayerIndex(ctx context.Context, rdb redis.UniversalClient) *PlayerIndex {
+	return &PlayerIndex{
+		ctx: ctx,
+		rdb: rdb,
+	}
+}
+
+func playerBetsKey(address string) string {
+	return Key(fmt.Sprintf("player:%s:bets", address))
+}
+
+// Add indexes a bet of a player. Bets already in the index keep the time they
+// were first added with.
+func (p *PlayerIndex) Add(address, betKey string, at int64) error {
+	err := p.rdb.ZAddNX(p.ctx, playerBetsKey(address), redis.Z{Score: float64(at), Member: betKey}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add bet %s to player index - %s", betKey, err.Error())
+	}
+
+	return nil
+}
+
+// Bets returns a page of the bets of a player matching q, and whether more
+// bets match after that page.
+func (p *PlayerIndex) Bets(address string, q PlayerBetQuery) ([]PlayerBet, bool, error) {
+	bets := []PlayerBet{}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+
+	max := "+inf"
+	if q.To > 0 {
+		max = strconv.FormatInt(q.To, 10)
+	}
+	min := strconv.FormatInt(q.From, 10)
+
+	skipped := 0
+	for offset := int64(0); ; offset += playerBetsPageSize {
+		members, err := p.rdb.ZRevRangeByScoreWithScores(p.ctx, playerBetsKey(address), &redis.ZRangeBy{
+			Min:    min,
+			Max:    max,
+			Offset: offset,
+			Count:  playerBetsPageSize,
+		}).Result()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get player index from redis db - %s", err.Error())
+		}
+
+		// only load the bets of the requested game
+		var keys []string
+		var scores []int64
+		for _, m := range members {
+			key := m.Member.(string)
+			if q.Game != "" && BetGame(key) != q.Game {
+				continue
+			}
+			keys = append(keys, key)
+			scores = append(scores, int64(m.Score))
+		}
+
+		cmds, err := p.rdb.Pipelined(p.ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.HGetAll(p.ctx, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get bets from redis db - %s", err.Error())
+		}
+
+		for i, cmd := range cmds {
+			fields := cmd.(*redis.MapStringStringCmd).Val()
+			// bets removed from redis are skipped until the index is rebuilt
+			if len(fields) == 0 {
+				continue
+			}
+
+			bet := NewPlayerBet(keys[i], fields)
+			if q.Status != "" && bet.Status != q.Status && bet.Outcome != q.Status {
+				continue
+			}
+			if bet.CreatedAt == 0 {
+				bet.CreatedAt = scores[i]
+			}
+
+			if skipped < q.Offset {
+				skipped++
+				continue
+			}
+			if len(bets) == q.Limit {
+				return bets, true, nil
+			}
+			bets = append(bets, bet)
+		}
+
+		if len(members) < playerBetsPageSize {
+			return bets, false, nil
+		}
+	}
+}
+
+// Rebuild indexes every bet matching the redis key pattern, e.g. "roulette:*".
+// It returns the number of bets indexed.
+func (p *PlayerIndex) Rebuild(pattern string) (int, error) {
+	var count int
+
+	err := ScanKeys(p.ctx, p.rdb, Key(pattern), func(betKey string) error {
+		vals, err := p.rdb.HMGet(p.ctx, betKey, "playerAddr", "createdAt", "detectedAt").Result()
+		if err != nil {
+			return fmt.Errorf("failed to get key '%s' from redis db - %s", betKey, err.Error())
+		}
+
+		address, _ := vals[0].(string)
+		if address == "" {
+			return nil
+		}
+
+		var at int64
+		for _, v := range vals[1:] {
+			if s, ok := v.(string); ok && at == 0 {
+				at, _ = strconv.ParseInt(s, 10, 64)
+			}
+		}
+
+		if err := p.Add(address, betKey, at); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+// NewPlayerBet builds the history entry of a bet from its redis key and
+// fields.
+func NewPlayerBet(betKey string, fields map[string]string) PlayerBet {
+	bet := PlayerBet{
+		Game:       BetGame(betKey),
+		BoxId:      BetBoxId(betKey),
+		Status:     fields["status"],
+		Stake:      fields["stake"],
+		TokenId:    fields["tokenId"],
+		TokenName:  fields["tokenName"],
+		Subgame:    fields["subgame"],
+		Number:     fields["number"],
+		RandomNum:  fields["randomNum"],
+		BetTxId:    fields["betTxId"],
+		ResultTxId: strings.Trim(strings.TrimSpace(fields["txId"]), "\""),
+		Payout:     "0",
+	}
+	bet.CreatedAt, _ = strconv.ParseInt(fields["createdAt"], 10, 64)
+	if bet.CreatedAt == 0 {
+		bet.CreatedAt, _ = strconv.ParseInt(fields["detectedAt"], 10, 64)
+	}
+
+	switch {
+	case bet.Status == BetStatusRejected:
+		bet.Outcome = OutcomeRejected
+	case bet.Status == BetStatusRefunded:
+		bet.Outcome = OutcomeRefunded
+		bet.Payout = fields["stake"]
+	case fields["settled"] != "true":
+		bet.Outcome = OutcomePending
+	case fields["winnerAddr"] == fields["playerAddr"]:
+		bet.Outcome = OutcomeWon
+		bet.Payout = fields["winnerAmt"]
+	default:
+		bet.Outcome = OutcomeLost
+	}
+
+	return bet
+}
+
+// BetGame returns the game of a bet key of the form <game>:<boxId>:<addr>,
+// which may be prefixed with a namespace.
+func BetGame(betKey string) string {
+	parts := strings.Split(betKey, ":")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-3]
+}
+
+// BetBoxId returns the box id of a bet key of the form <game>:<boxId>:<addr>,
+// which may be prefixed with a namespace.
+func BetBoxId(betKey string) string {
+	parts := strings.Split(betKey, ":")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
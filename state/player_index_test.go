@@ -0,0 +1,184 @@
+package state
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPlayerBet(t *testing.T) {
+	const player = "9fPlayer"
+
+	tests := []struct {
+		name    string
+		key     string
+		fields  map[string]string
+		outcome string
+		payout  string
+	}{
+		{
+			name:    "pending",
+			key:     "roulette:box1:" + player,
+			fields:  map[string]string{"status": BetStatusPending, "settled": "false", "stake": "100", "playerAddr": player},
+			outcome: OutcomePending,
+			payout:  "0",
+		},
+		{
+			name:    "won",
+			key:     "roulette:box1:" + player,
+			fields:  map[string]string{"status": BetStatusSettled, "settled": "true", "stake": "100", "winnerAmt": "100", "playerAddr": player, "winnerAddr": player},
+			outcome: OutcomeWon,
+			payout:  "100",
+		},
+		{
+			name:    "lost",
+			key:     "roulette:box1:" + player,
+			fields:  map[string]string{"status": BetStatusSettled, "settled": "true", "stake": "100", "winnerAmt": "100", "playerAddr": player, "winnerAddr": "9fHouse"},
+			outcome: OutcomeLost,
+			payout:  "0",
+		},
+		{
+			name:    "refunded",
+			key:     "dryrun:roulette:box1:" + player,
+			fields:  map[string]string{"status": BetStatusRefunded, "settled": "true", "stake": "100", "playerAddr": player, "winnerAddr": player},
+			outcome: OutcomeRefunded,
+			payout:  "100",
+		},
+		{
+			name:    "rejected",
+			key:     "roulette:box1:" + player,
+			fields:  map[string]string{"status": BetStatusRejected, "settled": "true", "stake": "100", "playerAddr": player, "winnerAddr": player},
+			outcome: OutcomeRejected,
+			payout:  "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bet := NewPlayerBet(tt.key, tt.fields)
+			assert.Equal(t, "roulette", bet.Game)
+			assert.Equal(t, "box1", bet.BoxId)
+			assert.Equal(t, tt.outcome, bet.Outcome)
+			assert.Equal(t, tt.payout, bet.Payout)
+		})
+	}
+}
+
+func TestNewPlayerBetTxId(t *testing.T) {
+	// the tx id is stored the way the node answered it, as a json string
+	bet := NewPlayerBet("roulette:box1:9fPlayer", map[string]string{"txId": "\"abc\"\n"})
+	assert.Equal(t, "abc", bet.ResultTxId)
+}
+
+func TestBetKeyParts(t *testing.T) {
+	SetPrefix("{nightowl}")
+	SetNamespace("dryrun")
+	defer SetPrefix("")
+	defer SetNamespace("")
+
+	// the prefix and namespace come first, so the parts are read from the end
+	key := Key("roulette:box1:9fPlayer")
+	assert.Equal(t, "{nightowl}:dryrun:roulette:box1:9fPlayer", key)
+	assert.Equal(t, "roulette", BetGame(key))
+	assert.Equal(t, "box1", BetBoxId(key))
+
+	assert.Empty(t, BetBoxId("box1:9fPlayer"))
+}
+
+func newTestIndex(t *testing.T) (*PlayerIndex, redis.UniversalClient) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	return NewPlayerIndex(context.Background(), rdb), rdb
+}
+
+func TestPlayerIndexAdd(t *testing.T) {
+	const player = "9fPlayer"
+	p, rdb := newTestIndex(t)
+	ctx := context.Background()
+
+	betKey := Key("roulette:box1:" + player)
+	require.NoError(t, rdb.HSet(ctx, betKey, "status", BetStatusPending, "stake", "100").Err())
+	require.NoError(t, p.Add(player, betKey, 100))
+
+	// bets keep the time they were first added with
+	require.NoError(t, p.Add(player, betKey, 200))
+	bets, more, err := p.Bets(player, PlayerBetQuery{})
+	require.NoError(t, err)
+	assert.False(t, more)
+	require.Len(t, bets, 1)
+	assert.Equal(t, int64(100), bets[0].CreatedAt)
+	assert.Equal(t, "box1", bets[0].BoxId)
+
+	// bets removed from redis are skipped
+	require.NoError(t, rdb.Del(ctx, betKey).Err())
+	bets, _, err = p.Bets(player, PlayerBetQuery{})
+	require.NoError(t, err)
+	assert.Empty(t, bets)
+
+	// other players have their own index
+	bets, _, err = p.Bets("9fOther", PlayerBetQuery{})
+	require.NoError(t, err)
+	assert.Empty(t, bets)
+}
+
+func TestPlayerIndexBets(t *testing.T) {
+	const player = "9fPlayer"
+	p, rdb := newTestIndex(t)
+	ctx := context.Background()
+
+	// box<i> is created at i, every third bet is still pending and the
+	// others are lost, box4 is a bet of another game
+	for i := 1; i <= 9; i++ {
+		game := "roulette"
+		if i == 4 {
+			game = "dice"
+		}
+		fields := map[string]interface{}{"status": BetStatusSettled, "settled": "true", "playerAddr": player, "winnerAddr": "9fHouse"}
+		if i%3 == 0 {
+			fields = map[string]interface{}{"status": BetStatusPending, "settled": "false", "playerAddr": player}
+		}
+
+		betKey := Key(game + ":box" + strconv.Itoa(i) + ":" + player)
+		require.NoError(t, rdb.HSet(ctx, betKey, fields).Err())
+		require.NoError(t, p.Add(player, betKey, int64(i)))
+	}
+
+	boxIds := func(bets []PlayerBet) []string {
+		ids := make([]string, 0, len(bets))
+		for _, b := range bets {
+			ids = append(ids, b.BoxId)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name   string
+		query  PlayerBetQuery
+		boxIds []string
+		more   bool
+	}{
+		{"newest first", PlayerBetQuery{Limit: 3}, []string{"box9", "box8", "box7"}, true},
+		{"next page", PlayerBetQuery{Limit: 3, Offset: 3}, []string{"box6", "box5", "box4"}, true},
+		{"last page", PlayerBetQuery{Limit: 3, Offset: 6}, []string{"box3", "box2", "box1"}, false},
+		{"game", PlayerBetQuery{Game: "roulette", Limit: 3, Offset: 3}, []string{"box6", "box5", "box3"}, true},
+		{"status", PlayerBetQuery{Status: BetStatusPending}, []string{"box9", "box6", "box3"}, false},
+		{"outcome", PlayerBetQuery{Status: OutcomeLost, Limit: 2}, []string{"box8", "box7"}, true},
+		{"time range", PlayerBetQuery{From: 2, To: 4}, []string{"box4", "box3", "box2"}, false},
+		{"status in time range", PlayerBetQuery{Status: BetStatusPending, From: 4, To: 8}, []string{"box6"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bets, more, err := p.Bets(player, tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.boxIds, boxIds(bets))
+			assert.Equal(t, tt.more, more)
+		})
+	}
+}
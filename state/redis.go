@@ -0,0 +1,217 @@
+package state
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/spf13/viper"
+)
+
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+
+	// what a service does when redis can not be reached
+	RedisOnFailureExit    = "exit"
+	RedisOnFailureDegrade = "degrade"
+)
+
+var (
+	ErrClusterPrefix = errors.New("redis.key_prefix must be a hash tag such as {nightowl} in cluster mode")
+
+	// ErrStopScan is returned by the func given to ScanKeys to stop early
+	ErrStopScan = errors.New("stop scan")
+)
+
+// RedisConfig are the redis settings under the redis key of the config.
+// Timeouts are in seconds, zero values keep the go-redis defaults.
+type RedisConfig struct {
+	Mode             string   `mapstructure:"mode"`
+	Addrs            []string `mapstructure:"addrs"`
+	Username         string   `mapstructure:"username"`
+	Password         string   `mapstructure:"password"`
+	DB               int      `mapstructure:"db"`
+	MasterName       string   `mapstructure:"master_name"`
+	SentinelPassword string   `mapstructure:"sentinel_password"`
+	PoolSize         int      `mapstructure:"pool_size"`
+	MinIdleConns     int      `mapstructure:"min_idle_conns"`
+	DialTimeout      int      `mapstructure:"dial_timeout"`
+	ReadTimeout      int      `mapstructure:"read_timeout"`
+	WriteTimeout     int      `mapstructure:"write_timeout"`
+	TLS              RedisTLS `mapstructure:"tls"`
+	KeyPrefix        string   `mapstructure:"key_prefix"`
+	OnFailure        string   `mapstructure:"on_failure"`
+}
+
+// RedisTLS are the TLS settings of the redis connection, the client cert is
+// only needed if the server asks for one.
+type RedisTLS struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// LoadRedisConfig reads and checks the redis settings.
+func LoadRedisConfig() (RedisConfig, error) {
+	var conf RedisConfig
+
+	// UnmarshalKey alone would drop the defaults of the keys absent from the
+	// config file, AllSettings merges both
+	settings := viper.New()
+	if err := settings.MergeConfigMap(viper.AllSettings()); err != nil {
+		return conf, fmt.Errorf("failed to parse redis config - %s", err.Error())
+	}
+	if err := settings.UnmarshalKey("redis", &conf); err != nil {
+		return conf, fmt.Errorf("failed to parse redis config - %s", err.Error())
+	}
+
+	return conf, conf.Validate()
+}
+
+// Validate checks that the settings describe a usable connection.
+func (conf RedisConfig) Validate() error {
+	if len(conf.Addrs) == 0 {
+		return errors.New("redis.addrs must list at least one address")
+	}
+
+	switch conf.Mode {
+	case RedisModeStandalone:
+	case RedisModeSentinel:
+		if conf.MasterName == "" {
+			return errors.New("redis.master_name is required in sentinel mode")
+		}
+	case RedisModeCluster:
+		// bets, stats and queues are updated in multi key transactions which
+		// redis cluster only allows within a single slot
+		if !isHashTag(conf.KeyPrefix) {
+			return ErrClusterPrefix
+		}
+	default:
+		return fmt.Errorf("unknown redis mode '%s'", conf.Mode)
+	}
+
+	switch conf.OnFailure {
+	case RedisOnFailureExit, RedisOnFailureDegrade:
+	default:
+		return fmt.Errorf("redis.on_failure must be %s or %s", RedisOnFailureExit, RedisOnFailureDegrade)
+	}
+
+	return nil
+}
+
+func isHashTag(prefix string) bool {
+	return strings.HasPrefix(prefix, "{") && strings.HasSuffix(prefix, "}") && len(prefix) > 2
+}
+
+// NewRedisClient returns a client for the standalone server, sentinel
+// monitored master or cluster described by conf.
+func NewRedisClient(conf RedisConfig) (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            conf.Addrs,
+		Username:         conf.Username,
+		Password:         conf.Password,
+		DB:               conf.DB,
+		SentinelPassword: conf.SentinelPassword,
+		PoolSize:         conf.PoolSize,
+		MinIdleConns:     conf.MinIdleConns,
+		DialTimeout:      time.Duration(conf.DialTimeout) * time.Second,
+		ReadTimeout:      time.Duration(conf.ReadTimeout) * time.Second,
+		WriteTimeout:     time.Duration(conf.WriteTimeout) * time.Second,
+	}
+
+	if conf.TLS.Enabled {
+		tlsConfig, err := redisTLSConfig(conf.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	switch conf.Mode {
+	case RedisModeSentinel:
+		opts.MasterName = conf.MasterName
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case RedisModeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
+
+func redisTLSConfig(conf RedisTLS) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+
+	if conf.CAFile != "" {
+		contents, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis ca file - %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(contents) {
+			return nil, fmt.Errorf("no certs found in redis ca file %s", conf.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client cert - %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// ScanKeys calls fn with every key matching the pattern until fn returns an
+// error, which is returned as is unless it is ErrStopScan. In cluster mode
+// the keys of every master are scanned.
+func ScanKeys(ctx context.Context, rdb redis.UniversalClient, match string, fn func(key string) error) error {
+	scan := func(ctx context.Context, client redis.Cmdable) error {
+		iter := client.Scan(ctx, 0, match, 0).Iterator()
+		for iter.Next(ctx) {
+			if err := fn(iter.Val()); err != nil {
+				return err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to scan redis db for '%s' - %s", match, err.Error())
+		}
+		return nil
+	}
+
+	var err error
+	if cluster, ok := rdb.(*redis.ClusterClient); ok {
+		// fn is not expected to be safe for concurrent use
+		var mu sync.Mutex
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return scan(ctx, client)
+		})
+	} else {
+		err = scan(ctx, rdb)
+	}
+
+	if err == ErrStopScan {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRedisConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "standalone",
+			settings: map[string]interface{}{"mode": RedisModeStandalone, "addrs": []string{"localhost:6379"}, "on_failure": RedisOnFailureExit},
+		},
+		{
+			name:     "no addrs",
+			settings: map[string]interface{}{"mode": RedisModeStandalone, "on_failure": RedisOnFailureExit},
+			err:      "redis.addrs must list at least one address",
+		},
+		{
+			name:     "sentinel without master",
+			settings: map[string]interface{}{"mode": RedisModeSentinel, "addrs": []string{"localhost:26379"}, "on_failure": RedisOnFailureExit},
+			err:      "redis.master_name is required in sentinel mode",
+		},
+		{
+			name:     "cluster without hash tag",
+			settings: map[string]interface{}{"mode": RedisModeCluster, "addrs": []string{"localhost:7000"}, "key_prefix": "nightowl", "on_failure": RedisOnFailureDegrade},
+			err:      ErrClusterPrefix.Error(),
+		},
+		{
+			name:     "cluster",
+			settings: map[string]interface{}{"mode": RedisModeCluster, "addrs": []string{"localhost:7000"}, "key_prefix": "{nightowl}", "on_failure": RedisOnFailureDegrade},
+		},
+		{
+			name:     "unknown policy",
+			settings: map[string]interface{}{"mode": RedisModeStandalone, "addrs": []string{"localhost:6379"}, "on_failure": "retry"},
+			err:      "redis.on_failure must be exit or degrade",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			viper.Set("redis", tt.settings)
+
+			_, err := LoadRedisConfig()
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	defer SetPrefix("")
+	defer SetNamespace("")
+
+	assert.Equal(t, "roulette:box1", Key("roulette:box1"))
+
+	SetPrefix("{nightowl}")
+	assert.Equal(t, "{nightowl}:roulette:box1", Key("roulette:box1"))
+
+	SetNamespace("dryrun")
+	assert.Equal(t, "{nightowl}:dryrun:roulette:box1", Key("roulette:box1"))
+
+	SetPrefix("")
+	assert.Equal(t, "dryrun:roulette:box1", Key("roulette:box1"))
+}
@@ -0,0 +1,144 @@
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+const (
+	sessionRedisKeyPrefix   = "session:"
+	challengeRedisKeyPrefix = "auth:challenge:"
+	sessionIdBytes          = 32
+	nonceBytes              = 16
+)
+
+var (
+	ErrSessionNotFound   = errors.New("session not found or expired")
+	ErrChallengeNotFound = errors.New("challenge not found or expired")
+)
+
+// Session binds a session id handed to a player to the wallet address the
+// player proved to own.
+type Session struct {
+	Id        string `json:"id"`
+	Address   string `json:"address"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func (s Session) MarshalBinary() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// SessionStore keeps player sessions in redis, where they expire on their own.
+type SessionStore struct {
+	ctx context.Context
+	rdb redis.UniversalClient
+}
+
+func NewSessionStore(ctx context.Context, rdb redis.UniversalClient) *SessionStore {
+	return &SessionStore{
+		ctx: ctx,
+		rdb: rdb,
+	}
+}
+
+// Create starts a new session for a wallet address which lasts for ttl.
+func (s *SessionStore) Create(address string, ttl time.Duration) (Session, error) {
+	id, err := randomHex(sessionIdBytes)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to generate session id - %s", err.Error())
+	}
+
+	session := Session{
+		Id:        id,
+		Address:   address,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+
+	err = s.rdb.Set(s.ctx, Key(sessionRedisKeyPrefix+session.Id), session, ttl).Err()
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to store session in redis db - %s", err.Error())
+	}
+
+	return session, nil
+}
+
+// Get returns the session with the given id, ErrSessionNotFound if it does not
+// exist or expired.
+func (s *SessionStore) Get(id string) (Session, error) {
+	var session Session
+
+	if id == "" {
+		return session, ErrSessionNotFound
+	}
+
+	val, err := s.rdb.Get(s.ctx, Key(sessionRedisKeyPrefix+id)).Result()
+	switch {
+	case err == redis.Nil:
+		return session, ErrSessionNotFound
+	case err != nil:
+		return session, fmt.Errorf("failed to get session from redis db - %s", err.Error())
+	}
+
+	err = json.Unmarshal([]byte(val), &session)
+	if err != nil {
+		return session, fmt.Errorf("failed to unmarshal session - %s", err.Error())
+	}
+
+	return session, nil
+}
+
+// Delete ends a session.
+func (s *SessionStore) Delete(id string) error {
+	err := s.rdb.Del(s.ctx, Key(sessionRedisKeyPrefix+id)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to remove session from redis db - %s", err.Error())
+	}
+
+	return nil
+}
+
+// CreateChallenge returns a nonce the owner of a wallet address has to sign
+// within ttl to log in.
+func (s *SessionStore) CreateChallenge(address string, ttl time.Duration) (string, error) {
+	nonce, err := randomHex(nonceBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce - %s", err.Error())
+	}
+
+	err = s.rdb.Set(s.ctx, Key(challengeRedisKeyPrefix+nonce), address, ttl).Err()
+	if err != nil {
+		return "", fmt.Errorf("failed to store challenge in redis db - %s", err.Error())
+	}
+
+	return nonce, nil
+}
+
+// TakeChallenge returns the wallet address a nonce was issued for and removes
+// the challenge, so every nonce can be used for a single login attempt.
+func (s *SessionStore) TakeChallenge(nonce string) (string, error) {
+	address, err := s.rdb.GetDel(s.ctx, Key(challengeRedisKeyPrefix+nonce)).Result()
+	switch {
+	case err == redis.Nil:
+		return "", ErrChallengeNotFound
+	case err != nil:
+		return "", fmt.Errorf("failed to get challenge from redis db - %s", err.Error())
+	}
+
+	return address, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
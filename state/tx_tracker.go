@@ -0,0 +1,104 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v9"
+)
+
+const (
+	trackedTxsRedisKey = "payout:txs"
+)
+
+// TrackedTx is a result or refund tx submitted by the payout service which
+// has not been confirmed yet. Every version of the tx spends the bet box, so
+// at most one of them can ever be mined.
+type TrackedTx struct {
+	BoxId        string          `json:"boxId"`
+	BetKey       string          `json:"betKey"`
+	Kind         string          `json:"kind"`
+	TxId         string          `json:"txId"`
+	PrevTxIds    []string        `json:"prevTxIds,omitempty"`
+	Request      json.RawMessage `json:"request"`
+	Fee          int             `json:"fee"`
+	SubmittedAt  int64           `json:"submittedAt"`
+	Rebroadcasts int             `json:"rebroadcasts"`
+	Replacements int             `json:"replacements"`
+	MissingSince int64           `json:"missingSince,omitempty"`
+	LastError    string          `json:"lastError,omitempty"`
+	// the queued bet the tx resolves, queued again if the tx is rejected
+	// while the bet box is unspent
+	Bet PendingBet `json:"bet"`
+	// the stats of the bet, recorded once the tx is confirmed
+	Settlement json.RawMessage `json:"settlement,omitempty"`
+}
+
+func (t TrackedTx) MarshalBinary() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+// TxIds returns the id of every version of the tx, the latest first.
+func (t TrackedTx) TxIds() []string {
+	ids := []string{t.TxId}
+	for i := len(t.PrevTxIds) - 1; i >= 0; i-- {
+		ids = append(ids, t.PrevTxIds[i])
+	}
+	return ids
+}
+
+// TxTracker stores the submitted txs awaiting confirmation, keyed by the box
+// id of the bet they resolve.
+type TxTracker struct {
+	ctx context.Context
+	rdb redis.UniversalClient
+}
+
+func NewTxTracker(ctx context.Context, rdb redis.UniversalClient) *TxTracker {
+	return &TxTracker{
+		ctx: ctx,
+		rdb: rdb,
+	}
+}
+
+// Track adds or replaces a submitted tx.
+func (t *TxTracker) Track(tx TrackedTx) error {
+	err := t.rdb.HSet(t.ctx, Key(trackedTxsRedisKey), tx.BoxId, tx).Err()
+	if err != nil {
+		return fmt.Errorf("failed to track tx %s in redis db - %s", tx.TxId, err.Error())
+	}
+
+	return nil
+}
+
+// All returns every tracked tx.
+func (t *TxTracker) All() ([]TrackedTx, error) {
+	vals, err := t.rdb.HGetAll(t.ctx, Key(trackedTxsRedisKey)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracked txs from redis db - %s", err.Error())
+	}
+
+	txs := make([]TrackedTx, 0, len(vals))
+	for boxId, val := range vals {
+		var tx TrackedTx
+
+		err = json.Unmarshal([]byte(val), &tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tracked tx of bet %s - %s", boxId, err.Error())
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs, nil
+}
+
+// Remove stops tracking the tx of a bet.
+func (t *TxTracker) Remove(boxId string) error {
+	err := t.rdb.HDel(t.ctx, Key(trackedTxsRedisKey), boxId).Err()
+	if err != nil {
+		return fmt.Errorf("failed to remove tracked tx of bet %s from redis db - %s", boxId, err.Error())
+	}
+
+	return nil
+}
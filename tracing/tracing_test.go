@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPropagation(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx, span := Start(context.Background(), "payout.resolve_bet")
+	defer span.End()
+	want := span.SpanContext()
+
+	// bets carry their trace context in redis
+	traceparent := Traceparent(ctx)
+	assert.Contains(t, traceparent, want.TraceID().String())
+	got := trace.SpanContextFromContext(FromTraceparent(context.Background(), traceparent))
+	assert.Equal(t, want.TraceID(), got.TraceID())
+	assert.Equal(t, want.SpanID(), got.SpanID())
+
+	// and in the headers of nats messages
+	msg := &nats.Msg{Subject: "notif.payouts"}
+	InjectNATS(ctx, msg)
+	got = trace.SpanContextFromContext(ExtractNATS(context.Background(), msg))
+	assert.Equal(t, want.TraceID(), got.TraceID())
+
+	// a missing trace context starts a new trace
+	assert.False(t, trace.SpanContextFromContext(FromTraceparent(context.Background(), "")).IsValid())
+	assert.False(t, trace.SpanContextFromContext(ExtractNATS(context.Background(), &nats.Msg{})).IsValid())
+}